@@ -0,0 +1,123 @@
+package stomp
+
+import (
+	"context"
+
+	"github.com/go-stomp/stomp/frame"
+)
+
+// SendWithReceipt sends a message to the STOMP server with a receipt
+// header, like Send with the SendOpt.Receipt option, but does not wait for
+// the RECEIPT frame. The returned channel receives a single value once the
+// server has responded: nil for a RECEIPT, or the error otherwise.
+// Calling SendWithReceipt repeatedly keeps many messages in flight
+// instead of waiting for a round trip to the server for each one.
+func (c *Conn) SendWithReceipt(destination, contentType string, body []byte, opts ...func(*frame.Frame) error) <-chan error {
+	errCh := make(chan error, 1)
+
+	request, err := c.sendRequest(destination, contentType, body, opts)
+	if err != nil {
+		errCh <- err
+		return errCh
+	}
+
+	go func() {
+		select {
+		case response, ok := <-request.C:
+			errCh <- receiptError(response, ok)
+		case <-c.done:
+			errCh <- closedReceiptError(request)
+		}
+	}()
+	return errCh
+}
+
+// sendRequest creates a SEND frame with a receipt header and hands it
+// to processLoop, which delivers the response on the returned request's
+// channel.
+func (c *Conn) sendRequest(destination, contentType string, body []byte, opts []func(*frame.Frame) error) (writeRequest, error) {
+	if c.isClosed() {
+		return writeRequest{}, ErrAlreadyClosed
+	}
+
+	f, err := c.createSendFrame(context.Background(), destination, contentType, body, opts)
+	if err != nil {
+		return writeRequest{}, err
+	}
+	if _, ok := f.Header.Contains(frame.Receipt); !ok {
+		f.Header.Set(frame.Receipt, allocateId())
+	}
+	if err := c.interceptOutbound(f); err != nil {
+		return writeRequest{}, err
+	}
+
+	request := writeRequest{
+		Frame: f,
+		C:     make(chan *frame.Frame, 1),
+	}
+	if err := c.writeContext(context.Background(), request); err != nil {
+		return writeRequest{}, err
+	}
+	return request, nil
+}
+
+// A Batch sends any number of messages to the STOMP server without
+// waiting for their receipts, and then waits for all the receipts at once.
+// Create a Batch using Conn.NewBatch. A Batch is not safe for concurrent use.
+type Batch struct {
+	conn     *Conn
+	requests []writeRequest
+}
+
+// NewBatch creates a Batch of messages sent on the connection.
+func (c *Conn) NewBatch() *Batch {
+	return &Batch{conn: c}
+}
+
+// Send sends a message with a receipt header, as for Conn.Send, and adds it
+// to the batch without waiting for the RECEIPT frame.
+func (b *Batch) Send(destination, contentType string, body []byte, opts ...func(*frame.Frame) error) error {
+	request, err := b.conn.sendRequest(destination, contentType, body, opts)
+	if err != nil {
+		return err
+	}
+	b.requests = append(b.requests, request)
+	return nil
+}
+
+// Len returns the number of messages in the batch whose receipts
+// have not been waited for.
+func (b *Batch) Len() int {
+	return len(b.requests)
+}
+
+// Wait waits for the receipts of all messages in the batch, and returns
+// the first error received instead of a RECEIPT frame. If ctx is done
+// first, Wait stops waiting and returns ctx.Err(); the messages that had
+// not been confirmed may still be delivered. Messages that were not yet
+// written when the connection closed for good fail with ErrAlreadyClosed.
+// The batch is empty when Wait returns, and can be used for more messages.
+func (b *Batch) Wait(ctx context.Context) error {
+	requests := b.requests
+	b.requests = nil
+
+	var firstErr error
+	for i, request := range requests {
+		select {
+		case response, ok := <-request.C:
+			if err := receiptError(response, ok); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		case <-ctx.Done():
+			for _, r := range requests[i:] {
+				b.conn.cancelReceipt(r.Frame.Header.Get(frame.Receipt))
+			}
+			return ctx.Err()
+		case <-b.conn.done:
+			if err := closedReceiptError(request); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
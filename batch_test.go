@@ -0,0 +1,76 @@
+package stomp
+
+import (
+	"context"
+	"net"
+
+	"github.com/go-stomp/stomp/frame"
+	. "gopkg.in/check.v1"
+)
+
+func (s *StompSuite) TestBatch(c *C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer listener.Close()
+
+	go func() {
+		server, err := listener.Accept()
+		c.Assert(err, IsNil)
+		reader := frame.NewReader(server)
+		writer := frame.NewWriter(server)
+		f, err := reader.Read()
+		c.Assert(err, IsNil)
+		c.Assert(f.Command, Equals, frame.CONNECT)
+		writer.Write(frame.New(frame.CONNECTED, frame.Version, "1.2"))
+
+		for {
+			f, err := reader.Read()
+			if err != nil {
+				return
+			}
+			if f == nil {
+				continue
+			}
+			receipt := f.Header.Get(frame.Receipt)
+			if string(f.Body) == "reject" {
+				writer.Write(frame.New(frame.ERROR, frame.ReceiptId, receipt, frame.Message, "rejected"))
+				server.Close()
+				return
+			}
+			writer.Write(frame.New(frame.RECEIPT, frame.ReceiptId, receipt))
+		}
+	}()
+
+	conn, err := Dial("tcp", listener.Addr().String(), ConnOpt.NoReconnect)
+	c.Assert(err, IsNil)
+
+	b := conn.NewBatch()
+	for i := 0; i < 1000; i++ {
+		c.Assert(b.Send("/queue/test", "text/plain", []byte("hello")), IsNil)
+	}
+	c.Check(b.Len(), Equals, 1000)
+	c.Check(b.Wait(context.Background()), IsNil)
+	c.Check(b.Len(), Equals, 0)
+
+	c.Check(<-conn.SendWithReceipt("/queue/test", "text/plain", []byte("hello")), IsNil)
+
+	err = <-conn.SendWithReceipt("/queue/test", "text/plain", []byte("reject"))
+	c.Assert(err, NotNil)
+	c.Check(err.Error(), Equals, "rejected")
+}
+
+func (s *StompSuite) TestBatchConnectionClosed(c *C) {
+	conn, rw := connectHelper(c, V12)
+
+	// the server reads nothing, so the first message blocks
+	// processLoop and the others wait to be written
+	b := conn.NewBatch()
+	for i := 0; i < 3; i++ {
+		c.Assert(b.Send("/queue/test", "text/plain", []byte("hello")), IsNil)
+	}
+	errCh := conn.SendWithReceipt("/queue/test", "text/plain", []byte("hello"))
+	rw.Close()
+
+	c.Check(b.Wait(context.Background()), NotNil)
+	c.Check(<-errCh, Equals, ErrAlreadyClosed)
+}
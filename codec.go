@@ -0,0 +1,137 @@
+package stomp
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+	"sync"
+
+	"github.com/go-stomp/stomp/frame"
+)
+
+// Content types of the codecs registered by default.
+const (
+	ContentTypeJSON  = "application/json"
+	ContentTypeBytes = "application/octet-stream"
+	ContentTypeText  = "text/plain"
+)
+
+// A Codec converts values to and from message bodies of a content type.
+// Codecs are registered with RegisterCodec, and used by Conn.SendValue,
+// Marshal and Message.Decode.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var codecs = struct {
+	sync.RWMutex
+	m map[string]Codec
+}{m: make(map[string]Codec)}
+
+func init() {
+	RegisterCodec(ContentTypeJSON, JSONCodec{})
+	RegisterCodec(ContentTypeBytes, RawCodec{})
+	RegisterCodec(ContentTypeText, RawCodec{})
+}
+
+// RegisterCodec makes codec available for a content type, replacing any
+// codec already registered for it. Parameters of the content type, such as
+// charset, are ignored when looking up a codec.
+func RegisterCodec(contentType string, codec Codec) {
+	codecs.Lock()
+	defer codecs.Unlock()
+	codecs.m[mediaType(contentType)] = codec
+}
+
+// LookupCodec returns the codec registered for a content type.
+func LookupCodec(contentType string) (Codec, bool) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	codec, ok := codecs.m[mediaType(contentType)]
+	return codec, ok
+}
+
+// mediaType returns the content type without its parameters.
+func mediaType(contentType string) string {
+	if t, _, err := mime.ParseMediaType(contentType); err == nil {
+		return t
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+func unknownContentType(contentType string) Error {
+	return newErrorMessage("no codec for content type: " + contentType)
+}
+
+// Marshal encodes v with the codec registered for contentType.
+func Marshal(contentType string, v interface{}) ([]byte, error) {
+	codec, ok := LookupCodec(contentType)
+	if !ok {
+		return nil, unknownContentType(contentType)
+	}
+	return codec.Marshal(v)
+}
+
+// SendValue encodes v with the codec for the content type specified with
+// ConnOpt.ContentType, which defaults to ContentTypeJSON, and sends it to
+// destination as for Send.
+func (c *Conn) SendValue(destination string, v interface{}, opts ...func(*frame.Frame) error) error {
+	contentType := c.options.ContentType
+	body, err := Marshal(contentType, v)
+	if err != nil {
+		return err
+	}
+	return c.Send(destination, contentType, body, opts...)
+}
+
+// Decode decodes the message body into v, with the codec registered for
+// the content type of the message.
+func (msg *Message) Decode(v interface{}) error {
+	if msg.Err != nil {
+		return msg.Err
+	}
+	codec, ok := LookupCodec(msg.ContentType)
+	if !ok {
+		return unknownContentType(msg.ContentType)
+	}
+	return codec.Unmarshal(msg.Body, v)
+}
+
+// JSONCodec encodes values using encoding/json.
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// RawCodec passes message bodies through unchanged. It marshals values
+// of type []byte and string, and unmarshals into *[]byte and *string.
+type RawCodec struct{}
+
+func (RawCodec) Marshal(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	}
+	return nil, newErrorMessage(fmt.Sprintf("raw codec cannot marshal %T", v))
+}
+
+func (RawCodec) Unmarshal(data []byte, v interface{}) error {
+	switch v := v.(type) {
+	case *[]byte:
+		*v = append([]byte(nil), data...)
+		return nil
+	case *string:
+		*v = string(data)
+		return nil
+	}
+	return newErrorMessage(fmt.Sprintf("raw codec cannot unmarshal into %T", v))
+}
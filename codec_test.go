@@ -0,0 +1,38 @@
+package stomp
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *StompSuite) TestCodecs(c *C) {
+	type point struct{ X, Y int }
+
+	body, err := Marshal(ContentTypeJSON, point{1, 2})
+	c.Assert(err, IsNil)
+	c.Check(string(body), Equals, `{"X":1,"Y":2}`)
+
+	var p point
+	msg := &Message{ContentType: "application/json; charset=utf-8", Body: body}
+	c.Assert(msg.Decode(&p), IsNil)
+	c.Check(p, Equals, point{1, 2})
+
+	var text string
+	msg = &Message{ContentType: ContentTypeText, Body: []byte("hello")}
+	c.Assert(msg.Decode(&text), IsNil)
+	c.Check(text, Equals, "hello")
+
+	_, err = Marshal(ContentTypeBytes, point{})
+	c.Check(err, NotNil)
+
+	msg = &Message{ContentType: "application/x-unknown"}
+	c.Check(msg.Decode(&p), ErrorMatches, "no codec for content type: application/x-unknown")
+}
+
+type upperCodec struct{ RawCodec }
+
+func (s *StompSuite) TestRegisterCodec(c *C) {
+	RegisterCodec("Application/X-Upper", upperCodec{})
+	codec, ok := LookupCodec("application/x-upper; v=1")
+	c.Assert(ok, Equals, true)
+	c.Check(codec, Equals, upperCodec{})
+}
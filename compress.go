@@ -0,0 +1,181 @@
+package stomp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"sync"
+
+	"github.com/go-stomp/stomp/frame"
+)
+
+// Names of the compression algorithms registered by default,
+// as sent in the content-encoding header.
+const (
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+)
+
+// Default maximum size of a decompressed message body, which protects
+// the program from small messages that decompress to huge bodies.
+// Override with ConnOpt.MaxDecompressedSize.
+const DefaultMaxDecompressedSize = 64 * 1024 * 1024
+
+// A Compressor compresses and decompresses message bodies. Compressors
+// are registered with RegisterCompressor under the name used in the
+// content-encoding header, which allows algorithms such as zstd or snappy
+// to be added without this package depending on them.
+type Compressor interface {
+	Compress(data []byte) ([]byte, error)
+
+	// NewReader returns a reader of the data decompressed from r. The
+	// caller limits how much is read, and closes the reader when done.
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+var compressors = struct {
+	sync.RWMutex
+	m map[string]Compressor
+}{m: make(map[string]Compressor)}
+
+func init() {
+	RegisterCompressor(EncodingGzip, gzipCompressor{})
+	RegisterCompressor(EncodingDeflate, deflateCompressor{})
+}
+
+// RegisterCompressor makes a compressor available for an encoding,
+// replacing any compressor already registered for it.
+func RegisterCompressor(encoding string, c Compressor) {
+	compressors.Lock()
+	defer compressors.Unlock()
+	compressors.m[encoding] = c
+}
+
+func lookupCompressor(encoding string) (Compressor, bool) {
+	compressors.RLock()
+	defer compressors.RUnlock()
+	c, ok := compressors.m[encoding]
+	return c, ok
+}
+
+func unknownEncoding(encoding string) Error {
+	return newErrorMessage("no compressor for content encoding: " + encoding)
+}
+
+// compressBody compresses the body of a frame, and sets the content-encoding
+// and content-length header entries to match. The content-length is set even
+// if the frame had none, because a compressed body can contain NUL bytes,
+// which would otherwise end the frame.
+func compressBody(f *frame.Frame, encoding string) error {
+	c, ok := lookupCompressor(encoding)
+	if !ok {
+		return unknownEncoding(encoding)
+	}
+	body, err := c.Compress(f.Body)
+	if err != nil {
+		return err
+	}
+	f.Body = body
+	f.Header.Set(frame.ContentEncoding, encoding)
+	f.Header.Set(frame.ContentLength, strconv.Itoa(len(body)))
+	return nil
+}
+
+// decompressBody reverses compressBody for a frame received from the
+// server. Frames with no content-encoding, or an encoding with no
+// registered compressor, are left unchanged. A body that decompresses
+// to more than maxSize bytes is left compressed, and an error returned.
+func decompressBody(f *frame.Frame, maxSize int) error {
+	encoding, ok := f.Header.Contains(frame.ContentEncoding)
+	if !ok {
+		return nil
+	}
+	c, ok := lookupCompressor(encoding)
+	if !ok {
+		return nil
+	}
+	r, err := c.NewReader(bytes.NewReader(f.Body))
+	if err != nil {
+		return newErrorMessage("cannot decompress message body: " + err.Error())
+	}
+	defer r.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(r, int64(maxSize)+1))
+	if err != nil {
+		return newErrorMessage("cannot decompress message body: " + err.Error())
+	}
+	if len(body) > maxSize {
+		return ErrDecompressedTooLarge
+	}
+	f.Body = body
+	f.Header.Del(frame.ContentEncoding)
+	if _, ok := f.Header.Contains(frame.ContentLength); ok {
+		f.Header.Set(frame.ContentLength, strconv.Itoa(len(body)))
+	}
+	return nil
+}
+
+// compressFrame applies the connection-wide compression specified
+// with ConnOpt.Compress to a SEND frame, unless the frame is already
+// compressed or its body is smaller than the threshold.
+func (c *Conn) compressFrame(f *frame.Frame) error {
+	if c.options == nil || c.options.Compress == "" {
+		return nil
+	}
+	if len(f.Body) < c.options.CompressMinSize {
+		return nil
+	}
+	if _, ok := f.Header.Contains(frame.ContentEncoding); ok {
+		return nil
+	}
+	return compressBody(f, c.options.Compress)
+}
+
+// maxDecompressedSize returns the maximum size of a message body once
+// decompressed, as specified with ConnOpt.MaxDecompressedSize.
+func (c *Conn) maxDecompressedSize() int {
+	if c == nil || c.options == nil || c.options.MaxDecompressed == 0 {
+		return DefaultMaxDecompressedSize
+	}
+	return c.options.MaxDecompressed
+}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// deflateCompressor uses the zlib format (RFC 1950) for "deflate",
+// as HTTP does, rather than raw DEFLATE data.
+type deflateCompressor struct{}
+
+func (deflateCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (deflateCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return zlib.NewReader(r)
+}
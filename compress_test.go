@@ -0,0 +1,101 @@
+package stomp
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"strconv"
+
+	"github.com/go-stomp/stomp/frame"
+	. "gopkg.in/check.v1"
+)
+
+func (s *StompSuite) TestCompressBody(c *C) {
+	body := bytes.Repeat([]byte("compressible "), 100)
+	for _, encoding := range []string{EncodingGzip, EncodingDeflate} {
+		f := frame.New(frame.SEND, frame.ContentLength, "1300")
+		f.Body = body
+		c.Assert(SendOpt.Compress(encoding)(f), IsNil)
+		c.Check(f.Header.Get(frame.ContentEncoding), Equals, encoding)
+		c.Check(len(f.Body) < len(body), Equals, true)
+		c.Check(f.Header.Get(frame.ContentLength), Not(Equals), "1300")
+
+		c.Assert(decompressBody(f, DefaultMaxDecompressedSize), IsNil)
+		c.Check(f.Body, DeepEquals, body)
+		c.Check(f.Header.Get(frame.ContentLength), Equals, "1300")
+		_, ok := f.Header.Contains(frame.ContentEncoding)
+		c.Check(ok, Equals, false)
+	}
+
+	// "deflate" is the zlib format, as written by other programs
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(body)
+	c.Assert(w.Close(), IsNil)
+	f := frame.New(frame.MESSAGE, frame.ContentEncoding, EncodingDeflate)
+	f.Body = buf.Bytes()
+	c.Assert(decompressBody(f, DefaultMaxDecompressedSize), IsNil)
+	c.Check(f.Body, DeepEquals, body)
+
+	f = frame.New(frame.SEND)
+	c.Check(SendOpt.Compress("zstd")(f), ErrorMatches, "no compressor for content encoding: zstd")
+
+	// unknown encodings are left for the program to handle
+	f = frame.New(frame.MESSAGE, frame.ContentEncoding, "zstd")
+	f.Body = body
+	c.Check(decompressBody(f, DefaultMaxDecompressedSize), IsNil)
+	c.Check(f.Body, DeepEquals, body)
+}
+
+func (s *StompSuite) TestCompressThreshold(c *C) {
+	conn := &Conn{options: &connOptions{}}
+	c.Assert(ConnOpt.Compress(EncodingGzip, 100)(conn), IsNil)
+
+	f, err := conn.createSendFrame(context.Background(), "/queue/test", "text/plain", []byte("small"), nil)
+	c.Assert(err, IsNil)
+	_, ok := f.Header.Contains(frame.ContentEncoding)
+	c.Check(ok, Equals, false)
+
+	f, err = conn.createSendFrame(context.Background(), "/queue/test", "text/plain", bytes.Repeat([]byte("x"), 100), nil)
+	c.Assert(err, IsNil)
+	c.Check(f.Header.Get(frame.ContentEncoding), Equals, EncodingGzip)
+}
+
+func (s *StompSuite) TestCompressSetsContentLength(c *C) {
+	body := bytes.Repeat([]byte("compressible "), 100)
+	f, err := (&Conn{options: &connOptions{}}).createSendFrame(context.Background(), "/queue/test", "text/plain", body,
+		[]func(*frame.Frame) error{SendOpt.NoContentLength, SendOpt.Compress(EncodingGzip)})
+	c.Assert(err, IsNil)
+	c.Check(f.Header.Get(frame.ContentLength), Equals, strconv.Itoa(len(f.Body)))
+
+	// in the other order, the compressed body keeps its content-length
+	f, err = (&Conn{options: &connOptions{}}).createSendFrame(context.Background(), "/queue/test", "text/plain", body,
+		[]func(*frame.Frame) error{SendOpt.Compress(EncodingGzip), SendOpt.NoContentLength})
+	c.Assert(err, IsNil)
+	c.Check(f.Header.Get(frame.ContentLength), Equals, strconv.Itoa(len(f.Body)))
+}
+
+func (s *StompSuite) TestDecompressLimit(c *C) {
+	body := bytes.Repeat([]byte{0}, 1<<20)
+	for _, encoding := range []string{EncodingGzip, EncodingDeflate} {
+		f := frame.New(frame.MESSAGE)
+		f.Body = body
+		c.Assert(compressBody(f, encoding), IsNil)
+		compressed := f.Body
+
+		c.Check(decompressBody(f, 1000), Equals, ErrDecompressedTooLarge)
+		c.Check(f.Body, DeepEquals, compressed)
+		c.Check(f.Header.Get(frame.ContentEncoding), Equals, encoding)
+
+		c.Assert(decompressBody(f, len(body)), IsNil)
+		c.Check(f.Body, DeepEquals, body)
+	}
+}
+
+func (s *StompSuite) TestCompressOptions(c *C) {
+	conn := &Conn{options: &connOptions{}}
+	c.Check(ConnOpt.Compress(EncodingGzip, -1)(conn), Equals, ErrInvalidCompressMinSize)
+	c.Check(ConnOpt.MaxDecompressedSize(0)(conn), Equals, ErrInvalidMaxDecompressed)
+	c.Assert(ConnOpt.MaxDecompressedSize(1024)(conn), IsNil)
+	c.Check(conn.options.MaxDecompressed, Equals, 1024)
+}
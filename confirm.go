@@ -0,0 +1,228 @@
+package stomp
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"github.com/go-stomp/stomp/frame"
+)
+
+// A Confirm is the outcome of a message sent with Conn.SendAsync.
+// It is resolved when the STOMP server acknowledges the message with a
+// RECEIPT frame, when the server rejects it with an ERROR frame, or when
+// the connection closes and the message can no longer be delivered.
+type Confirm struct {
+	receipt string
+	done    chan struct{}
+	err     error
+}
+
+func newConfirm(receipt string) *Confirm {
+	return &Confirm{receipt: receipt, done: make(chan struct{})}
+}
+
+func (cf *Confirm) resolve(err error) {
+	cf.err = err
+	close(cf.done)
+}
+
+// Receipt returns the value of the receipt header of the SEND frame.
+func (cf *Confirm) Receipt() string {
+	return cf.receipt
+}
+
+// Done returns a channel that is closed once the confirm is resolved.
+func (cf *Confirm) Done() <-chan struct{} {
+	return cf.done
+}
+
+// Err returns nil if the server has acknowledged the message, or the reason
+// the message was not delivered. Returns nil if the confirm is not resolved yet.
+func (cf *Confirm) Err() error {
+	select {
+	case <-cf.done:
+		return cf.err
+	default:
+		return nil
+	}
+}
+
+// Wait waits until the confirm is resolved and returns Err. Returns
+// ctx.Err() if ctx is done first, in which case the message remains
+// in flight and may still be delivered.
+func (cf *Confirm) Wait(ctx context.Context) error {
+	select {
+	case <-cf.done:
+		return cf.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SendAsync sends a message to the STOMP server like Send, but does not wait
+// for it. The SEND frame always requests a receipt, and the returned Confirm
+// is resolved when the RECEIPT arrives. Messages sent this way are tracked
+// until they are confirmed: if the connection is lost, all unconfirmed
+// messages are sent again, in their original order, once it has been
+// re-established. Messages can therefore be delivered more than once.
+//
+// Returns an error straight away if the frame cannot be created or is
+// rejected by an interceptor, or if the connection has been closed and will
+// not be re-established.
+func (c *Conn) SendAsync(destination, contentType string, body []byte, opts ...func(*frame.Frame) error) (*Confirm, error) {
+	return c.sendAsync(context.Background(), destination, contentType, body, opts)
+}
+
+func (c *Conn) sendAsync(ctx context.Context, destination, contentType string, body []byte, opts []func(*frame.Frame) error) (*Confirm, error) {
+	c.stateMutex.Lock()
+	disconnected := c.disconnected
+	c.stateMutex.Unlock()
+	if disconnected {
+		return nil, ErrAlreadyClosed
+	}
+
+	f, err := c.createSendFrame(ctx, destination, contentType, body, opts)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := f.Header.Contains(frame.Transaction); ok {
+		// transactions do not survive a lost connection
+		return nil, ErrInvalidCommand
+	}
+
+	receipt, ok := f.Header.Contains(frame.Receipt)
+	if !ok {
+		receipt = allocateId()
+		f.Header.Set(frame.Receipt, receipt)
+	}
+	if err := c.interceptOutbound(f); err != nil {
+		return nil, err
+	}
+
+	cf := newConfirm(receipt)
+	if err := c.inflight.Add(f, cf); err != nil {
+		return nil, err
+	}
+	return cf, nil
+}
+
+// inflightStore keeps the SEND frames that have not been confirmed yet,
+// in the order they were sent. It is shared by the goroutines calling
+// SendAsync and the processLoop goroutine, which writes the frames and
+// resolves their confirms.
+type inflightStore struct {
+	mutex sync.Mutex
+	sends map[string]*list.Element // keyed by receipt id
+	order *list.List               // *inflightSend, oldest first
+	next  *list.Element            // first send not yet written to the current connection
+	err   error                    // set once sends can no longer be delivered
+	ready chan struct{}            // signals processLoop that there are sends to write
+}
+
+type inflightSend struct {
+	frame   *frame.Frame
+	confirm *Confirm
+}
+
+func newInflightStore() *inflightStore {
+	return &inflightStore{
+		sends: make(map[string]*list.Element),
+		order: list.New(),
+		ready: make(chan struct{}, 1),
+	}
+}
+
+// Add appends a SEND frame to the store, to be written by processLoop.
+func (s *inflightStore) Add(f *frame.Frame, cf *Confirm) error {
+	s.mutex.Lock()
+	if s.err != nil {
+		s.mutex.Unlock()
+		return s.err
+	}
+	e := s.order.PushBack(&inflightSend{frame: f, confirm: cf})
+	s.sends[cf.receipt] = e
+	if s.next == nil {
+		s.next = e
+	}
+	s.mutex.Unlock()
+
+	s.signal()
+	return nil
+}
+
+func (s *inflightStore) signal() {
+	select {
+	case s.ready <- struct{}{}:
+	default:
+		// already signalled
+	}
+}
+
+// Unsent returns the frames not yet written to the current connection,
+// and considers them written.
+func (s *inflightStore) Unsent() []*frame.Frame {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var frames []*frame.Frame
+	for ; s.next != nil; s.next = s.next.Next() {
+		frames = append(frames, s.next.Value.(*inflightSend).frame)
+	}
+	return frames
+}
+
+// Len returns the number of unconfirmed frames.
+func (s *inflightStore) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.order.Len()
+}
+
+// Resolve removes the frame with the receipt id from the store and
+// resolves its confirm with err. Returns false if there is no such frame.
+func (s *inflightStore) Resolve(receipt string, err error) bool {
+	s.mutex.Lock()
+	e, ok := s.sends[receipt]
+	if ok {
+		if e == s.next {
+			s.next = e.Next()
+		}
+		delete(s.sends, receipt)
+		s.order.Remove(e)
+	}
+	s.mutex.Unlock()
+
+	if ok {
+		e.Value.(*inflightSend).confirm.resolve(err)
+	}
+	return ok
+}
+
+// Rewind marks every unconfirmed frame as not written, so that they are
+// all written again, in order, once the connection has been re-established.
+func (s *inflightStore) Rewind() {
+	s.mutex.Lock()
+	s.next = s.order.Front()
+	s.mutex.Unlock()
+
+	s.signal()
+}
+
+// Fail resolves every unconfirmed frame with err, and makes any
+// later call to Add fail with the same error.
+func (s *inflightStore) Fail(err error) {
+	s.mutex.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	sends := s.order
+	s.sends = make(map[string]*list.Element)
+	s.order = list.New()
+	s.next = nil
+	s.mutex.Unlock()
+
+	for e := sends.Front(); e != nil; e = e.Next() {
+		e.Value.(*inflightSend).confirm.resolve(err)
+	}
+}
@@ -0,0 +1,41 @@
+package stomp
+
+import (
+	"errors"
+
+	"github.com/go-stomp/stomp/frame"
+	. "gopkg.in/check.v1"
+)
+
+func (s *StompSuite) TestInflightStore(c *C) {
+	store := newInflightStore()
+	var confirms []*Confirm
+	for _, id := range []string{"1", "2", "3"} {
+		cf := newConfirm(id)
+		confirms = append(confirms, cf)
+		c.Assert(store.Add(frame.New(frame.SEND, frame.Receipt, id), cf), IsNil)
+	}
+
+	c.Check(store.Unsent(), HasLen, 3)
+	c.Check(store.Unsent(), HasLen, 0)
+
+	c.Check(store.Resolve("2", nil), Equals, true)
+	c.Check(store.Resolve("2", nil), Equals, false)
+	c.Check(confirms[1].Err(), IsNil)
+	<-confirms[1].Done()
+	c.Check(store.Len(), Equals, 2)
+
+	// unconfirmed frames are written again in their original order
+	store.Rewind()
+	unsent := store.Unsent()
+	c.Assert(unsent, HasLen, 2)
+	c.Check(unsent[0].Header.Get(frame.Receipt), Equals, "1")
+	c.Check(unsent[1].Header.Get(frame.Receipt), Equals, "3")
+
+	err := errors.New("connection lost")
+	store.Fail(err)
+	c.Check(confirms[0].Err(), Equals, err)
+	c.Check(confirms[2].Err(), Equals, err)
+	c.Check(store.Len(), Equals, 0)
+	c.Check(store.Add(frame.New(frame.SEND), newConfirm("4")), Equals, err)
+}
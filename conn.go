@@ -1,11 +1,13 @@
 package stomp
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"io"
 	"net"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"math/rand"
@@ -32,19 +34,26 @@ var allConns = make([]*Conn, 0)
 // the Dial or Connect function.
 type Conn struct {
 	conn         io.ReadWriteCloser
-	readCh       chan *frame.Frame
 	writeCh      chan writeRequest
+	cancelCh     chan string   // receipt ids abandoned by their callers
+	done         chan struct{} // closed once the connection is closed for good
 	version      Version
 	session      string
 	server       string
 	readTimeout  time.Duration
 	writeTimeout time.Duration
+	stateMutex   sync.Mutex // guards the fields below, which change on reconnect
 	closed       bool
-	options      *connOptions
+	disconnected bool  // Disconnect or MustDisconnect has been called
+	readErr      error // why readLoop stopped reading
 	subs         []**subStr
+	connInfo     string
+	inflight     *inflightStore // SendAsync frames awaiting a RECEIPT
+	rpcMutex     sync.Mutex
+	rpc          *rpcClient // shared reply subscription for Request
+	options      *connOptions
 	rec          reconnectStr
 	id           int
-	connInfo     string
 	comment      string
 }
 
@@ -53,9 +62,9 @@ type subStr struct {
 }
 
 type reconnectStr struct {
-	network string
-	addr    string
-	op      [](func(*Conn) error)
+	endpoints    endpoints
+	hostFromAddr bool // host header is taken from the server address
+	op           [](func(*Conn) error)
 }
 
 type writeRequest struct {
@@ -67,55 +76,40 @@ type writeRequest struct {
 // the STOMP connect protocol sequence. The network endpoint of the
 // STOMP server is specified by network and addr. STOMP protocol
 // options can be specified in opts.
+//
+// Several STOMP servers can be specified with a failover URI in addr
+// (see FailoverPrefix), in which case network is ignored, or with
+// the ConnOpt.Failover option.
 func Dial(network, addr string, opts ...func(*Conn) error) (*Conn, error) {
+	return DialContext(context.Background(), network, addr, opts...)
+}
 
-	var cnet net.Conn
-
-	rand.Seed(time.Now().UnixNano())
-	var secToRecon = 10
-	var numOfRecon = 0
-
-	for {
-		log.Infof("Dial: connecting")
+// DialContext is like Dial, but the context bounds the whole operation:
+// the network dial, the sleeps between failed attempts and the STOMP
+// connect protocol sequence. If the context is cancelled or its deadline
+// expires before the connection is established, DialContext returns
+// ctx.Err().
+func DialContext(ctx context.Context, network, addr string, opts ...func(*Conn) error) (*Conn, error) {
+	list := []endpoint{{network: network, addr: addr}}
+	if strings.HasPrefix(addr, FailoverPrefix) {
+		var failoverOpt func(*Conn) error
 		var err error
-		cnet, err = net.Dial(network, addr)
-		if err == nil {
-			log.Infof("Dial: created a connection: %s", cnet.LocalAddr())
-			break
-		} else {
-			log.Errorf("Dial: connect error %s", err.Error())
-
-			if secToRecon < secReconLimit {
-				randomAdd := int(0.1*float64(secToRecon)) + 1
-				secToRecon = (secToRecon + rand.Intn(randomAdd)) * 2
-			}
-			log.Infof("Dial: sleep for %d seconds", secToRecon)
-			time.Sleep(time.Second * time.Duration(secToRecon))
-			numOfRecon++
-			continue
+		list, failoverOpt, err = parseFailoverURI(addr)
+		if err != nil {
+			return nil, err
 		}
+		// Make the URI parameters the first option in the list,
+		// so that explicitly specified options override them.
+		opts = append([](func(*Conn) error){failoverOpt}, opts...)
 	}
 
-	host, _, err := net.SplitHostPort(cnet.RemoteAddr().String())
-	if err != nil {
-		cnet.Close()
-		return nil, err
-	}
-
-	// Add option to set host and make it the first option in list,
-	// so that if host has been explicitly specified it will override.
-	opts = append([](func(*Conn) error){ConnOpt.Host(host)}, opts...)
-	id := len(allConns)
-
 	c := &Conn{
-		conn:     cnet,
-		connInfo: fmt.Sprintf("[%d][%s]", id, cnet.LocalAddr().String()),
-		readCh:   make(chan *frame.Frame, 8),
 		writeCh:  make(chan writeRequest, 8),
+		cancelCh: make(chan string, 8),
+		done:     make(chan struct{}),
 		id:       len(allConns),
 		rec: reconnectStr{
-			addr:    addr,
-			network: network,
+			op: opts,
 		},
 	}
 
@@ -123,24 +117,77 @@ func Dial(network, addr string, opts ...func(*Conn) error) (*Conn, error) {
 	if err != nil {
 		return nil, err
 	}
+	c.options = options
 
-	if options.Host == "" {
-		// host not specified yet, attempt to get from net.Conn if possible
-		if connection, ok := cnet.(net.Conn); ok {
-			host, _, err := net.SplitHostPort(connection.RemoteAddr().String())
-			if err == nil {
-				options.Host = host
-			}
+	for _, backup := range options.FailoverAddrs {
+		list = append(list, endpoint{network: network, addr: backup})
+	}
+	c.rec.endpoints.list = list
+	c.rec.endpoints.init(options.Randomize, options.PriorityBackup > 0)
+	c.rec.hostFromAddr = options.Host == ""
+
+	policy := options.Reconnect
+	if options.NoReconnect {
+		policy = noReconnectPolicy
+	}
+
+	var cnet net.Conn
+
+	rand.Seed(time.Now().UnixNano())
+	r := newRetry(policy)
+
+	for {
+		log.Infof("Dial: connecting")
+		cnet, err = c.dialEndpoints(ctx)
+		if err == nil {
+			log.Infof("Dial: created a connection: %s", cnet.LocalAddr())
+			break
 		}
-		// if host is still blank, use default
-		if options.Host == "" {
-			options.Host = "default"
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.Errorf("Dial: connect error %s", err.Error())
+
+		delay, ok := r.Failed()
+		c.emit(Event{Type: EventDialFailed, Err: err, Attempt: r.Attempts(), Delay: delay})
+		if !ok {
+			log.Errorf("Dial: giving up after %d attempts", r.Attempts())
+			c.emit(Event{Type: EventGaveUp, Err: err, Attempt: r.Attempts()})
+			return nil, err
+		}
+		log.Infof("Dial: sleep for %v", delay)
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
 		}
 	}
-	c.rec.op = opts
-	c.options = options
+
+	c.useConn(cnet)
+	if _, err := connect(ctx, c); err != nil {
+		cnet.Close()
+		return nil, err
+	}
 	allConns = append(allConns, c)
-	return Connect(c)
+	c.emit(Event{Type: EventConnected})
+	return c, nil
+}
+
+// useConn makes cnet the network connection to the STOMP server. Unless
+// the host header has been specified explicitly, it is set to the host
+// of the server's address, which changes when failing over.
+func (c *Conn) useConn(cnet net.Conn) {
+	c.stateMutex.Lock()
+	c.conn = cnet
+	c.connInfo = fmt.Sprintf("[%d][%s]", c.id, cnet.LocalAddr().String())
+	c.stateMutex.Unlock()
+
+	if c.rec.hostFromAddr {
+		host, _, err := net.SplitHostPort(cnet.RemoteAddr().String())
+		if err != nil || host == "" {
+			// no host in the address, use default
+			host = "default"
+		}
+		c.options.Host = host
+	}
 }
 
 // Connect creates a STOMP connection and performs the STOMP connect
@@ -148,20 +195,14 @@ func Dial(network, addr string, opts ...func(*Conn) error) (*Conn, error) {
 // been created by the program. The opts parameter provides the
 // opportunity to specify STOMP protocol options.
 func Connect(c *Conn) (*Conn, error) {
+	return connect(context.Background(), c)
+}
+
+func connect(ctx context.Context, c *Conn) (*Conn, error) {
 	reader := frame.NewReader(c.conn)
 	writer := frame.NewWriter(c.conn)
 
-	connectFrame, err := c.options.NewFrame()
-	if err != nil {
-		return nil, err
-	}
-
-	err = writer.Write(connectFrame)
-	if err != nil {
-		return nil, err
-	}
-
-	response, err := reader.Read()
+	response, err := exchangeConnect(ctx, c, reader, writer)
 	if err != nil {
 		return nil, err
 	}
@@ -170,23 +211,26 @@ func Connect(c *Conn) (*Conn, error) {
 		return nil, newError(response)
 	}
 
-	c.server = response.Header.Get(frame.Server)
-	c.session = response.Header.Get(frame.Session)
-
+	// no version in the response, so assume version 1.0
+	version := V10
 	if versionString := response.Header.Get(frame.Version); versionString != "" {
-		version := Version(versionString)
+		version = Version(versionString)
 		if err = version.CheckSupported(); err != nil {
 			return nil, Error{
 				Message: err.Error(),
 				Frame:   response,
 			}
 		}
-		c.version = version
-	} else {
-		// no version in the response, so assume version 1.0
-		c.version = V10
 	}
 
+	c.stateMutex.Lock()
+	c.server = response.Header.Get(frame.Server)
+	c.session = response.Header.Get(frame.Session)
+	c.version = version
+	c.closed = false
+	c.readErr = nil
+	c.stateMutex.Unlock()
+
 	if heartBeat, ok := response.Header.Contains(frame.HeartBeat); ok {
 		readTimeout, writeTimeout, err := frame.ParseHeartBeat(heartBeat)
 		if err != nil {
@@ -218,16 +262,88 @@ func Connect(c *Conn) (*Conn, error) {
 	// Neither options are particularly elegant, so wait until
 	// there is a real need for this.
 
-	go readLoop(c, reader)
-	go processLoop(c, writer)
+	if c.inflight == nil {
+		c.inflight = newInflightStore()
+	}
+
+	readCh := make(chan *frame.Frame, 8)
+	stopped := make(chan struct{})
+	failback := make(chan struct{})
+	go readLoop(c, reader, readCh)
+	go processLoop(c, writer, readCh, stopped, failback)
+	c.startWatchPrimary(stopped, failback)
 
 	return c, nil
 }
 
+// exchangeConnect writes the CONNECT frame and reads the server's
+// response. If the underlying connection is a net.Conn, cancelling
+// ctx aborts the exchange by expiring the connection deadline.
+func exchangeConnect(ctx context.Context, c *Conn, reader *frame.Reader, writer *frame.Writer) (*frame.Frame, error) {
+	if cnet, ok := c.conn.(net.Conn); ok && ctx.Done() != nil {
+		if deadline, ok := ctx.Deadline(); ok {
+			cnet.SetDeadline(deadline)
+		}
+		done := make(chan struct{})
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			select {
+			case <-ctx.Done():
+				// unblock any pending read or write
+				cnet.SetDeadline(time.Unix(1, 0))
+			case <-done:
+			}
+		}()
+		defer func() {
+			close(done)
+			<-stopped
+			cnet.SetDeadline(time.Time{})
+		}()
+	}
+
+	connectFrame, err := c.options.NewFrame()
+	if err != nil {
+		return nil, err
+	}
+
+	err = writer.Write(connectFrame)
+	if err == nil {
+		var response *frame.Frame
+		response, err = reader.Read()
+		if err == nil {
+			return response, nil
+		}
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		// the connection deadline can expire before ctx is done
+		return nil, context.DeadlineExceeded
+	}
+	return nil, err
+}
+
+// sleepContext pauses the current goroutine for the duration d,
+// or until ctx is done, whichever happens first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // Version returns the version of the STOMP protocol that
 // is being used to communicate with the STOMP server. This
 // version is negotiated with the server during the connect sequence.
 func (c *Conn) Version() Version {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
 	return c.version
 }
 
@@ -236,6 +352,8 @@ func (c *Conn) Version() Version {
 // If the STOMP server does not return a session header entry,
 // this value will be a blank string.
 func (c *Conn) Session() string {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
 	return c.session
 }
 
@@ -244,48 +362,74 @@ func (c *Conn) Session() string {
 // If the STOMP server does not return a server header entry,
 // this value will be a blank string.
 func (c *Conn) Server() string {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
 	return c.server
 }
 
 //GetConnInfo returns address,
 func (c *Conn) GetConnInfo() string {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
 	return c.connInfo
 }
 
+// isClosed reports whether the connection to the STOMP
+// server is unusable, either lost or closed by the program.
+func (c *Conn) isClosed() bool {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+	return c.closed
+}
+
+// shutdown closes the done channel, once the connection is closed
+// for good and will not be re-established.
+func (c *Conn) shutdown() {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+	}
+}
+
 // readLoop is a goroutine that reads frames from the
 // reader and places them onto a channel for processing
-// by the processLoop goroutine
-func readLoop(c *Conn, reader *frame.Reader) {
+// by the processLoop goroutine. The channel is closed
+// once the connection can no longer be read.
+func readLoop(c *Conn, reader *frame.Reader, readCh chan<- *frame.Frame) {
 	for {
 		f, err := reader.Read()
 		if err != nil {
-			//log.Debugf("f, err := reader.Read(): %s", err.Error())
-			if c.closed == false {
-				close(c.readCh)
+			c.stateMutex.Lock()
+			if !c.closed {
+				c.readErr = err
 			}
-			//log.Debug("readLoop: c.closed = true")
 			c.closed = true
-
+			c.stateMutex.Unlock()
+			close(readCh)
 			return
 		}
-		c.readCh <- f
+		readCh <- f
 	}
 }
 
-func writeHeartbeat(writer *frame.Writer, channels map[string]chan *frame.Frame) error {
+func writeHeartbeat(writer *frame.Writer) error {
 	//log.Debugf("sending heart-beat")
 	err := writer.Write(nil)
 	if err != nil {
 		log.Errorf("writeHeartbeat: Write error %s", err)
-		sendError(channels, err)
 		return err
 	}
 	return nil
 }
 
-// processLoop is a goroutine that handles io with
-// the server.
-func processLoop(c *Conn, writer *frame.Writer) {
+// processLoop is a goroutine that handles io with the server.
+// It reads frames from readCh until the connection is lost,
+// and then re-establishes it (see connectionLost). The stopped
+// channel is closed as soon as processLoop stops using the connection.
+func processLoop(c *Conn, writer *frame.Writer, readCh <-chan *frame.Frame, stopped chan struct{}, failback <-chan struct{}) {
 	channels := make(map[string]chan *frame.Frame)
 
 	var readTimeoutChannel <-chan time.Time
@@ -319,51 +463,41 @@ func processLoop(c *Conn, writer *frame.Writer) {
 		select {
 		case <-readTimeoutChannel:
 			// read timeout, close the connection
-			log.Errorf("read timeout %s", c.connInfo)
+			log.Errorf("read timeout %s", c.GetConnInfo())
 			err := newErrorMessage("read timeout")
-			sendError(channels, err)
+			c.connectionLost(channels, readCh, stopped, err, nil)
 			return
 
 		case <-writeTimeoutChannel:
 			// write timeout, send a heart-beat frame
 			//log.Debugf("writeTimeoutChannel 1 %s", c.connInfo)
-			err := writeHeartbeat(writer, channels)
+			err := writeHeartbeat(writer)
 			if err != nil {
+				c.connectionLost(channels, readCh, stopped, err, nil)
 				return
 			}
 			writeTimer = nil
 			writeTimeoutChannel = nil
 
-		case f, ok := <-c.readCh:
+		case <-failback:
+			// the primary server is available again
+			log.Infof("leaving backup %s", c.GetConnInfo())
+			err := newErrorMessage("moving back to the primary server")
+			c.connectionLost(channels, readCh, stopped, err, nil)
+			return
+
+		case f, ok := <-readCh:
 
 			if !ok {
-				log.Errorf("error read %s", c.connInfo)
+				log.Errorf("error read %s", c.GetConnInfo())
 				err := newErrorMessage("connection closed")
-				c.closed = true
-				sendError(channels, err)
-
-				var secToRecon = 15
-				var numOfRecon = 0
-				rand.Seed(time.Now().UnixNano())
-
-				for {
-					err := c.reconnect()
-					if err == nil {
-						return
-					}
-					log.Errorf("Reconnect error %s", err.Error())
-
-					if secToRecon < secReconLimit {
-						randomAdd := int(0.1*float64(secToRecon)) + 1
-						secToRecon = (secToRecon + rand.Intn(randomAdd)) * 2
-					}
-					log.Infof("Reconnecting: Retry: %d sleep for %d seconds", numOfRecon, secToRecon)
-					time.Sleep(time.Second * time.Duration(secToRecon))
-					numOfRecon++
-
-					writeTimer = nil
-					writeTimeoutChannel = nil
+				c.stateMutex.Lock()
+				if c.readErr != nil {
+					err = newErrorMessage(c.readErr.Error())
 				}
+				c.stateMutex.Unlock()
+				c.connectionLost(channels, readCh, stopped, err, nil)
+				return
 			}
 
 			//log.Debugf("readCh %s %v ", c.connInfo, f)
@@ -380,45 +514,70 @@ func processLoop(c *Conn, writer *frame.Writer) {
 				continue
 			}
 
+			// frame passed on to the program, which is an ERROR
+			// frame if an interceptor rejects the frame received
+			response := f
+			rejected := c.interceptInbound(f)
+			if rejected != nil {
+				response = rejectedFrame(f, rejected)
+			}
+
 			switch f.Command {
 			case frame.RECEIPT:
 				if id, ok := f.Header.Contains(frame.ReceiptId); ok {
+					if c.inflight.Resolve(id, rejected) {
+						continue
+					}
 					if ch, ok := channels[id]; ok {
-						ch <- f
+						ch <- response
 						delete(channels, id)
 						close(ch)
 					}
 				} else {
 					err := &Error{Message: "missing receipt-id", Frame: f}
-					sendError(channels, err)
+					c.connectionLost(channels, readCh, stopped, err, nil)
 					return
 				}
 
 			case frame.ERROR:
 				log.Error("received ERROR; Closing underlying connection")
-				for _, ch := range channels {
-					ch <- f
-					close(ch)
+				if id, ok := f.Header.Contains(frame.ReceiptId); ok {
+					c.inflight.Resolve(id, newError(f))
 				}
-
-				//log.Warn("readCh frame.ERROR: c.closed = true")
-
-				c.closed = true
-				c.conn.Close()
-
+				// the server closes the connection after an ERROR
+				// frame, which is not re-established
+				c.connectionLost(channels, readCh, stopped, newError(f), f)
 				return
 
 			case frame.MESSAGE:
 				if id, ok := f.Header.Contains(frame.Subscription); ok {
 					if ch, ok := channels[id]; ok {
-						ch <- f
+						ch <- response
 					} else {
 						log.Errorf("ignored MESSAGE for subscription %s", id)
 					}
 				}
 			}
 
-		case req, ok := <-c.writeCh:
+		case id := <-c.cancelCh:
+			// the caller has stopped waiting for this receipt
+			delete(channels, id)
+
+		case <-c.inflight.ready:
+			// frames from SendAsync, in the order they were sent
+			for _, f := range c.inflight.Unsent() {
+				if err := writer.Write(f); err != nil {
+					c.connectionLost(channels, readCh, stopped, err, nil)
+					return
+				}
+			}
+			if writeTimer != nil {
+				writeTimer.Stop()
+				writeTimer = nil
+				writeTimeoutChannel = nil
+			}
+
+		case req := <-c.writeCh:
 			//log.Debugf("writeCh %s %v", c.connInfo, req)
 			// stop the write timeout
 			if writeTimer != nil {
@@ -426,12 +585,6 @@ func processLoop(c *Conn, writer *frame.Writer) {
 				writeTimer = nil
 				writeTimeoutChannel = nil
 			}
-			if !ok {
-				//log.Warn("writeCh(): !ok")
-				sendError(channels, errors.New("write channel closed"))
-				c.closed = true
-				return
-			}
 			if req.C != nil {
 				//log.Warn("req.C != nil")
 				if receipt, ok := req.Frame.Header.Contains(frame.Receipt); ok {
@@ -460,18 +613,74 @@ func processLoop(c *Conn, writer *frame.Writer) {
 			err := writer.Write(req.Frame)
 			if err != nil {
 				//	log.Debug("err := writer.Write(req.Frame); err != nil")
-				sendError(channels, err)
+				c.connectionLost(channels, readCh, stopped, err, nil)
 				return
 			}
 		}
 	}
 }
 
-// Send an error to all receipt channels.
-func sendError(m map[string]chan *frame.Frame, err error) {
-	frame := frame.New(frame.ERROR, frame.Message, err.Error())
-	for _, ch := range m {
-		ch <- frame
+// connectionLost is called by processLoop once the connection to the
+// server can no longer be used because of err. The network connection
+// is closed, and an ERROR frame is sent to all receipt and subscription
+// channels: f if the server sent one, in which case the connection is not
+// re-established. Nor is it if the program has disconnected or reconnecting
+// has been disabled; the connection is then closed for good, and the
+// channels are closed.
+func (c *Conn) connectionLost(channels map[string]chan *frame.Frame, readCh <-chan *frame.Frame, stopped chan struct{}, err error, f *frame.Frame) {
+	close(stopped)
+
+	c.stateMutex.Lock()
+	c.closed = true
+	disconnected := c.disconnected
+	conn := c.conn
+	c.stateMutex.Unlock()
+
+	// Wait for readLoop to stop, so that it cannot
+	// change the state of a re-established connection.
+	conn.Close()
+	for range readCh {
+	}
+
+	retry := f == nil && !c.options.NoReconnect
+	if f == nil {
+		f = frame.New(frame.ERROR, frame.Message, err.Error())
+	}
+	for _, ch := range channels {
+		ch <- f
+	}
+
+	if disconnected {
+		// closed by the program, not lost
+		c.inflight.Fail(ErrAlreadyClosed)
+		c.closeChannels(channels)
+		return
+	}
+	c.emit(Event{Type: EventDisconnected, Err: err})
+
+	if retry {
+		// unconfirmed frames are sent again on the new connection
+		c.inflight.Rewind()
+		if c.reconnectLoop() == nil {
+			return
+		}
+	}
+	c.inflight.Fail(err)
+	c.closeChannels(channels)
+}
+
+// closeChannels closes all receipt and subscription channels, once the
+// connection is closed for good. This also closes the C channel of every
+// subscription, once the messages already received have been delivered.
+func (c *Conn) closeChannels(channels map[string]chan *frame.Frame) {
+	c.shutdown()
+	closed := make(map[chan *frame.Frame]bool)
+	for id, ch := range channels {
+		if !closed[ch] {
+			close(ch)
+			closed[ch] = true
+		}
+		delete(channels, id)
 	}
 }
 
@@ -482,39 +691,77 @@ func sendError(m map[string]chan *frame.Frame, err error) {
 // with the STOMP server is closed and any further attempt to write
 // to the server will fail.
 func (c *Conn) Disconnect() error {
-	if c.closed {
+	return c.DisconnectContext(context.Background())
+}
+
+// DisconnectContext is like Disconnect, but gives up waiting for the
+// server's RECEIPT when ctx is done and returns ctx.Err(). In that case
+// the connection is left open, and the program can call MustDisconnect
+// to close it.
+func (c *Conn) DisconnectContext(ctx context.Context) error {
+	c.stateMutex.Lock()
+	if c.disconnected {
+		c.stateMutex.Unlock()
 		return nil
 	}
-
-	ch := make(chan *frame.Frame)
-	c.writeCh <- writeRequest{
-		Frame: frame.New(frame.DISCONNECT, frame.Receipt, allocateId()),
-		C:     ch,
+	// the server closes the connection after the RECEIPT,
+	// which must not be taken for a lost connection
+	c.disconnected = true
+	closed := c.closed
+	c.stateMutex.Unlock()
+
+	if closed {
+		// lost, so stop any attempt to re-establish it
+		c.shutdown()
+		c.emit(Event{Type: EventClosed})
+		return nil
 	}
 
-	response := <-ch
-	if response.Command != frame.RECEIPT {
-		return newError(response)
+	f := frame.New(frame.DISCONNECT, frame.Receipt, allocateId())
+	if err := c.sendFrameContext(ctx, f); err != nil {
+		c.stateMutex.Lock()
+		c.disconnected = false
+		c.stateMutex.Unlock()
+		return err
 	}
 
+	c.stateMutex.Lock()
 	c.closed = true
-	return c.conn.Close()
+	conn := c.conn
+	c.stateMutex.Unlock()
+	c.shutdown()
+
+	// The server may already have closed the connection, and
+	// processLoop closed it in turn, so the error is of no interest.
+	conn.Close()
+	c.emit(Event{Type: EventClosed})
+	return nil
 }
 
 // MustDisconnect will disconnect 'ungracefully' from the STOMP server.
 // This method should be used only as last resort when there are fatal
 // network errors that prevent to do a proper disconnect from the server.
 func (c *Conn) MustDisconnect() error {
-	if c.closed {
+	c.stateMutex.Lock()
+	if c.disconnected {
+		c.stateMutex.Unlock()
 		return nil
 	}
-
-	// just close readCh and writeCh
-	// close(c.readCh)
-	close(c.writeCh)
-
+	c.disconnected = true
+	closed := c.closed
 	c.closed = true
-	return c.conn.Close()
+	conn := c.conn
+	c.stateMutex.Unlock()
+	c.shutdown()
+
+	if closed {
+		// lost, and processLoop has closed the connection
+		c.emit(Event{Type: EventClosed})
+		return nil
+	}
+	err := conn.Close()
+	c.emit(Event{Type: EventClosed})
+	return err
 }
 
 // Send sends a message to the STOMP server, which in turn sends the message to the specified destination.
@@ -527,39 +774,35 @@ func (c *Conn) MustDisconnect() error {
 // Any number of options can be specified in opts. See the examples for usage. Options include whether
 // to receive a RECEIPT, should the content-length be suppressed, and sending custom header entries.
 func (c *Conn) Send(destination, contentType string, body []byte, opts ...func(*frame.Frame) error) error {
-	if c.closed {
-		return ErrAlreadyClosed
-		//fmt.Println("Send: recconnect...")
+	return c.SendContext(context.Background(), destination, contentType, body, opts...)
+}
 
+// SendContext is like Send, but returns ctx.Err() if ctx is done before
+// the frame has been handed to the connection or, when a receipt has been
+// requested, before the RECEIPT frame arrives. A message abandoned while
+// waiting for its receipt may still be delivered by the server.
+func (c *Conn) SendContext(ctx context.Context, destination, contentType string, body []byte, opts ...func(*frame.Frame) error) error {
+	if c.options.ReliableSend {
+		cf, err := c.sendAsync(ctx, destination, contentType, body, opts)
+		if err != nil {
+			return err
+		}
+		return cf.Wait(ctx)
 	}
 
-	f, err := createSendFrame(destination, contentType, body, opts)
-	if err != nil {
-		return err
+	if c.isClosed() {
+		return ErrAlreadyClosed
 	}
 
-	if _, ok := f.Header.Contains(frame.Receipt); ok {
-		// receipt required
-		request := writeRequest{
-			Frame: f,
-			C:     make(chan *frame.Frame),
-		}
-
-		c.writeCh <- request
-		response := <-request.C
-		if response.Command != frame.RECEIPT {
-			return newError(response)
-		}
-	} else {
-		// no receipt required
-		request := writeRequest{Frame: f}
-		c.writeCh <- request
+	f, err := c.createSendFrame(ctx, destination, contentType, body, opts)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return c.sendFrameContext(ctx, f)
 }
 
-func createSendFrame(destination, contentType string, body []byte, opts []func(*frame.Frame) error) (*frame.Frame, error) {
+func (c *Conn) createSendFrame(ctx context.Context, destination, contentType string, body []byte, opts []func(*frame.Frame) error) (*frame.Frame, error) {
 	// Set the content-length before the options, because this provides
 	// an opportunity to remove content-length.
 	f := frame.New(frame.SEND, frame.ContentLength, strconv.Itoa(len(body)))
@@ -580,40 +823,114 @@ func createSendFrame(destination, contentType string, body []byte, opts []func(*
 		f.Header.Set(frame.ContentType, contentType)
 	}
 
+	c.injectTrace(ctx, f)
+
+	if err := c.compressFrame(f); err != nil {
+		return nil, err
+	}
+
 	return f, nil
 }
 
 func (c *Conn) sendFrame(f *frame.Frame) error {
-	if _, ok := f.Header.Contains(frame.Receipt); ok {
-		// receipt required
-		request := writeRequest{
-			Frame: f,
-			C:     make(chan *frame.Frame),
-		}
+	return c.sendFrameContext(context.Background(), f)
+}
 
-		c.writeCh <- request
-		response, ok := <-request.C
-		if ok {
-			if response.Command != frame.RECEIPT {
-				return newError(response)
-			}
-		} else {
-			return ErrClosedUnexpectedly
-		}
-	} else {
+func (c *Conn) sendFrameContext(ctx context.Context, f *frame.Frame) error {
+	if err := c.interceptOutbound(f); err != nil {
+		return err
+	}
+
+	receipt, ok := f.Header.Contains(frame.Receipt)
+	if !ok {
 		// no receipt required
-		request := writeRequest{Frame: f}
-		c.writeCh <- request
+		return c.writeContext(ctx, writeRequest{Frame: f})
 	}
 
+	// Receipt required. The response channel is buffered so that
+	// processLoop never blocks on a caller that has given up waiting.
+	request := writeRequest{
+		Frame: f,
+		C:     make(chan *frame.Frame, 1),
+	}
+	if err := c.writeContext(ctx, request); err != nil {
+		return err
+	}
+
+	select {
+	case response, ok := <-request.C:
+		return receiptError(response, ok)
+	case <-ctx.Done():
+		c.cancelReceipt(receipt)
+		return ctx.Err()
+	case <-c.done:
+		// processLoop stopped before handling the request
+		return closedReceiptError(request)
+	}
+}
+
+// closedReceiptError returns the error of a request once processLoop has
+// stopped for good: its response if it arrived, or ErrAlreadyClosed if the
+// request was still waiting to be written.
+func closedReceiptError(request writeRequest) error {
+	select {
+	case response, ok := <-request.C:
+		return receiptError(response, ok)
+	default:
+		return ErrAlreadyClosed
+	}
+}
+
+// receiptError converts the response received on a receipt
+// channel into the error returned to the caller.
+func receiptError(response *frame.Frame, ok bool) error {
+	if !ok {
+		return ErrClosedUnexpectedly
+	}
+	if response.Command != frame.RECEIPT {
+		return newError(response)
+	}
 	return nil
 }
 
+// writeContext places a request on the write channel, unless
+// ctx is done before processLoop is ready to accept it.
+func (c *Conn) writeContext(ctx context.Context, request writeRequest) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case c.writeCh <- request:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.done:
+		return ErrAlreadyClosed
+	}
+}
+
+// cancelReceipt asks processLoop to forget the response channel
+// for a receipt that nobody is waiting for any more.
+func (c *Conn) cancelReceipt(id string) {
+	select {
+	case c.cancelCh <- id:
+	default:
+		// processLoop is busy; the entry is removed anyway
+		// if the RECEIPT arrives, or the connection closes
+	}
+}
+
 // Subscribe creates a subscription on the STOMP server.
 // The subscription has a destination, and messages sent to that destination
 // will be received by this subscription. A subscription has a channel
 // on which the calling program can receive messages.
 func (c *Conn) Subscribe(destination string, ack AckMode, opts ...func(*frame.Frame) error) (*Subscription, error) {
+	return c.SubscribeContext(context.Background(), destination, ack, opts...)
+}
+
+// SubscribeContext is like Subscribe, but returns ctx.Err() if ctx is
+// done before the SUBSCRIBE frame has been handed to the connection.
+func (c *Conn) SubscribeContext(ctx context.Context, destination string, ack AckMode, opts ...func(*frame.Frame) error) (*Subscription, error) {
 	frameCh := make(chan *frame.Frame)
 	controlCh := make(chan func())
 
@@ -633,6 +950,11 @@ func (c *Conn) Subscribe(destination string, ack AckMode, opts ...func(*frame.Fr
 		}
 	}
 
+	prefetch, overflow, err := flowControl(subscribeFrame)
+	if err != nil {
+		return nil, err
+	}
+
 	// If the option functions have not specified the "id" header entry,
 	// create one.
 	id, ok := subscribeFrame.Header.Contains(frame.Id)
@@ -641,6 +963,11 @@ func (c *Conn) Subscribe(destination string, ack AckMode, opts ...func(*frame.Fr
 		subscribeFrame.Header.Add(frame.Id, id)
 	}
 
+	// a rejected frame leaves no subscription behind
+	if err := c.interceptOutbound(subscribeFrame); err != nil {
+		return nil, err
+	}
+
 	request := writeRequest{
 		Frame: subscribeFrame,
 		C:     frameCh,
@@ -654,15 +981,23 @@ func (c *Conn) Subscribe(destination string, ack AckMode, opts ...func(*frame.Fr
 			ackMode:        ack,
 			C:              make(chan *Message, 16),
 			opts:           opts,
+			header:         subscribeFrame.Header.Clone(),
+			prefetch:       prefetch,
+			overflow:       overflow,
 			controlChannel: controlCh,
 			frameCh:        frameCh,
 		},
 	}
 
+	if err := c.writeContext(ctx, request); err != nil {
+		return nil, err
+	}
+
+	c.stateMutex.Lock()
 	c.subs = append(c.subs, &sub)
+	c.stateMutex.Unlock()
 
 	go sub.subPtr.readLoop(frameCh)
-	c.writeCh <- request
 
 	return sub.subPtr, nil
 }
@@ -709,7 +1044,7 @@ func (c *Conn) Begin() *Transaction {
 
 // Create an ACK or NACK frame. Complicated by version incompatibilities.
 func (c *Conn) createAckNackFrame(msg *Message, ack bool) (*frame.Frame, error) {
-	if !ack && !c.version.SupportsNack() {
+	if !ack && !c.Version().SupportsNack() {
 		return nil, ErrNackNotSupported
 	}
 
@@ -735,7 +1070,7 @@ func (c *Conn) createAckNackFrame(msg *Message, ack bool) (*frame.Frame, error)
 		f = frame.New(frame.NACK)
 	}
 
-	switch c.version {
+	switch c.Version() {
 	case V10, V11:
 		f.Header.Add(frame.Subscription, msg.Subscription.Id())
 		if messageId, ok := msg.Header.Contains(frame.MessageId); ok {
@@ -754,63 +1089,73 @@ func (c *Conn) createAckNackFrame(msg *Message, ack bool) (*frame.Frame, error)
 	return f, nil
 }
 
-// Reconnect is a function for reconnecting
-func (c *Conn) reconnect() error {
-	log.Errorf("Trying to reconnect")
+// reconnectLoop re-establishes a lost connection, retrying according
+// to the reconnect policy. Returns the last error if the policy gives up,
+// or ErrAlreadyClosed if the program disconnects in the meantime.
+func (c *Conn) reconnectLoop() error {
+	rand.Seed(time.Now().UnixNano())
+	r := newRetry(c.options.Reconnect)
+	c.rec.endpoints.failedOver(c.options.PriorityBackup > 0)
 
-	var err error
-	var i = 0
-	var cnet net.Conn
+	for {
+		err := c.reconnect()
+		if err == nil || err == ErrAlreadyClosed {
+			return err
+		}
+		log.Errorf("Reconnect error %s", err.Error())
 
-	//log.Debugf("(len(allConns)=%d", len(allConns))
+		delay, ok := r.Failed()
+		if !ok {
+			log.Errorf("Reconnecting: giving up after %d attempts", r.Attempts())
+			c.emit(Event{Type: EventGaveUp, Err: err, Attempt: r.Attempts()})
+			return err
+		}
+		c.emit(Event{Type: EventReconnecting, Err: err, Attempt: r.Attempts(), Delay: delay})
+		log.Infof("Reconnecting: Retry: %d sleep for %v", r.Attempts(), delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-c.done:
+			timer.Stop()
+			return ErrAlreadyClosed
+		}
+	}
+}
 
-	i++
+// Reconnect is a function for reconnecting
+func (c *Conn) reconnect() error {
+	log.Errorf("Trying to reconnect")
 
-	if c.closed != true {
-		//log.Warn("currConn.closed != true")
-		c.conn.Close()
-	}
-	cnet, err = net.Dial(c.rec.network, c.rec.addr)
+	cnet, err := c.dialEndpoints(context.Background())
 	if err != nil {
-		//return nil, err
 		//log.Errorf("reconnect(): Dial err - %s", err.Error())
 		return err
 	}
+	c.useConn(cnet)
 
-	c.readCh = make(chan *frame.Frame, 8)
-	c.writeCh = make(chan writeRequest, 8)
-	c.conn = cnet
-	c.connInfo = fmt.Sprintf("[%d][%s]", c.id, cnet.LocalAddr().String())
-
-	c, err = Connect(c)
-	//log.Debug("recon(): c.closed = false")
-	c.closed = false
+	_, err = connect(context.Background(), c)
 	if err != nil {
 		//log.Errorf("reconnect(): connect err - %s", err.Error())
+		cnet.Close()
 		return err
 	}
 
-	//log.Debug("connection done")
-
-	//log.Debugf("(len(currConn.subs)=%d", len(currConn.subs))
-
-	for _, currSub := range c.subs {
-
-		subscribeFrame := frame.New(frame.SUBSCRIBE,
-			frame.Destination, (*currSub).subPtr.destination,
-			frame.Ack, ((*currSub).subPtr.ackMode).String())
-
-		subscribeFrame.Header.Add(frame.Id, (*currSub).subPtr.id)
-
-		request := writeRequest{
-			Frame: subscribeFrame,
-			C:     (*currSub).subPtr.frameCh,
-		}
-		c.writeCh <- request
+	c.stateMutex.Lock()
+	disconnected := c.disconnected
+	subs := c.subs
+	c.stateMutex.Unlock()
+	if disconnected {
+		// Disconnect or MustDisconnect called while reconnecting;
+		// the new processLoop closes the connection for good
+		cnet.Close()
+		return ErrAlreadyClosed
+	}
+	c.emit(Event{Type: EventReconnected})
 
-		(*currSub).subPtr.controlChannel <- func() {
-			(*currSub).subPtr.completed = false
-			(*currSub).subPtr.conn = c
+	for _, currSub := range subs {
+		sub := (*currSub).subPtr
+		if sub.resubscribe() {
+			c.emit(Event{Type: EventResubscribed, Subscription: sub})
 		}
 	}
 	log.Debug("Reconnected")
@@ -1,7 +1,10 @@
 package stomp
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"strings"
 	"time"
 
@@ -19,14 +22,34 @@ type connOptions struct {
 	Login, Passcode string
 	AcceptVersions  []string
 	Header          *frame.Header
+	Reconnect       ReconnectPolicy
+	NoReconnect     bool
+	EventCallbacks  []func(Event)
+	FailoverAddrs   []string
+	Randomize       bool
+	PriorityBackup  time.Duration
+	TLSConfig       *tls.Config
+	Dialer          func(ctx context.Context, network, addr string) (net.Conn, error)
+	ReliableSend    bool
+	ReplyTo         string
+	ContentType     string
+	Compress        string
+	CompressMinSize int
+	MaxDecompressed int
+	Interceptors    []Interceptor
+	Propagator      Propagator
 }
 
 func newConnOptions(conn *Conn, opts []func(*Conn) error) (*connOptions, error) {
 	co := &connOptions{
-		FrameCommand:   frame.CONNECT,
-		ReadTimeout:    time.Minute,
-		WriteTimeout:   time.Minute,
-		HeartBeatError: DefaultHeartBeatError,
+		FrameCommand:    frame.CONNECT,
+		ReadTimeout:     time.Minute,
+		WriteTimeout:    time.Minute,
+		HeartBeatError:  DefaultHeartBeatError,
+		Reconnect:       DefaultReconnectPolicy,
+		ContentType:     ContentTypeJSON,
+		MaxDecompressed: DefaultMaxDecompressedSize,
+		Propagator:      TraceContext{},
 	}
 
 	// This is a slight of hand, attach the options to the Conn long
@@ -128,6 +151,93 @@ var ConnOpt struct {
 	// header entry in the STOMP frame. This connect option can be specified
 	// multiple times for multiple custom headers.
 	Header func(key, value string) func(*Conn) error
+
+	// Reconnect is a connect option that specifies how often and for how
+	// long the client attempts to connect to the STOMP server, both when
+	// dialing and after the connection has been lost. If not specified,
+	// DefaultReconnectPolicy is used, which retries forever.
+	Reconnect func(policy ReconnectPolicy) func(*Conn) error
+
+	// NoReconnect is a connect option that specifies that the client
+	// should make a single attempt to dial the STOMP server, and should
+	// not attempt to re-establish the connection once it has been lost.
+	NoReconnect func(*Conn) error
+
+	// OnEvent is a connect option that registers a callback function,
+	// which is called for each connection lifecycle event: a failed dial,
+	// a lost connection, each attempt to reconnect, a successful reconnect,
+	// each re-created subscription and the closing of the connection by
+	// Disconnect or MustDisconnect. The callback is called on the
+	// goroutine that handles the connection, so it should return quickly.
+	// This connect option can be specified multiple times.
+	OnEvent func(callback func(Event)) func(*Conn) error
+
+	// Failover is a connect option that specifies the addresses of backup
+	// STOMP servers, which use the same network as the address passed to Dial.
+	// The client tries the servers in order, starting with the address passed
+	// to Dial, both when dialing and when reconnecting.
+	Failover func(addrs ...string) func(*Conn) error
+
+	// PriorityBackup is a connect option that makes the client prefer the
+	// first STOMP server. While connected to a backup server, the client
+	// checks at the specified interval whether the first server is available
+	// again, and if so moves the connection back to it.
+	PriorityBackup func(interval time.Duration) func(*Conn) error
+
+	// TLS is a connect option that specifies that the client should connect
+	// to the STOMP server using TLS, both when dialing and when reconnecting.
+	// Client certificates for mutual TLS are specified in config.Certificates.
+	// If config.ServerName is empty, the server certificate is verified against
+	// the host header if it has been specified, or else the host of the server's
+	// address, and the same name is sent to the server for SNI.
+	TLS func(config *tls.Config) func(*Conn) error
+
+	// Dialer is a connect option that specifies the function used to create
+	// network connections to the STOMP server, both when dialing and when
+	// reconnecting. If the TLS option is also specified, the TLS handshake
+	// is performed over the connection returned by dial.
+	Dialer func(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(*Conn) error
+
+	// ReliableSend is a connect option that makes Send and SendContext
+	// behave like SendAsync followed by waiting for the confirm: every
+	// message is sent with a receipt, and messages that have not been
+	// confirmed when the connection is lost are sent again once it has
+	// been re-established. Messages sent in a transaction are not affected.
+	ReliableSend func(*Conn) error
+
+	// ReplyTo is a connect option that specifies the destination on which
+	// Conn.Request receives replies. By default it is a destination with
+	// the DefaultReplyPrefix prefix, private to the connection.
+	ReplyTo func(destination string) func(*Conn) error
+
+	// ContentType is a connect option that specifies the content type
+	// used by Conn.SendValue to encode values. The default is ContentTypeJSON.
+	ContentType func(contentType string) func(*Conn) error
+
+	// Compress is a connect option that compresses the body of every
+	// message sent on the connection with the named algorithm, such as
+	// EncodingGzip, unless the body is smaller than minSize bytes or
+	// has been compressed with SendOpt.Compress.
+	Compress func(encoding string, minSize int) func(*Conn) error
+
+	// MaxDecompressedSize is a connect option that specifies the maximum
+	// size of a message body once decompressed. The Err of a message whose
+	// body decompresses to more is ErrDecompressedTooLarge, and its Body
+	// is left compressed. The default is DefaultMaxDecompressedSize.
+	MaxDecompressedSize func(size int) func(*Conn) error
+
+	// Interceptors is a connect option that adds interceptors, which see
+	// each frame written to and received from the STOMP server. Outbound
+	// frames pass through the interceptors in the order specified, and
+	// inbound frames in the reverse order. This connect option can be
+	// specified multiple times, and the interceptors are appended.
+	Interceptors func(interceptors ...Interceptor) func(*Conn) error
+
+	// Propagator is a connect option that specifies how trace context is
+	// added to messages sent with a context, such as with SendContext, and
+	// extracted from messages received. The default is TraceContext. A nil
+	// propagator disables trace context propagation.
+	Propagator func(p Propagator) func(*Conn) error
 }
 
 func init() {
@@ -188,4 +298,132 @@ func init() {
 			return nil
 		}
 	}
+
+	ConnOpt.Reconnect = func(policy ReconnectPolicy) func(*Conn) error {
+		return func(c *Conn) error {
+			if err := policy.validate(); err != nil {
+				return err
+			}
+			c.options.Reconnect = policy
+			c.options.NoReconnect = false
+			return nil
+		}
+	}
+
+	ConnOpt.NoReconnect = func(c *Conn) error {
+		c.options.NoReconnect = true
+		return nil
+	}
+
+	ConnOpt.Failover = func(addrs ...string) func(*Conn) error {
+		return func(c *Conn) error {
+			c.options.FailoverAddrs = append(c.options.FailoverAddrs, addrs...)
+			return nil
+		}
+	}
+
+	ConnOpt.PriorityBackup = func(interval time.Duration) func(*Conn) error {
+		return func(c *Conn) error {
+			if interval <= 0 {
+				return ErrInvalidPriorityBackup
+			}
+			c.options.PriorityBackup = interval
+			return nil
+		}
+	}
+
+	ConnOpt.TLS = func(config *tls.Config) func(*Conn) error {
+		return func(c *Conn) error {
+			if config == nil {
+				return ErrNilOption
+			}
+			c.options.TLSConfig = config
+			return nil
+		}
+	}
+
+	ConnOpt.Dialer = func(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(*Conn) error {
+		return func(c *Conn) error {
+			if dial == nil {
+				return ErrNilOption
+			}
+			c.options.Dialer = dial
+			return nil
+		}
+	}
+
+	ConnOpt.ReliableSend = func(c *Conn) error {
+		c.options.ReliableSend = true
+		return nil
+	}
+
+	ConnOpt.ReplyTo = func(destination string) func(*Conn) error {
+		return func(c *Conn) error {
+			c.options.ReplyTo = destination
+			return nil
+		}
+	}
+
+	ConnOpt.ContentType = func(contentType string) func(*Conn) error {
+		return func(c *Conn) error {
+			if _, ok := LookupCodec(contentType); !ok {
+				return unknownContentType(contentType)
+			}
+			c.options.ContentType = contentType
+			return nil
+		}
+	}
+
+	ConnOpt.Compress = func(encoding string, minSize int) func(*Conn) error {
+		return func(c *Conn) error {
+			if _, ok := lookupCompressor(encoding); !ok {
+				return unknownEncoding(encoding)
+			}
+			if minSize < 0 {
+				return ErrInvalidCompressMinSize
+			}
+			c.options.Compress = encoding
+			c.options.CompressMinSize = minSize
+			return nil
+		}
+	}
+
+	ConnOpt.MaxDecompressedSize = func(size int) func(*Conn) error {
+		return func(c *Conn) error {
+			if size <= 0 {
+				return ErrInvalidMaxDecompressed
+			}
+			c.options.MaxDecompressed = size
+			return nil
+		}
+	}
+
+	ConnOpt.Interceptors = func(interceptors ...Interceptor) func(*Conn) error {
+		return func(c *Conn) error {
+			for _, i := range interceptors {
+				if i == nil {
+					return ErrNilOption
+				}
+			}
+			c.options.Interceptors = append(c.options.Interceptors, interceptors...)
+			return nil
+		}
+	}
+
+	ConnOpt.Propagator = func(p Propagator) func(*Conn) error {
+		return func(c *Conn) error {
+			c.options.Propagator = p
+			return nil
+		}
+	}
+
+	ConnOpt.OnEvent = func(callback func(Event)) func(*Conn) error {
+		return func(c *Conn) error {
+			if callback == nil {
+				return ErrNilOption
+			}
+			c.options.EventCallbacks = append(c.options.EventCallbacks, callback)
+			return nil
+		}
+	}
 }
@@ -1,8 +1,10 @@
 package stomp
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"net"
 	"time"
 
 	"github.com/go-stomp/stomp/frame"
@@ -28,6 +30,16 @@ func (rw *fakeReaderWriter) Close() error {
 	return rw.conn.Close()
 }
 
+// connectFake performs the STOMP connect protocol sequence over fc,
+// which takes the place of the network connection made by Dial.
+func connectFake(fc net.Conn, opts ...func(*Conn) error) (*Conn, error) {
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return fc, nil
+	}
+	opts = append([]func(*Conn) error{ConnOpt.NoReconnect, ConnOpt.Dialer(dial)}, opts...)
+	return Dial("fake", fc.RemoteAddr().String(), opts...)
+}
+
 func (s *StompSuite) Test_unsuccessful_connect(c *C) {
 	fc1, fc2 := testutil.NewFakeConn(c)
 	stop := make(chan struct{})
@@ -47,7 +59,7 @@ func (s *StompSuite) Test_unsuccessful_connect(c *C) {
 		writer.Write(f2)
 	}()
 
-	conn, err := Connect(fc1)
+	conn, err := connectFake(fc1)
 	c.Assert(conn, IsNil)
 	c.Assert(err, ErrorMatches, "auth-failed")
 }
@@ -123,7 +135,7 @@ func (s *StompSuite) Test_successful_connect_and_disconnect(c *C) {
 			writer.Write(frame.New("RECEIPT", frame.ReceiptId, "1"))
 		}()
 
-		client, err := Connect(fc1, tc.Options...)
+		client, err := connectFake(fc1, tc.Options...)
 		c.Assert(err, IsNil)
 		c.Assert(client, NotNil)
 		c.Assert(client.Version(), Equals, tc.ExpectedVersion)
@@ -173,7 +185,7 @@ func (s *StompSuite) Test_successful_connect_with_nonstandard_header(c *C) {
 		writer.Write(frame.New("RECEIPT", frame.ReceiptId, "1"))
 	}()
 
-	client, err := Connect(fc1,
+	client, err := connectFake(fc1,
 		ConnOpt.Login("guest", "guest"),
 		ConnOpt.Host("/"),
 		ConnOpt.Header("x-max-length", "50"))
@@ -190,7 +202,7 @@ func (s *StompSuite) Test_successful_connect_with_nonstandard_header(c *C) {
 }
 
 // Sets up a connection for testing
-func connectHelper(c *C, version Version) (*Conn, *fakeReaderWriter) {
+func connectHelper(c *C, version Version, opts ...func(*Conn) error) (*Conn, *fakeReaderWriter) {
 	fc1, fc2 := testutil.NewFakeConn(c)
 	stop := make(chan struct{})
 
@@ -206,7 +218,7 @@ func connectHelper(c *C, version Version) (*Conn, *fakeReaderWriter) {
 		close(stop)
 	}()
 
-	conn, err := Connect(fc1)
+	conn, err := connectFake(fc1, opts...)
 	c.Assert(err, IsNil)
 	c.Assert(conn, NotNil)
 	<-stop
@@ -313,8 +325,7 @@ func subscribeHelper(c *C, ackMode AckMode, version Version, opts ...func(*frame
 		}
 	}
 
-	err = sub.Unsubscribe()
-	c.Assert(err, IsNil)
+	sub.Unsubscribe()
 
 	conn.Disconnect()
 }
@@ -454,8 +465,7 @@ func subscribeTransactionHelper(c *C, ackMode AckMode, version Version, abort bo
 		}
 	}
 
-	err = sub.Unsubscribe()
-	c.Assert(err, IsNil)
+	sub.Unsubscribe()
 
 	conn.Disconnect()
 }
@@ -530,7 +540,7 @@ func createHeartBeatConnection(
 		close(stop)
 	}()
 
-	conn, err := Connect(fc1,
+	conn, err := connectFake(fc1,
 		ConnOpt.HeartBeat(time.Millisecond, time.Millisecond),
 		ConnOpt.HeartBeatError(readTimeoutError))
 	c.Assert(conn, NotNil)
@@ -542,3 +552,183 @@ func createHeartBeatConnection(
 		conn:   fc2,
 	}
 }
+
+func (s *StompSuite) TestDialContextCancel(c *C) {
+	dialFake := func(ctx context.Context, fc net.Conn) (*Conn, error) {
+		dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return fc, nil
+		}
+		return DialContext(ctx, "fake", "the-server:456", ConnOpt.NoReconnect, ConnOpt.Dialer(dial))
+	}
+
+	// cancelled before the CONNECT frame is written
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fc1, _ := testutil.NewFakeConn(c)
+	conn, err := dialFake(ctx, fc1)
+	c.Check(conn, IsNil)
+	c.Check(err, Equals, context.Canceled)
+
+	// cancelled while waiting for the CONNECTED frame
+	ctx, cancel = context.WithCancel(context.Background())
+	fc1, fc2 := testutil.NewFakeConn(c)
+	go func() {
+		f, err := frame.NewReader(fc2).Read()
+		c.Check(err, IsNil)
+		c.Check(f.Command, Equals, frame.CONNECT)
+		cancel()
+	}()
+	conn, err = dialFake(ctx, fc1)
+	c.Check(conn, IsNil)
+	c.Check(err, Equals, context.Canceled)
+
+	// the deadline expires before the server reads the CONNECT frame
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	fc1, _ = testutil.NewFakeConn(c)
+	conn, err = dialFake(ctx, fc1)
+	c.Check(conn, IsNil)
+	c.Check(err, Equals, context.DeadlineExceeded)
+}
+
+// A network connection, unlike testutil.FakeConn, stays open when its
+// deadline expires, so the server only sees it closed if DialContext
+// closes it.
+func (s *StompSuite) TestDialContextCancelClosesConn(c *C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer listener.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	closed := make(chan error, 1)
+	go func() {
+		server, err := listener.Accept()
+		c.Assert(err, IsNil)
+		defer server.Close()
+		reader := frame.NewReader(server)
+		f, err := reader.Read()
+		c.Check(err, IsNil)
+		c.Check(f.Command, Equals, frame.CONNECT)
+		// never answer the CONNECT frame
+		cancel()
+		_, err = reader.Read()
+		closed <- err
+	}()
+
+	conn, err := DialContext(ctx, "tcp", listener.Addr().String(), ConnOpt.NoReconnect)
+	c.Check(conn, IsNil)
+	c.Check(err, Equals, context.Canceled)
+	select {
+	case err := <-closed:
+		c.Check(err, Equals, io.EOF)
+	case <-time.After(5 * time.Second):
+		c.Fatal("connection not closed")
+	}
+}
+
+func (s *StompSuite) TestSendContextCancel(c *C) {
+	conn, rw := connectHelper(c, V12)
+	defer rw.Close()
+
+	// cancelled before the SEND frame is handed to the connection
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Check(conn.SendContext(ctx, "/queue/test", "text/plain", []byte("1"), SendOpt.Receipt), Equals, context.Canceled)
+
+	// cancelled while waiting for the RECEIPT frame
+	ctx, cancel = context.WithCancel(context.Background())
+	received := make(chan *frame.Frame, 1)
+	go func() {
+		f, err := rw.Read()
+		c.Assert(err, IsNil)
+		received <- f
+		cancel()
+	}()
+	c.Check(conn.SendContext(ctx, "/queue/test", "text/plain", []byte("2"), SendOpt.Receipt), Equals, context.Canceled)
+	f := <-received
+	c.Check(string(f.Body), Equals, "2")
+
+	// the late RECEIPT is discarded, along with the abandoned receipt
+	// channel, and does not get in the way of the next message
+	rw.Write(frame.New(frame.RECEIPT, frame.ReceiptId, f.Header.Get(frame.Receipt)))
+	go func() {
+		f, err := rw.Read()
+		c.Assert(err, IsNil)
+		c.Check(string(f.Body), Equals, "3")
+		rw.Write(frame.New(frame.RECEIPT, frame.ReceiptId, f.Header.Get(frame.Receipt)))
+	}()
+	c.Check(conn.SendContext(context.Background(), "/queue/test", "text/plain", []byte("3"), SendOpt.Receipt), IsNil)
+}
+
+func (s *StompSuite) TestSubscribeContextCancel(c *C) {
+	conn, rw := connectHelper(c, V12)
+	defer rw.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sub, err := conn.SubscribeContext(ctx, "/queue/test", AckAuto)
+	c.Check(sub, IsNil)
+	c.Check(err, Equals, context.Canceled)
+	c.Check(conn.subs, HasLen, 0)
+}
+
+func (s *StompSuite) TestDisconnectContextCancel(c *C) {
+	conn, rw := connectHelper(c, V12)
+	defer rw.Close()
+
+	commands := make(chan string, 10)
+	go func() {
+		for {
+			f, err := rw.Read()
+			if err != nil {
+				return
+			}
+			commands <- f.Command
+		}
+	}()
+
+	// the server does not respond to the DISCONNECT frame
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	c.Check(conn.DisconnectContext(ctx), Equals, context.DeadlineExceeded)
+	c.Check(<-commands, Equals, frame.DISCONNECT)
+
+	// the connection is left open
+	c.Check(conn.Send("/queue/test", "text/plain", nil), IsNil)
+	c.Check(<-commands, Equals, frame.SEND)
+	c.Check(conn.MustDisconnect(), IsNil)
+}
+
+func (s *StompSuite) TestTransactionContextCancel(c *C) {
+	conn, rw := connectHelper(c, V12)
+	defer rw.Close()
+
+	commands := make(chan string, 10)
+	go func() {
+		for {
+			f, err := rw.Read()
+			if err != nil {
+				return
+			}
+			commands <- f.Command
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// the transaction is not completed if the context is done
+	tx := conn.Begin()
+	c.Check(tx.CommitContext(ctx), Equals, context.Canceled)
+	c.Check(tx.Commit(), IsNil)
+	c.Check(tx.Commit(), Equals, ErrCompletedTransaction)
+
+	tx = conn.Begin()
+	c.Check(tx.AbortContext(ctx), Equals, context.Canceled)
+	c.Check(tx.Abort(), IsNil)
+
+	for _, command := range []string{frame.BEGIN, frame.COMMIT, frame.BEGIN, frame.ABORT} {
+		c.Check(<-commands, Equals, command)
+	}
+}
@@ -0,0 +1,177 @@
+package stomp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/go-stomp/stomp/frame"
+)
+
+// consumeOptions collects the options for Conn.Consume.
+type consumeOptions struct {
+	Workers       int
+	AckMode       AckMode
+	SubscribeOpts []func(*frame.Frame) error
+}
+
+// ConsumeOpt contains options for the Conn.Consume function.
+var ConsumeOpt struct {
+	// Workers specifies the number of messages handled concurrently.
+	// The default is one, which handles messages in the order received.
+	Workers func(n int) func(*consumeOptions) error
+
+	// AckMode specifies the acknowledgement mode of the subscription.
+	// The default is AckClientIndividual. With AckAuto, the return value
+	// of the handler is only logged.
+	AckMode func(ack AckMode) func(*consumeOptions) error
+
+	// Subscribe specifies options for the SUBSCRIBE frame, such as
+	// SubscribeOpt.Prefetch.
+	Subscribe func(opts ...func(*frame.Frame) error) func(*consumeOptions) error
+}
+
+func init() {
+	ConsumeOpt.Workers = func(n int) func(*consumeOptions) error {
+		return func(o *consumeOptions) error {
+			if n <= 0 {
+				return ErrInvalidWorkers
+			}
+			o.Workers = n
+			return nil
+		}
+	}
+
+	ConsumeOpt.AckMode = func(ack AckMode) func(*consumeOptions) error {
+		return func(o *consumeOptions) error {
+			o.AckMode = ack
+			return nil
+		}
+	}
+
+	ConsumeOpt.Subscribe = func(opts ...func(*frame.Frame) error) func(*consumeOptions) error {
+		return func(o *consumeOptions) error {
+			o.SubscribeOpts = append(o.SubscribeOpts, opts...)
+			return nil
+		}
+	}
+}
+
+// Consume subscribes to destination and calls handler for each message
+// received, until ctx is done. The message is acknowledged if handler
+// returns nil, and negatively acknowledged, so that the server can deliver
+// it again, if handler returns an error or panics. Messages that carry an
+// error, such as a lost connection, are logged and not passed to handler.
+// A message received with a body that cannot be decompressed is negatively
+// acknowledged, so that it does not hold one of the prefetched messages.
+// The context passed to handler carries the trace context of the message.
+//
+// When ctx is done, Consume stops handing out messages, waits for the
+// handlers that are running to return, and then unsubscribes. Messages
+// that have been received but not handled are left unacknowledged.
+// Returns nil in that case, or an error if the subscription could not be
+// created or has been unsubscribed elsewhere.
+func (c *Conn) Consume(ctx context.Context, destination string, handler func(context.Context, *Message) error, opts ...func(*consumeOptions) error) error {
+	options := &consumeOptions{
+		Workers: 1,
+		AckMode: AckClientIndividual,
+	}
+	for _, opt := range opts {
+		if opt == nil {
+			return ErrNilOption
+		}
+		if err := opt(options); err != nil {
+			return err
+		}
+	}
+
+	sub, err := c.SubscribeContext(ctx, destination, options.AckMode, options.SubscribeOpts...)
+	if err != nil {
+		return err
+	}
+
+	msgs := make(chan *Message)
+	var wg sync.WaitGroup
+	for i := 0; i < options.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range msgs {
+				c.handleMessage(ctx, handler, msg)
+			}
+		}()
+	}
+
+	err = consumeLoop(ctx, sub, msgs)
+
+	// drain the handlers before unsubscribing, so that
+	// their acknowledgements reach the server
+	close(msgs)
+	wg.Wait()
+	if sub.Active() {
+		sub.Unsubscribe()
+	}
+	return err
+}
+
+// consumeLoop hands out the messages received on the
+// subscription to the workers, until ctx is done.
+func consumeLoop(ctx context.Context, sub *Subscription, msgs chan<- *Message) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-sub.C:
+			if !ok {
+				return ErrCompletedSubscription
+			}
+			if msg.Err != nil {
+				log.Errorf("consume %s: %s", sub.destination, msg.Err.Error())
+				if msg.Header != nil && msg.Header.Get(frame.MessageId) != "" && msg.ShouldAck() {
+					// received from the server, but cannot be handled
+					if err := msg.Conn.Nack(msg); err != nil {
+						log.Errorf("consume %s: nack: %s", sub.destination, err.Error())
+					}
+				}
+				continue
+			}
+			select {
+			case msgs <- msg:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+// handleMessage calls handler for a message, and acknowledges
+// the message according to the result.
+func (c *Conn) handleMessage(ctx context.Context, handler func(context.Context, *Message) error, msg *Message) {
+	err := callHandler(c.extractTrace(ctx, msg.Header), handler, msg)
+	if err != nil {
+		log.Errorf("consume %s: message %s: %s", msg.Destination,
+			msg.Header.Get(frame.MessageId), err.Error())
+	}
+	if !msg.ShouldAck() {
+		return
+	}
+
+	if err == nil {
+		err = c.Ack(msg)
+	} else {
+		err = c.Nack(msg)
+	}
+	if err != nil {
+		log.Errorf("consume %s: ack: %s", msg.Destination, err.Error())
+	}
+}
+
+// callHandler calls handler, turning a panic into an error.
+func callHandler(ctx context.Context, handler func(context.Context, *Message) error, msg *Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panic: %v", r)
+		}
+	}()
+	return handler(ctx, msg)
+}
@@ -0,0 +1,116 @@
+package stomp
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/go-stomp/stomp/frame"
+	. "gopkg.in/check.v1"
+)
+
+func (s *StompSuite) TestConsume(c *C) {
+	conn, rw := connectHelper(c, V12)
+	defer rw.Close()
+
+	acks := make(chan string, 10)
+	go func() {
+		for {
+			f, err := rw.Read()
+			if err != nil {
+				return
+			}
+			switch f.Command {
+			case frame.SUBSCRIBE:
+				c.Check(f.Header.Get(frame.Ack), Equals, frame.AckClientIndividual)
+				for i := 1; i <= 3; i++ {
+					id := strconv.Itoa(i)
+					rw.Write(frame.New(frame.MESSAGE,
+						frame.Subscription, f.Header.Get(frame.Id),
+						frame.Destination, "/queue/test",
+						frame.MessageId, id,
+						frame.Ack, id))
+				}
+			case frame.ACK, frame.NACK:
+				acks <- f.Command + " " + f.Header.Get(frame.Id)
+			case frame.UNSUBSCRIBE:
+				acks <- f.Command
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- conn.Consume(ctx, "/queue/test", func(ctx context.Context, msg *Message) error {
+			switch msg.Header.Get(frame.MessageId) {
+			case "2":
+				return errors.New("failed")
+			case "3":
+				panic("oops")
+			}
+			return nil
+		}, ConsumeOpt.Workers(2))
+	}()
+
+	received := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		received[<-acks] = true
+	}
+	c.Check(received, DeepEquals, map[string]bool{"ACK 1": true, "NACK 2": true, "NACK 3": true})
+
+	cancel()
+	c.Check(<-done, IsNil)
+	c.Check(<-acks, Equals, frame.UNSUBSCRIBE)
+}
+
+func (s *StompSuite) TestConsumeOptions(c *C) {
+	conn := &Conn{}
+	handler := func(ctx context.Context, msg *Message) error { return nil }
+	c.Check(conn.Consume(context.Background(), "/queue/test", handler, ConsumeOpt.Workers(0)), Equals, ErrInvalidWorkers)
+	c.Check(conn.Consume(context.Background(), "/queue/test", handler, nil), Equals, ErrNilOption)
+}
+
+func (s *StompSuite) TestConsumeNacksUndecodable(c *C) {
+	conn, rw := connectHelper(c, V12)
+	defer rw.Close()
+
+	acks := make(chan string, 10)
+	go func() {
+		for {
+			f, err := rw.Read()
+			if err != nil {
+				return
+			}
+			switch f.Command {
+			case frame.SUBSCRIBE:
+				rw.Write(frame.New(frame.MESSAGE,
+					frame.Subscription, f.Header.Get(frame.Id),
+					frame.Destination, "/queue/test",
+					frame.ContentEncoding, EncodingGzip,
+					frame.MessageId, "1",
+					frame.Ack, "1"))
+				rw.Write(frame.New(frame.MESSAGE,
+					frame.Subscription, f.Header.Get(frame.Id),
+					frame.Destination, "/queue/test",
+					frame.MessageId, "2",
+					frame.Ack, "2"))
+			case frame.ACK, frame.NACK:
+				acks <- f.Command + " " + f.Header.Get(frame.Id)
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handled := make(chan string, 10)
+	go conn.Consume(ctx, "/queue/test", func(ctx context.Context, msg *Message) error {
+		handled <- msg.Header.Get(frame.MessageId)
+		return nil
+	})
+
+	c.Check(<-acks, Equals, "NACK 1")
+	c.Check(<-acks, Equals, "ACK 2")
+	c.Check(<-handled, Equals, "2")
+	c.Check(handled, HasLen, 0)
+}
@@ -0,0 +1,57 @@
+package stomp
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"strings"
+)
+
+// dial connects to a single STOMP server, using the dialer specified
+// with ConnOpt.Dialer if any, and performs the TLS handshake if required.
+func (c *Conn) dial(ctx context.Context, e endpoint) (net.Conn, error) {
+	dial := c.options.Dialer
+	if dial == nil {
+		var dialer net.Dialer
+		dial = dialer.DialContext
+	}
+	cnet, err := dial(ctx, e.network, e.addr)
+	if err != nil || (c.options.TLSConfig == nil && !e.tls) {
+		return cnet, err
+	}
+
+	var config *tls.Config
+	if c.options.TLSConfig != nil {
+		config = c.options.TLSConfig.Clone()
+	} else {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" {
+		config.ServerName = c.serverName(e)
+	}
+
+	tlsConn := tls.Client(cnet, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		cnet.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// serverName returns the name used to verify the certificate of
+// the STOMP server, and sent to it for SNI. This is the host header
+// if it has been specified explicitly and is a host name, otherwise
+// the host of the server's address.
+func (c *Conn) serverName(e endpoint) string {
+	if !c.rec.hostFromAddr {
+		host := c.options.Host
+		if host != "" && host != "default" && !strings.ContainsAny(host, "/:") {
+			return host
+		}
+	}
+	host, _, err := net.SplitHostPort(e.addr)
+	if err != nil {
+		return e.addr
+	}
+	return host
+}
@@ -0,0 +1,21 @@
+package stomp
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *StompSuite) TestServerName(c *C) {
+	e := endpoint{network: "tcp", addr: "broker-1.example:61614"}
+
+	conn := &Conn{options: &connOptions{Host: "broker.example"}}
+	c.Check(conn.serverName(e), Equals, "broker.example")
+
+	// virtual host names are not host names
+	conn.options.Host = "/"
+	c.Check(conn.serverName(e), Equals, "broker-1.example")
+
+	// host taken from the address of another server
+	conn.options.Host = "broker-2.example"
+	conn.rec.hostFromAddr = true
+	c.Check(conn.serverName(e), Equals, "broker-1.example")
+}
@@ -6,17 +6,26 @@ import (
 
 // Error values
 var (
-	ErrInvalidCommand        = newErrorMessage("invalid command")
-	ErrInvalidFrameFormat    = newErrorMessage("invalid frame format")
-	ErrUnsupportedVersion    = newErrorMessage("unsupported version")
-	ErrCompletedTransaction  = newErrorMessage("transaction is completed")
-	ErrNackNotSupported      = newErrorMessage("NACK not supported in STOMP 1.0")
-	ErrNotReceivedMessage    = newErrorMessage("cannot ack/nack a message, not from server")
-	ErrCannotNackAutoSub     = newErrorMessage("cannot send NACK for a subscription with ack:auto")
-	ErrCompletedSubscription = newErrorMessage("subscription is unsubscribed")
-	ErrClosedUnexpectedly    = newErrorMessage("connection closed unexpectedly")
-	ErrAlreadyClosed         = newErrorMessage("connection already closed")
-	ErrNilOption             = newErrorMessage("nil option")
+	ErrInvalidCommand         = newErrorMessage("invalid command")
+	ErrInvalidFrameFormat     = newErrorMessage("invalid frame format")
+	ErrUnsupportedVersion     = newErrorMessage("unsupported version")
+	ErrCompletedTransaction   = newErrorMessage("transaction is completed")
+	ErrNackNotSupported       = newErrorMessage("NACK not supported in STOMP 1.0")
+	ErrNotReceivedMessage     = newErrorMessage("cannot ack/nack a message, not from server")
+	ErrCannotNackAutoSub      = newErrorMessage("cannot send NACK for a subscription with ack:auto")
+	ErrCompletedSubscription  = newErrorMessage("subscription is unsubscribed")
+	ErrClosedUnexpectedly     = newErrorMessage("connection closed unexpectedly")
+	ErrAlreadyClosed          = newErrorMessage("connection already closed")
+	ErrNilOption              = newErrorMessage("nil option")
+	ErrInvalidReconnectPolicy = newErrorMessage("invalid reconnect policy")
+	ErrInvalidPriorityBackup  = newErrorMessage("invalid priority backup interval")
+	ErrInvalidPrefetch        = newErrorMessage("invalid prefetch count")
+	ErrInvalidOverflowPolicy  = newErrorMessage("invalid overflow policy")
+	ErrSubscriptionOverflow   = newErrorMessage("subscription buffer full, messages discarded")
+	ErrInvalidWorkers         = newErrorMessage("invalid number of workers")
+	ErrInvalidCompressMinSize = newErrorMessage("invalid minimum size for compression")
+	ErrInvalidMaxDecompressed = newErrorMessage("invalid maximum decompressed size")
+	ErrDecompressedTooLarge   = newErrorMessage("decompressed message body too large")
 )
 
 // StompError implements the Error interface, and provides
@@ -0,0 +1,97 @@
+package stomp
+
+import (
+	"time"
+)
+
+// The EventType type is an enumeration of the connection lifecycle
+// events reported to the ConnOpt.OnEvent callback.
+type EventType int
+
+const (
+	// The connection to the STOMP server has been established by Dial.
+	EventConnected EventType = iota
+
+	// An attempt to dial the STOMP server failed. Err contains the
+	// cause, and Delay how long Dial waits before the next attempt.
+	EventDialFailed
+
+	// The connection to the STOMP server has been lost. Err contains
+	// the cause.
+	EventDisconnected
+
+	// An attempt to re-establish the lost connection failed. Err contains
+	// the cause, and Delay how long the client waits before the next attempt.
+	EventReconnecting
+
+	// The lost connection has been re-established.
+	EventReconnected
+
+	// A subscription has been re-created on the re-established connection.
+	EventResubscribed
+
+	// The reconnect policy has been exhausted and the client no longer
+	// attempts to connect. Err contains the cause of the last failure.
+	EventGaveUp
+
+	// The connection has been closed by Disconnect or MustDisconnect,
+	// and the client no longer attempts to re-establish it.
+	EventClosed
+)
+
+// String returns the string representation of the EventType value.
+func (t EventType) String() string {
+	switch t {
+	case EventConnected:
+		return "connected"
+	case EventDialFailed:
+		return "dial-failed"
+	case EventDisconnected:
+		return "disconnected"
+	case EventReconnecting:
+		return "reconnecting"
+	case EventReconnected:
+		return "reconnected"
+	case EventResubscribed:
+		return "resubscribed"
+	case EventGaveUp:
+		return "gave-up"
+	case EventClosed:
+		return "closed"
+	}
+	panic("invalid EventType value")
+}
+
+// An Event describes a change in the lifecycle of a connection
+// to the STOMP server.
+type Event struct {
+	Type EventType
+
+	// Connection that the event applies to.
+	Conn *Conn
+
+	// Cause of the event, for failures and disconnections.
+	Err error
+
+	// Number of failed attempts so far, for EventDialFailed,
+	// EventReconnecting and EventGaveUp.
+	Attempt int
+
+	// Delay before the next attempt, for EventDialFailed
+	// and EventReconnecting.
+	Delay time.Duration
+
+	// Subscription that has been re-created, for EventResubscribed.
+	Subscription *Subscription
+}
+
+// emit reports an event to every callback registered with ConnOpt.OnEvent.
+func (c *Conn) emit(e Event) {
+	if c.options == nil {
+		return
+	}
+	e.Conn = c
+	for _, callback := range c.options.EventCallbacks {
+		callback(e)
+	}
+}
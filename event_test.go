@@ -0,0 +1,134 @@
+package stomp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/go-stomp/stomp/frame"
+	"github.com/go-stomp/stomp/testutil"
+	. "gopkg.in/check.v1"
+)
+
+func (s *StompSuite) TestEventTypeString(c *C) {
+	c.Check(EventConnected.String(), Equals, "connected")
+	c.Check(EventDialFailed.String(), Equals, "dial-failed")
+	c.Check(EventDisconnected.String(), Equals, "disconnected")
+	c.Check(EventReconnecting.String(), Equals, "reconnecting")
+	c.Check(EventReconnected.String(), Equals, "reconnected")
+	c.Check(EventResubscribed.String(), Equals, "resubscribed")
+	c.Check(EventGaveUp.String(), Equals, "gave-up")
+	c.Check(EventClosed.String(), Equals, "closed")
+	c.Check(func() { _ = EventType(999).String() }, PanicMatches, "invalid EventType value")
+}
+
+func (s *StompSuite) TestEventLifecycle(c *C) {
+	fc1, fc2 := testutil.NewFakeConn(c)
+	fc3, fc4 := testutil.NewFakeConn(c)
+
+	// every other attempt to dial fails
+	conns := make(chan net.Conn, 4)
+	conns <- nil
+	conns <- fc1
+	conns <- nil
+	conns <- fc3
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		select {
+		case conn := <-conns:
+			if conn != nil {
+				return conn, nil
+			}
+		default:
+		}
+		return nil, errors.New("connection refused")
+	}
+
+	go func() {
+		reader := frame.NewReader(fc2)
+		writer := frame.NewWriter(fc2)
+		f, err := reader.Read()
+		c.Assert(err, IsNil)
+		c.Assert(f.Command, Equals, frame.CONNECT)
+		writer.Write(frame.New(frame.CONNECTED, frame.Version, "1.2"))
+		f, err = reader.Read()
+		c.Assert(err, IsNil)
+		c.Assert(f.Command, Equals, frame.SUBSCRIBE)
+		fc2.Close()
+	}()
+
+	go func() {
+		reader := frame.NewReader(fc4)
+		writer := frame.NewWriter(fc4)
+		f, err := reader.Read()
+		c.Assert(err, IsNil)
+		c.Assert(f.Command, Equals, frame.CONNECT)
+		writer.Write(frame.New(frame.CONNECTED, frame.Version, "1.2"))
+		f, err = reader.Read()
+		c.Assert(err, IsNil)
+		c.Assert(f.Command, Equals, frame.SUBSCRIBE)
+		c.Check(f.Header.Get(frame.Destination), Equals, "/queue/test")
+		f, err = reader.Read()
+		c.Assert(err, IsNil)
+		c.Assert(f.Command, Equals, frame.DISCONNECT)
+		writer.Write(frame.New(frame.RECEIPT, frame.ReceiptId, f.Header.Get(frame.Receipt)))
+		fc4.Close()
+	}()
+
+	events := make(chan Event, 10)
+	conn, err := Dial("fake", "the-server:456",
+		ConnOpt.Dialer(dial),
+		ConnOpt.Reconnect(ReconnectPolicy{InitialDelay: time.Millisecond}),
+		ConnOpt.OnEvent(func(e Event) { events <- e }))
+	c.Assert(err, IsNil)
+
+	e := <-events
+	c.Check(e.Type, Equals, EventDialFailed)
+	c.Check(e.Conn, Equals, conn)
+	c.Check(e.Err, ErrorMatches, "connection refused")
+	c.Check(e.Attempt, Equals, 1)
+	c.Check(e.Delay, Equals, time.Millisecond)
+	c.Check((<-events).Type, Equals, EventConnected)
+
+	sub, err := conn.Subscribe("/queue/test", AckAuto)
+	c.Assert(err, IsNil)
+
+	e = <-events
+	c.Check(e.Type, Equals, EventDisconnected)
+	c.Check(e.Err, NotNil)
+	e = <-events
+	c.Check(e.Type, Equals, EventReconnecting)
+	c.Check(e.Err, ErrorMatches, "connection refused")
+	c.Check(e.Attempt, Equals, 1)
+	c.Check(e.Delay, Equals, time.Millisecond)
+	c.Check((<-events).Type, Equals, EventReconnected)
+	e = <-events
+	c.Check(e.Type, Equals, EventResubscribed)
+	c.Check(e.Subscription, Equals, sub)
+
+	c.Assert(conn.Disconnect(), IsNil)
+	e = <-events
+	c.Check(e.Type, Equals, EventClosed)
+	c.Check(e.Err, IsNil)
+	for range sub.C {
+		// closed along with the connection
+	}
+	c.Check(events, HasLen, 0)
+}
+
+func (s *StompSuite) TestEventClosedByMustDisconnect(c *C) {
+	events := make(chan Event, 10)
+	conn, rw := connectHelper(c, V12, ConnOpt.OnEvent(func(e Event) { events <- e }))
+	defer rw.Close()
+	c.Check((<-events).Type, Equals, EventConnected)
+
+	c.Check(conn.MustDisconnect(), IsNil)
+	e := <-events
+	c.Check(e.Type, Equals, EventClosed)
+	c.Check(e.Err, IsNil)
+
+	// closing again reports nothing
+	c.Check(conn.MustDisconnect(), IsNil)
+	c.Check(conn.Disconnect(), IsNil)
+	c.Check(events, HasLen, 0)
+}
@@ -0,0 +1,205 @@
+package stomp
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FailoverPrefix is the prefix of a failover URI, which can be passed
+// as the addr parameter of Dial to specify several STOMP servers.
+// For example:
+//
+//	failover:(tcp://a:61613,tcp://b:61613)?randomize=false&priorityBackup=true
+//
+// The client connects to the servers in turn until one of them accepts
+// the connection, both when dialing and when reconnecting. Servers with
+// the "ssl" or "stomp+ssl" scheme are connected to using TLS. The following
+// parameters are recognised:
+//
+//	randomize               try the servers in random order (default true)
+//	priorityBackup          prefer the first server: while connected to
+//	                        another one, check periodically whether the
+//	                        first server is available again and move back
+//	                        to it (default false)
+//	priorityBackupInterval  milliseconds between checks (default 30000)
+const FailoverPrefix = "failover:"
+
+// Default interval between checks for the primary server in
+// priority backup mode.
+const DefaultPriorityBackupInterval = 30 * time.Second
+
+// endpoint is the network address of a STOMP server.
+type endpoint struct {
+	network string
+	addr    string
+	tls     bool // connect using TLS even without ConnOpt.TLS
+}
+
+// endpoints is the list of STOMP servers that a connection can use,
+// along with the one that is currently being used. The first endpoint
+// is the primary server for priority backup mode.
+type endpoints struct {
+	list    []endpoint
+	current int
+}
+
+// parseFailoverURI parses a failover URI into the list of endpoints
+// it contains and a connect option that applies its parameters.
+func parseFailoverURI(uri string) ([]endpoint, func(*Conn) error, error) {
+	rest := strings.TrimPrefix(uri, FailoverPrefix)
+	query := ""
+	if strings.HasPrefix(rest, "(") {
+		end := strings.Index(rest, ")")
+		if end < 0 {
+			return nil, nil, invalidFailoverURI(uri)
+		}
+		rest, query = rest[1:end], strings.TrimPrefix(rest[end+1:], "?")
+	} else if i := strings.Index(rest, "?"); i >= 0 {
+		rest, query = rest[:i], rest[i+1:]
+	}
+
+	var list []endpoint
+	for _, s := range strings.Split(rest, ",") {
+		u, err := url.Parse(strings.TrimSpace(s))
+		if err != nil || u.Host == "" {
+			return nil, nil, invalidFailoverURI(uri)
+		}
+		e := endpoint{network: u.Scheme, addr: u.Host}
+		switch e.network {
+		case "", "stomp":
+			e.network = "tcp"
+		case "ssl", "stomp+ssl":
+			e.network, e.tls = "tcp", true
+		}
+		list = append(list, e)
+	}
+
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, nil, invalidFailoverURI(uri)
+	}
+	randomize := true
+	priorityBackup := false
+	interval := DefaultPriorityBackupInterval
+	for key := range params {
+		value := params.Get(key)
+		switch key {
+		case "randomize":
+			randomize, err = strconv.ParseBool(value)
+		case "priorityBackup":
+			priorityBackup, err = strconv.ParseBool(value)
+		case "priorityBackupInterval":
+			var ms uint64
+			ms, err = strconv.ParseUint(value, 10, 32)
+			interval = time.Duration(ms) * time.Millisecond
+		}
+		if err != nil || interval <= 0 {
+			return nil, nil, invalidFailoverURI(uri)
+		}
+	}
+
+	opt := func(c *Conn) error {
+		c.options.Randomize = randomize
+		if priorityBackup {
+			c.options.PriorityBackup = interval
+		}
+		return nil
+	}
+	return list, opt, nil
+}
+
+func invalidFailoverURI(uri string) Error {
+	return newErrorMessage("invalid failover URI: " + uri)
+}
+
+// init prepares the list of endpoints for the first dial,
+// shuffling it if requested.
+func (e *endpoints) init(randomize, keepPrimary bool) {
+	e.current = 0
+	if !randomize {
+		return
+	}
+	first := 0
+	if keepPrimary {
+		first = 1
+	}
+	for i := len(e.list) - 1; i > first; i-- {
+		j := first + rand.Intn(i-first+1)
+		e.list[i], e.list[j] = e.list[j], e.list[i]
+	}
+}
+
+// failedOver moves on from the current endpoint after its connection
+// has been lost. In priority backup mode the primary is always tried first.
+func (e *endpoints) failedOver(priorityBackup bool) {
+	if priorityBackup {
+		e.current = 0
+	} else {
+		e.current = (e.current + 1) % len(e.list)
+	}
+}
+
+// dialEndpoints tries each endpoint in turn, starting with the current one,
+// and returns the first successful connection. Returns the error for the
+// last endpoint if none of them accept the connection.
+func (c *Conn) dialEndpoints(ctx context.Context) (net.Conn, error) {
+	var err error
+	for i := 0; i < len(c.rec.endpoints.list); i++ {
+		e := c.rec.endpoints.list[c.rec.endpoints.current]
+		var cnet net.Conn
+		cnet, err = c.dial(ctx, e)
+		if err == nil {
+			return cnet, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.Errorf("Dial: connect error %s %s", e.addr, err.Error())
+		c.rec.endpoints.current = (c.rec.endpoints.current + 1) % len(c.rec.endpoints.list)
+	}
+	return nil, err
+}
+
+// watchPrimary runs while the connection is using a backup server in
+// priority backup mode. It periodically checks whether the primary server
+// accepts connections again, and if so signals failback, which makes
+// processLoop close the connection to the backup so that reconnecting
+// moves it back to the primary. It returns once stopped is closed, when
+// processLoop stops using the connection.
+func (c *Conn) watchPrimary(stopped <-chan struct{}, failback chan<- struct{}) {
+	primary := c.rec.endpoints.list[0]
+	timer := time.NewTimer(c.options.PriorityBackup)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-stopped:
+			return
+		}
+		probe, err := c.dial(context.Background(), primary)
+		if err != nil {
+			timer.Reset(c.options.PriorityBackup)
+			continue
+		}
+		probe.Close()
+		log.Infof("primary %s is available again", primary.addr)
+		select {
+		case failback <- struct{}{}:
+		case <-stopped:
+		}
+		return
+	}
+}
+
+// startWatchPrimary starts watchPrimary if priority backup
+// mode is enabled and the connection is not to the primary.
+func (c *Conn) startWatchPrimary(stopped <-chan struct{}, failback chan<- struct{}) {
+	if c.options.PriorityBackup > 0 && c.rec.endpoints.current != 0 {
+		go c.watchPrimary(stopped, failback)
+	}
+}
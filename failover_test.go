@@ -0,0 +1,132 @@
+package stomp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/go-stomp/stomp/frame"
+	"github.com/go-stomp/stomp/testutil"
+	. "gopkg.in/check.v1"
+)
+
+func (s *StompSuite) TestParseFailoverURI(c *C) {
+	list, opt, err := parseFailoverURI("failover:(tcp://a:61613,tcp://b:61614)?randomize=false&priorityBackup=true")
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []endpoint{
+		{network: "tcp", addr: "a:61613"},
+		{network: "tcp", addr: "b:61614"},
+	})
+
+	conn := &Conn{options: &connOptions{}}
+	c.Assert(opt(conn), IsNil)
+	c.Check(conn.options.Randomize, Equals, false)
+	c.Check(conn.options.PriorityBackup, Equals, DefaultPriorityBackupInterval)
+
+	list, opt, err = parseFailoverURI("failover:stomp://a:61613,tcp6://[::1]:61613?priorityBackup=true&priorityBackupInterval=500")
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []endpoint{
+		{network: "tcp", addr: "a:61613"},
+		{network: "tcp6", addr: "[::1]:61613"},
+	})
+
+	conn = &Conn{options: &connOptions{}}
+	c.Assert(opt(conn), IsNil)
+	c.Check(conn.options.Randomize, Equals, true)
+	c.Check(conn.options.PriorityBackup, Equals, 500*time.Millisecond)
+}
+
+func (s *StompSuite) TestParseFailoverURIInvalid(c *C) {
+	for _, uri := range []string{
+		"failover:(tcp://a:61613",
+		"failover:(a:61613)",
+		"failover:(tcp://a:61613)?randomize=maybe",
+		"failover:(tcp://a:61613)?priorityBackupInterval=0",
+	} {
+		_, _, err := parseFailoverURI(uri)
+		c.Check(err, NotNil, Commentf("%s", uri))
+	}
+}
+
+func (s *StompSuite) TestEndpointsFailedOver(c *C) {
+	e := endpoints{list: []endpoint{{addr: "a"}, {addr: "b"}, {addr: "c"}}}
+	e.init(false, false)
+	c.Check(e.current, Equals, 0)
+
+	e.failedOver(false)
+	c.Check(e.current, Equals, 1)
+	e.failedOver(false)
+	e.failedOver(false)
+	c.Check(e.current, Equals, 0)
+
+	e.current = 2
+	e.failedOver(true)
+	c.Check(e.current, Equals, 0)
+
+	// the primary stays first in priority backup mode
+	for i := 0; i < 10; i++ {
+		e.init(true, true)
+		c.Check(e.list[0].addr, Equals, "a")
+	}
+}
+
+func (s *StompSuite) TestPriorityBackupFailback(c *C) {
+	// serve answers the CONNECT frame, and then a DISCONNECT
+	// frame if the client disconnects from this server
+	serve := func(fc *testutil.FakeConn) {
+		reader := frame.NewReader(fc)
+		writer := frame.NewWriter(fc)
+		f, err := reader.Read()
+		c.Assert(err, IsNil)
+		c.Assert(f.Command, Equals, frame.CONNECT)
+		writer.Write(frame.New(frame.CONNECTED, frame.Version, "1.2"))
+		for {
+			f, err := reader.Read()
+			if err != nil {
+				return
+			}
+			if f != nil && f.Command == frame.DISCONNECT {
+				writer.Write(frame.New(frame.RECEIPT, frame.ReceiptId, f.Header.Get(frame.Receipt)))
+			}
+		}
+	}
+
+	primary := make(chan net.Conn, 2)
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if addr == "backup:2" {
+			client, server := testutil.NewFakeConn(c)
+			go serve(server)
+			return client, nil
+		}
+		select {
+		case conn := <-primary:
+			return conn, nil
+		default:
+			return nil, errors.New("connection refused")
+		}
+	}
+
+	events := make(chan Event, 10)
+	conn, err := Dial("", "failover:(tcp://primary:1,tcp://backup:2)?randomize=false&priorityBackup=true&priorityBackupInterval=10",
+		ConnOpt.Dialer(dial),
+		ConnOpt.Reconnect(ReconnectPolicy{InitialDelay: time.Millisecond}),
+		ConnOpt.OnEvent(func(e Event) { events <- e }))
+	c.Assert(err, IsNil)
+	c.Check((<-events).Type, Equals, EventConnected)
+	c.Check(conn.rec.endpoints.current, Equals, 1)
+
+	// the primary accepts the probe, and then the connection
+	probe, _ := testutil.NewFakeConn(c)
+	primary <- probe
+	client, server := testutil.NewFakeConn(c)
+	go serve(server)
+	primary <- client
+
+	e := <-events
+	c.Check(e.Type, Equals, EventDisconnected)
+	c.Check(e.Err, ErrorMatches, "moving back to the primary server")
+	c.Check((<-events).Type, Equals, EventReconnected)
+	c.Check(conn.rec.endpoints.current, Equals, 0)
+	c.Check(conn.Disconnect(), IsNil)
+}
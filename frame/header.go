@@ -31,6 +31,28 @@ const (
 	Message       = "message"
 )
 
+// Header names that are not defined by the STOMP
+// standard, but are widely used by STOMP servers.
+const (
+	ReplyTo                 = "reply-to"
+	CorrelationId           = "correlation-id"
+	ContentEncoding         = "content-encoding"
+	TraceParent             = "traceparent"
+	TraceState              = "tracestate"
+	ClientId                = "client-id"
+	DurableSubscriptionName = "durable-subscription-name"
+	Expires                 = "expires"
+	Ttl                     = "ttl"
+	OriginalDestination     = "original-destination"
+	DeliveryCount           = "delivery-count"
+	Redelivered             = "redelivered"
+	DeadLetterReason        = "dead-letter-reason"
+	Priority                = "priority"
+	Delay                   = "delay"
+	DeliverAt               = "deliver-at"
+	Selector                = "selector"
+)
+
 // A Header represents the header part of a STOMP frame.
 // The header in a STOMP frame consists of a list of header entries.
 // Each header entry is a key/value pair of strings.
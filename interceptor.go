@@ -0,0 +1,82 @@
+package stomp
+
+import (
+	"github.com/go-stomp/stomp/frame"
+)
+
+// An Interceptor sees the frames exchanged with the STOMP server, and can
+// observe, modify or reject them. Interceptors are specified with
+// ConnOpt.Interceptors, and should return quickly.
+type Interceptor interface {
+	// Outbound is called for each frame the program sends, on the goroutine
+	// sending it, before the frame is handed to the connection. Outbound
+	// can therefore be called concurrently. Frames written again after a
+	// reconnect are not intercepted again. If Outbound returns an error,
+	// the frame is not sent, and the error is returned to the program.
+	Outbound(f *frame.Frame) error
+
+	// Inbound is called on the goroutine that handles the connection, one
+	// frame at a time, for each MESSAGE, RECEIPT and ERROR frame received
+	// from the server, before it is passed on. If Inbound returns an error
+	// for a MESSAGE or RECEIPT frame, the program receives the error instead
+	// of the frame. An ERROR frame always closes the connection.
+	Inbound(f *frame.Frame) error
+}
+
+// InterceptorFuncs is an Interceptor built from a pair of functions,
+// either of which can be nil.
+type InterceptorFuncs struct {
+	OutboundFunc func(f *frame.Frame) error
+	InboundFunc  func(f *frame.Frame) error
+}
+
+func (i InterceptorFuncs) Outbound(f *frame.Frame) error {
+	if i.OutboundFunc == nil {
+		return nil
+	}
+	return i.OutboundFunc(f)
+}
+
+func (i InterceptorFuncs) Inbound(f *frame.Frame) error {
+	if i.InboundFunc == nil {
+		return nil
+	}
+	return i.InboundFunc(f)
+}
+
+// interceptOutbound calls the interceptors in the order they were
+// specified, stopping at the first one that rejects the frame.
+func (c *Conn) interceptOutbound(f *frame.Frame) error {
+	for _, i := range c.options.Interceptors {
+		if err := i.Outbound(f); err != nil {
+			log.Errorf("outbound %s frame rejected: %s", f.Command, err.Error())
+			return err
+		}
+	}
+	return nil
+}
+
+// interceptInbound calls the interceptors in the reverse order, so that the
+// first interceptor is the first to see outbound frames and the last to see
+// inbound frames. Stops at the first interceptor that rejects the frame.
+func (c *Conn) interceptInbound(f *frame.Frame) error {
+	for i := len(c.options.Interceptors) - 1; i >= 0; i-- {
+		if err := c.options.Interceptors[i].Inbound(f); err != nil {
+			log.Errorf("inbound %s frame rejected: %s", f.Command, err.Error())
+			return err
+		}
+	}
+	return nil
+}
+
+// rejectedFrame returns the ERROR frame passed to the program
+// in place of a frame rejected by an interceptor.
+func rejectedFrame(f *frame.Frame, err error) *frame.Frame {
+	rejected := &frame.Frame{
+		Command: frame.ERROR,
+		Header:  f.Header.Clone(),
+		Body:    f.Body,
+	}
+	rejected.Header.Set(frame.Message, err.Error())
+	return rejected
+}
@@ -0,0 +1,130 @@
+package stomp
+
+import (
+	"errors"
+
+	"github.com/go-stomp/stomp/frame"
+	. "gopkg.in/check.v1"
+)
+
+func (s *StompSuite) TestInterceptors(c *C) {
+	sent := make(chan *frame.Frame, 10)
+	server := func(rw *fakeReaderWriter) {
+		for {
+			f, err := rw.Read()
+			if err != nil {
+				return
+			}
+			sent <- f
+			switch f.Command {
+			case frame.SUBSCRIBE:
+				for _, body := range []string{"good", "bad"} {
+					msg := frame.New(frame.MESSAGE,
+						frame.Subscription, f.Header.Get(frame.Id),
+						frame.Destination, "/queue/test",
+						frame.MessageId, body)
+					msg.Body = []byte(body)
+					rw.Write(msg)
+				}
+			case frame.SEND:
+				rw.Write(frame.New(frame.RECEIPT, frame.ReceiptId, f.Header.Get(frame.Receipt)))
+			}
+		}
+	}
+
+	var order []string
+	record := func(name string) Interceptor {
+		return InterceptorFuncs{
+			OutboundFunc: func(f *frame.Frame) error {
+				if f.Command == frame.SEND {
+					order = append(order, "out "+name)
+				}
+				return nil
+			},
+			InboundFunc: func(f *frame.Frame) error {
+				if f.Command == frame.RECEIPT {
+					order = append(order, "in "+name)
+				}
+				return nil
+			},
+		}
+	}
+	validate := InterceptorFuncs{
+		OutboundFunc: func(f *frame.Frame) error {
+			if string(f.Body) == "bad" {
+				return errors.New("invalid body")
+			}
+			f.Header.Set("x-trace", "123")
+			return nil
+		},
+		InboundFunc: func(f *frame.Frame) error {
+			if string(f.Body) == "bad" {
+				return errors.New("invalid body")
+			}
+			return nil
+		},
+	}
+
+	conn, rw := connectHelper(c, V12,
+		ConnOpt.Interceptors(record("a"), record("b")),
+		ConnOpt.Interceptors(validate))
+	defer rw.Close()
+	go server(rw)
+
+	c.Assert(conn.Send("/queue/test", "text/plain", []byte("good"), SendOpt.Receipt), IsNil)
+	f := <-sent
+	c.Check(f.Header.Get("x-trace"), Equals, "123")
+	c.Check(order, DeepEquals, []string{"out a", "out b", "in b", "in a"})
+
+	err := conn.Send("/queue/test", "text/plain", []byte("bad"), SendOpt.Receipt)
+	c.Assert(err, NotNil)
+	c.Check(err.Error(), Equals, "invalid body")
+
+	sub, err := conn.Subscribe("/queue/test", AckAuto)
+	c.Assert(err, IsNil)
+	msg := <-sub.C
+	c.Check(msg.Err, IsNil)
+	c.Check(string(msg.Body), Equals, "good")
+	msg = <-sub.C
+	c.Assert(msg.Err, NotNil)
+	c.Check(msg.Err.Error(), Equals, "invalid body")
+	c.Check(msg.Header.Get(frame.MessageId), Equals, "bad")
+}
+
+func (s *StompSuite) TestInterceptorRejects(c *C) {
+	reject := InterceptorFuncs{
+		OutboundFunc: func(f *frame.Frame) error {
+			if f.Header.Get(frame.Destination) == "/queue/forbidden" {
+				return errors.New("forbidden")
+			}
+			return nil
+		},
+	}
+	conn, rw := connectHelper(c, V12, ConnOpt.Interceptors(reject))
+	defer rw.Close()
+
+	// rejected frames are not written, and the caller gets the error
+	// even when it does not wait for a receipt
+	err := conn.Send("/queue/forbidden", "text/plain", nil)
+	c.Assert(err, NotNil)
+	c.Check(err.Error(), Equals, "forbidden")
+	confirm, err := conn.SendAsync("/queue/forbidden", "text/plain", nil)
+	c.Check(confirm, IsNil)
+	c.Assert(err, NotNil)
+	c.Check(err.Error(), Equals, "forbidden")
+
+	sub, err := conn.Subscribe("/queue/forbidden", AckAuto)
+	c.Check(sub, IsNil)
+	c.Assert(err, NotNil)
+	c.Check(err.Error(), Equals, "forbidden")
+	c.Check(conn.subs, HasLen, 0)
+
+	go func() {
+		f, err := rw.Read()
+		c.Assert(err, IsNil)
+		c.Check(f.Command, Equals, frame.SEND)
+		c.Check(f.Header.Get(frame.Destination), Equals, "/queue/allowed")
+		rw.Write(frame.New(frame.RECEIPT, frame.ReceiptId, f.Header.Get(frame.Receipt)))
+	}()
+	c.Check(conn.Send("/queue/allowed", "text/plain", nil, SendOpt.Receipt), IsNil)
+}
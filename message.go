@@ -1,6 +1,8 @@
 package stomp
 
 import (
+	"context"
+
 	"github.com/go-stomp/stomp/frame"
 )
 
@@ -35,6 +37,19 @@ type Message struct {
 	// The message body, which is an arbitrary sequence of bytes.
 	// The ContentType indicates the format of this body.
 	Body []byte // Content of message
+
+	// Trace context extracted from the header entries.
+	ctx context.Context
+}
+
+// Context returns a context carrying the trace context that the sender
+// of the message added to it, as extracted by the connection's Propagator.
+// Returns context.Background() if there is none.
+func (msg *Message) Context() context.Context {
+	if msg.ctx == nil {
+		return context.Background()
+	}
+	return msg.ctx
 }
 
 // ShouldAck returns true if this message should be acknowledged to
@@ -0,0 +1,80 @@
+package stomp
+
+import (
+	"strconv"
+
+	"github.com/go-stomp/stomp/frame"
+)
+
+// Header entries used to ask the STOMP server to limit the number of
+// unacknowledged messages sent to a subscription. ActiveMQ recognises the
+// first one, RabbitMQ the second.
+const (
+	prefetchSizeHeader  = "activemq.prefetchSize"
+	prefetchCountHeader = "prefetch-count"
+)
+
+// overflowHeader carries the overflow policy from SubscribeOpt.Overflow to
+// Conn.Subscribe. It is removed before the SUBSCRIBE frame is sent.
+const overflowHeader = "x-stomp-client-overflow"
+
+// The OverflowPolicy type is an enumeration of the ways a subscription
+// handles messages that arrive from the STOMP server when its buffer
+// is full, because the program is not reading from the Subscription.C
+// channel quickly enough.
+type OverflowPolicy int
+
+const (
+	// Wait until there is room in the buffer. The connection stops
+	// reading frames from the server in the meantime, so one slow
+	// subscription delays the others on the same connection.
+	OverflowBlock OverflowPolicy = iota
+
+	// Discard the oldest message in the buffer to make room.
+	OverflowDropOldest
+
+	// Discard the message, and report ErrSubscriptionOverflow as the
+	// Err of the next message read from the Subscription.C channel.
+	OverflowError
+)
+
+// String returns the string representation of the OverflowPolicy value.
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowError:
+		return "error"
+	}
+	panic("invalid OverflowPolicy value")
+}
+
+func parseOverflowPolicy(s string) (OverflowPolicy, bool) {
+	for _, p := range []OverflowPolicy{OverflowBlock, OverflowDropOldest, OverflowError} {
+		if p.String() == s {
+			return p, true
+		}
+	}
+	return OverflowBlock, false
+}
+
+// flowControl reads the prefetch and overflow settings from the
+// SUBSCRIBE frame, and removes the header entries that are only
+// meant for the client.
+func flowControl(f *frame.Frame) (prefetch int, overflow OverflowPolicy, err error) {
+	if value, ok := f.Header.Contains(prefetchCountHeader); ok {
+		prefetch, err = strconv.Atoi(value)
+		if err != nil || prefetch <= 0 {
+			return 0, OverflowBlock, ErrInvalidPrefetch
+		}
+	}
+	if value, ok := f.Header.Contains(overflowHeader); ok {
+		f.Header.Del(overflowHeader)
+		if overflow, ok = parseOverflowPolicy(value); !ok {
+			return 0, OverflowBlock, ErrInvalidOverflowPolicy
+		}
+	}
+	return prefetch, overflow, nil
+}
@@ -0,0 +1,64 @@
+package stomp
+
+import (
+	"strconv"
+
+	"github.com/go-stomp/stomp/frame"
+	. "gopkg.in/check.v1"
+)
+
+func (s *StompSuite) TestFlowControl(c *C) {
+	f := frame.New(frame.SUBSCRIBE)
+	c.Assert(SubscribeOpt.Prefetch(10)(f), IsNil)
+	c.Assert(SubscribeOpt.Overflow(OverflowDropOldest)(f), IsNil)
+	c.Check(f.Header.Get(prefetchSizeHeader), Equals, "10")
+
+	prefetch, overflow, err := flowControl(f)
+	c.Assert(err, IsNil)
+	c.Check(prefetch, Equals, 10)
+	c.Check(overflow, Equals, OverflowDropOldest)
+
+	// the overflow policy is not sent to the server
+	_, ok := f.Header.Contains(overflowHeader)
+	c.Check(ok, Equals, false)
+
+	c.Check(SubscribeOpt.Prefetch(0)(f), Equals, ErrInvalidPrefetch)
+	c.Check(SubscribeOpt.Overflow(OverflowPolicy(99))(f), Equals, ErrInvalidOverflowPolicy)
+	c.Check(SubscribeOpt.Prefetch(1)(frame.New(frame.SEND)), Equals, ErrInvalidCommand)
+}
+
+func (s *StompSuite) TestSubscriptionOverflow(c *C) {
+	read := func(overflow OverflowPolicy, n int) []*Message {
+		sub := &Subscription{
+			C:              make(chan *Message),
+			id:             "1",
+			prefetch:       2,
+			overflow:       overflow,
+			controlChannel: make(chan func()),
+		}
+		ch := make(chan *frame.Frame)
+		go sub.readLoop(ch)
+
+		// the subscription keeps reading frames while nobody reads C
+		for i := 0; i < 5; i++ {
+			ch <- frame.New(frame.MESSAGE, frame.Subscription, "1", frame.MessageId, strconv.Itoa(i))
+		}
+
+		var msgs []*Message
+		for i := 0; i < n; i++ {
+			msgs = append(msgs, <-sub.C)
+		}
+		return msgs
+	}
+
+	msgs := read(OverflowDropOldest, 2)
+	c.Assert(msgs, HasLen, 2)
+	c.Check(msgs[0].Header.Get(frame.MessageId), Equals, "3")
+	c.Check(msgs[1].Header.Get(frame.MessageId), Equals, "4")
+
+	msgs = read(OverflowError, 3)
+	c.Assert(msgs, HasLen, 3)
+	c.Check(msgs[0].Header.Get(frame.MessageId), Equals, "0")
+	c.Check(msgs[1].Header.Get(frame.MessageId), Equals, "1")
+	c.Check(msgs[2].Err, Equals, ErrSubscriptionOverflow)
+}
@@ -0,0 +1,105 @@
+package stomp
+
+import (
+	"math/rand"
+	"time"
+)
+
+// ReconnectPolicy controls how often, and for how long, a connection
+// attempts to reach the STOMP server. It applies both to the initial
+// network dial performed by Dial and to re-establishing a connection
+// that has been lost.
+//
+// Between attempts the connection sleeps for a delay that starts at
+// InitialDelay and doubles after every failed attempt, up to MaxDelay.
+type ReconnectPolicy struct {
+	// MaxAttempts is the maximum number of attempts to connect before
+	// giving up. Zero means there is no limit.
+	MaxAttempts int
+
+	// InitialDelay is the delay after the first failed attempt.
+	InitialDelay time.Duration
+
+	// MaxDelay is the upper limit for the delay between attempts.
+	// Zero means there is no limit.
+	MaxDelay time.Duration
+
+	// Jitter is the fraction of the delay, between 0 and 1, that is
+	// added at random to each delay so that many clients do not retry
+	// in lock-step.
+	Jitter float64
+
+	// Timeout is the total time after which the connection gives up,
+	// measured from the first failed attempt. Zero means there is no limit.
+	Timeout time.Duration
+}
+
+// DefaultReconnectPolicy is used when no ConnOpt.Reconnect or
+// ConnOpt.NoReconnect option has been specified. It retries forever.
+var DefaultReconnectPolicy = ReconnectPolicy{
+	InitialDelay: 20 * time.Second,
+	MaxDelay:     secReconLimit * time.Second,
+	Jitter:       0.1,
+}
+
+// noReconnectPolicy makes a single attempt to connect.
+var noReconnectPolicy = ReconnectPolicy{MaxAttempts: 1}
+
+func (p ReconnectPolicy) validate() error {
+	if p.MaxAttempts < 0 || p.InitialDelay < 0 || p.MaxDelay < 0 || p.Timeout < 0 {
+		return ErrInvalidReconnectPolicy
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return ErrInvalidReconnectPolicy
+	}
+	return nil
+}
+
+// Delay returns how long to wait after the given number of failed
+// attempts, the first failed attempt being number one.
+func (p ReconnectPolicy) Delay(attempt int) time.Duration {
+	d := p.InitialDelay
+	for i := 1; i < attempt && (p.MaxDelay == 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		d += time.Duration(rand.Float64() * p.Jitter * float64(d))
+	}
+	return d
+}
+
+// retry keeps track of the attempts made under a reconnect policy.
+type retry struct {
+	policy   ReconnectPolicy
+	attempts int
+	deadline time.Time
+}
+
+func newRetry(policy ReconnectPolicy) *retry {
+	return &retry{policy: policy}
+}
+
+// Failed records a failed attempt. It returns the delay to wait before
+// the next attempt, and false if the policy says to give up instead.
+func (r *retry) Failed() (time.Duration, bool) {
+	r.attempts++
+	if r.attempts == 1 && r.policy.Timeout > 0 {
+		r.deadline = time.Now().Add(r.policy.Timeout)
+	}
+	if r.policy.MaxAttempts > 0 && r.attempts >= r.policy.MaxAttempts {
+		return 0, false
+	}
+	delay := r.policy.Delay(r.attempts)
+	if !r.deadline.IsZero() && time.Now().Add(delay).After(r.deadline) {
+		return 0, false
+	}
+	return delay, true
+}
+
+// Attempts returns the number of failed attempts so far.
+func (r *retry) Attempts() int {
+	return r.attempts
+}
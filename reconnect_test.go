@@ -0,0 +1,114 @@
+package stomp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/go-stomp/stomp/frame"
+	"github.com/go-stomp/stomp/testutil"
+	. "gopkg.in/check.v1"
+)
+
+func (s *StompSuite) TestReconnectPolicyDelay(c *C) {
+	p := ReconnectPolicy{
+		InitialDelay: time.Second,
+		MaxDelay:     5 * time.Second,
+	}
+	c.Check(p.Delay(1), Equals, time.Second)
+	c.Check(p.Delay(2), Equals, 2*time.Second)
+	c.Check(p.Delay(3), Equals, 4*time.Second)
+	c.Check(p.Delay(4), Equals, 5*time.Second)
+	c.Check(p.Delay(100), Equals, 5*time.Second)
+
+	p.Jitter = 0.5
+	for i := 0; i < 20; i++ {
+		d := p.Delay(1)
+		c.Check(d >= time.Second, Equals, true)
+		c.Check(d <= 1500*time.Millisecond, Equals, true)
+	}
+}
+
+func (s *StompSuite) TestReconnectPolicyMaxAttempts(c *C) {
+	r := newRetry(ReconnectPolicy{MaxAttempts: 3, InitialDelay: time.Millisecond})
+
+	_, ok := r.Failed()
+	c.Check(ok, Equals, true)
+	_, ok = r.Failed()
+	c.Check(ok, Equals, true)
+	_, ok = r.Failed()
+	c.Check(ok, Equals, false)
+	c.Check(r.Attempts(), Equals, 3)
+
+	r = newRetry(noReconnectPolicy)
+	_, ok = r.Failed()
+	c.Check(ok, Equals, false)
+}
+
+func (s *StompSuite) TestReconnectPolicyTimeout(c *C) {
+	r := newRetry(ReconnectPolicy{InitialDelay: time.Minute, Timeout: time.Second})
+	_, ok := r.Failed()
+	c.Check(ok, Equals, false)
+
+	r = newRetry(ReconnectPolicy{InitialDelay: time.Millisecond, Timeout: time.Minute})
+	delay, ok := r.Failed()
+	c.Check(ok, Equals, true)
+	c.Check(delay, Equals, time.Millisecond)
+}
+
+func (s *StompSuite) TestReconnectPolicyValidate(c *C) {
+	c.Check(DefaultReconnectPolicy.validate(), IsNil)
+	c.Check(ReconnectPolicy{MaxAttempts: -1}.validate(), Equals, ErrInvalidReconnectPolicy)
+	c.Check(ReconnectPolicy{Jitter: 1.5}.validate(), Equals, ErrInvalidReconnectPolicy)
+}
+
+func (s *StompSuite) TestReconnectStoppedByDisconnect(c *C) {
+	fc1, fc2 := testutil.NewFakeConn(c)
+	conns := make(chan net.Conn, 1)
+	conns <- fc1
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		select {
+		case conn := <-conns:
+			return conn, nil
+		default:
+			return nil, errors.New("connection refused")
+		}
+	}
+
+	go func() {
+		reader := frame.NewReader(fc2)
+		writer := frame.NewWriter(fc2)
+		f, err := reader.Read()
+		c.Assert(err, IsNil)
+		c.Assert(f.Command, Equals, frame.CONNECT)
+		writer.Write(frame.New(frame.CONNECTED, frame.Version, "1.2"))
+		f, err = reader.Read()
+		c.Assert(err, IsNil)
+		c.Assert(f.Command, Equals, frame.SUBSCRIBE)
+		fc2.Close()
+	}()
+
+	events := make(chan Event, 10)
+	conn, err := Dial("fake", "the-server:456",
+		ConnOpt.Dialer(dial),
+		ConnOpt.Reconnect(ReconnectPolicy{InitialDelay: time.Hour}),
+		ConnOpt.OnEvent(func(e Event) { events <- e }))
+	c.Assert(err, IsNil)
+	c.Check((<-events).Type, Equals, EventConnected)
+
+	sub, err := conn.Subscribe("/queue/test", AckAuto)
+	c.Assert(err, IsNil)
+	c.Check((<-events).Type, Equals, EventDisconnected)
+	c.Check((<-events).Type, Equals, EventReconnecting)
+	c.Check(sub.Active(), Equals, true)
+
+	// stops waiting an hour for the next attempt
+	c.Assert(conn.Disconnect(), IsNil)
+	msg := <-sub.C
+	c.Check(msg.Err, NotNil)
+	_, ok := <-sub.C
+	c.Check(ok, Equals, false)
+	c.Check(sub.Active(), Equals, false)
+	c.Check(conn.Send("/queue/test", "text/plain", nil), Equals, ErrAlreadyClosed)
+}
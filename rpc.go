@@ -0,0 +1,175 @@
+package stomp
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-stomp/stomp/frame"
+)
+
+// DefaultReplyPrefix is the prefix of the destination on which
+// Conn.Request receives replies, unless ConnOpt.ReplyTo is specified.
+// Brokers such as ActiveMQ and RabbitMQ create a queue private to the
+// connection for destinations with this prefix.
+const DefaultReplyPrefix = "/temp-queue/"
+
+// replyErrorHeader carries the error returned by a Serve
+// handler back to the program that called Request.
+const replyErrorHeader = "reply-error"
+
+// serveReplyTimeout bounds the sending of a reply by Serve, which is not
+// cut short when Serve is stopping, as the request has been handled.
+const serveReplyTimeout = 10 * time.Second
+
+// A Reply is the response returned by a Serve handler,
+// which is sent to the destination in the reply-to header.
+type Reply struct {
+	ContentType string
+	Body        []byte
+
+	// Optional header entries for the reply.
+	Header *frame.Header
+}
+
+// rpcClient demultiplexes the replies received on the
+// shared reply subscription of a connection.
+type rpcClient struct {
+	mutex   sync.Mutex
+	replyTo string
+	sub     *Subscription
+	calls   map[string]chan *Message // keyed by correlation-id
+}
+
+// Request sends a message to destination with the reply-to and
+// correlation-id headers, and waits for the reply with the same
+// correlation-id. The replies to all requests on a connection are
+// received on a single subscription, created by the first call.
+// Returns ctx.Err() if ctx is done before the reply arrives, and an
+// Error if the handler that served the request failed.
+func (c *Conn) Request(ctx context.Context, destination, contentType string, body []byte, opts ...func(*frame.Frame) error) (*Message, error) {
+	rpc, err := c.rpcClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	id := allocateId()
+	ch := make(chan *Message, 1)
+	rpc.mutex.Lock()
+	rpc.calls[id] = ch
+	rpc.mutex.Unlock()
+	defer func() {
+		rpc.mutex.Lock()
+		delete(rpc.calls, id)
+		rpc.mutex.Unlock()
+	}()
+
+	opts = append(opts,
+		SendOpt.Header(frame.ReplyTo, rpc.replyTo),
+		SendOpt.Header(frame.CorrelationId, id))
+	if err := c.SendContext(ctx, destination, contentType, body, opts...); err != nil {
+		return nil, err
+	}
+
+	select {
+	case msg := <-ch:
+		if text, ok := msg.Header.Contains(replyErrorHeader); ok {
+			return msg, newErrorMessage(text)
+		}
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// rpcClient returns the reply subscription of
+// the connection, creating it if necessary.
+func (c *Conn) rpcClient(ctx context.Context) (*rpcClient, error) {
+	c.rpcMutex.Lock()
+	defer c.rpcMutex.Unlock()
+	if c.rpc != nil {
+		return c.rpc, nil
+	}
+
+	replyTo := c.options.ReplyTo
+	if replyTo == "" {
+		replyTo = DefaultReplyPrefix + "rpc." + allocateId()
+	}
+	sub, err := c.SubscribeContext(ctx, replyTo, AckAuto)
+	if err != nil {
+		return nil, err
+	}
+
+	c.rpc = &rpcClient{
+		replyTo: replyTo,
+		sub:     sub,
+		calls:   make(map[string]chan *Message),
+	}
+	go c.rpc.readLoop()
+	return c.rpc, nil
+}
+
+// readLoop passes each reply to the Request waiting for it.
+func (rpc *rpcClient) readLoop() {
+	for msg := range rpc.sub.C {
+		if msg.Err != nil {
+			log.Errorf("reply %s: %s", rpc.replyTo, msg.Err.Error())
+			continue
+		}
+		id := msg.Header.Get(frame.CorrelationId)
+		rpc.mutex.Lock()
+		ch, ok := rpc.calls[id]
+		delete(rpc.calls, id)
+		rpc.mutex.Unlock()
+		if !ok {
+			log.Errorf("reply %s: ignored reply with correlation-id %q", rpc.replyTo, id)
+			continue
+		}
+		ch <- msg
+	}
+}
+
+// Serve subscribes to destination and calls handler for each request
+// received, until ctx is done. The reply returned by handler is sent to the
+// destination in the reply-to header of the request, with the same
+// correlation-id. If handler returns an error, the reply carries the error
+// instead, which is returned by Request. If handler returns a nil Reply and
+// a nil error, no reply is sent. Options are as described for Consume.
+//
+// A request is acknowledged once it has been answered, even if the answer
+// is an error, as delivering it again would answer the requester twice.
+// It is negatively acknowledged only if the reply cannot be sent. Requests
+// without a reply-to header cannot be answered, and are acknowledged
+// without calling handler. A handler still running when ctx is done
+// gets its reply sent, and its request acknowledged, before Serve returns.
+func (c *Conn) Serve(ctx context.Context, destination string, handler func(*Message) (*Reply, error), opts ...func(*consumeOptions) error) error {
+	return c.Consume(ctx, destination, func(ctx context.Context, msg *Message) error {
+		replyTo, ok := msg.Header.Contains(frame.ReplyTo)
+		if !ok {
+			log.Errorf("serve %s: request without reply-to", destination)
+			return nil
+		}
+
+		reply, err := handler(msg)
+		var replyOpts []func(*frame.Frame) error
+		if err != nil {
+			reply = &Reply{}
+			replyOpts = append(replyOpts, SendOpt.Header(replyErrorHeader, err.Error()))
+		} else if reply == nil {
+			return nil
+		}
+		if id, ok := msg.Header.Contains(frame.CorrelationId); ok {
+			replyOpts = append(replyOpts, SendOpt.Header(frame.CorrelationId, id))
+		}
+		if reply.Header != nil {
+			for i := 0; i < reply.Header.Len(); i++ {
+				replyOpts = append(replyOpts, SendOpt.Header(reply.Header.GetAt(i)))
+			}
+		}
+
+		// ctx is done once Serve is stopping, even for the handlers it drains
+		sendCtx, cancel := context.WithTimeout(context.Background(), serveReplyTimeout)
+		defer cancel()
+		return c.SendContext(sendCtx, replyTo, reply.ContentType, reply.Body, replyOpts...)
+	}, opts...)
+}
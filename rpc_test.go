@@ -0,0 +1,150 @@
+package stomp
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-stomp/stomp/frame"
+	. "gopkg.in/check.v1"
+)
+
+func (s *StompSuite) TestRequestServe(c *C) {
+	// a broker that delivers each message to the subscription
+	// for its destination, on the same connection
+	conn, rw := connectHelper(c, V12)
+	defer rw.Close()
+
+	go func() {
+		subs := make(map[string]string)
+		for {
+			f, err := rw.Read()
+			if err != nil {
+				return
+			}
+			switch f.Command {
+			case frame.SUBSCRIBE:
+				subs[f.Header.Get(frame.Destination)] = f.Header.Get(frame.Id)
+			case frame.SEND:
+				msg := &frame.Frame{Command: frame.MESSAGE, Header: f.Header.Clone(), Body: f.Body}
+				msg.Header.Set(frame.Subscription, subs[f.Header.Get(frame.Destination)])
+				msg.Header.Set(frame.MessageId, allocateId())
+				rw.Write(msg)
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go conn.Serve(ctx, "/queue/upper", func(msg *Message) (*Reply, error) {
+		if len(msg.Body) == 0 {
+			return nil, errors.New("empty request")
+		}
+		return &Reply{ContentType: "text/plain", Body: []byte(strings.ToUpper(string(msg.Body)))}, nil
+	}, ConsumeOpt.AckMode(AckAuto))
+
+	// retry until Serve has subscribed
+	var reply *Message
+	var err error
+	for i := 0; i < 50; i++ {
+		reqCtx, reqCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		reply, err = conn.Request(reqCtx, "/queue/upper", "text/plain", []byte("hello"))
+		reqCancel()
+		if err != context.DeadlineExceeded {
+			break
+		}
+	}
+	c.Assert(err, IsNil)
+	c.Check(string(reply.Body), Equals, "HELLO")
+	c.Check(strings.HasPrefix(reply.Destination, DefaultReplyPrefix), Equals, true)
+
+	_, err = conn.Request(ctx, "/queue/upper", "text/plain", nil)
+	c.Assert(err, NotNil)
+	c.Check(err.Error(), Equals, "empty request")
+}
+
+func (s *StompSuite) TestServeAcksErrorReply(c *C) {
+	conn, rw := connectHelper(c, V12)
+	defer rw.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go conn.Serve(ctx, "/queue/upper", func(msg *Message) (*Reply, error) {
+		return nil, errors.New("empty request")
+	}, ConsumeOpt.AckMode(AckClientIndividual))
+
+	f, err := rw.Read()
+	c.Assert(err, IsNil)
+	c.Assert(f.Command, Equals, frame.SUBSCRIBE)
+	rw.Write(frame.New(frame.MESSAGE,
+		frame.Subscription, f.Header.Get(frame.Id),
+		frame.MessageId, "m1",
+		frame.Ack, "a1",
+		frame.Destination, "/queue/upper",
+		frame.ReplyTo, "/queue/reply",
+		frame.CorrelationId, "c1"))
+
+	// the requester is answered with the error, so the request is acknowledged
+	f, err = rw.Read()
+	c.Assert(err, IsNil)
+	c.Check(f.Command, Equals, frame.SEND)
+	c.Check(f.Header.Get(frame.Destination), Equals, "/queue/reply")
+	c.Check(f.Header.Get(frame.CorrelationId), Equals, "c1")
+	c.Check(f.Header.Get(replyErrorHeader), Equals, "empty request")
+	f, err = rw.Read()
+	c.Assert(err, IsNil)
+	c.Check(f.Command, Equals, frame.ACK)
+	c.Check(f.Header.Get(frame.Id), Equals, "a1")
+}
+
+func (s *StompSuite) TestServeRepliesWhileStopping(c *C) {
+	conn, rw := connectHelper(c, V12)
+	defer rw.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	handling := make(chan struct{})
+	release := make(chan struct{})
+	served := make(chan error, 1)
+	go func() {
+		served <- conn.Serve(ctx, "/queue/upper", func(msg *Message) (*Reply, error) {
+			close(handling)
+			<-release
+			return &Reply{ContentType: "text/plain", Body: []byte("HELLO")}, nil
+		}, ConsumeOpt.AckMode(AckClientIndividual))
+	}()
+
+	f, err := rw.Read()
+	c.Assert(err, IsNil)
+	c.Assert(f.Command, Equals, frame.SUBSCRIBE)
+	rw.Write(frame.New(frame.MESSAGE,
+		frame.Subscription, f.Header.Get(frame.Id),
+		frame.MessageId, "m1",
+		frame.Ack, "a1",
+		frame.Destination, "/queue/upper",
+		frame.ReplyTo, "/queue/reply",
+		frame.CorrelationId, "c1"))
+
+	// Serve is stopped while the handler is running
+	<-handling
+	cancel()
+	close(release)
+
+	// the reply is sent and the request acknowledged, not delivered again
+	var commands []string
+	for len(commands) < 2 {
+		f, err = rw.Read()
+		c.Assert(err, IsNil)
+		if f.Command == frame.UNSUBSCRIBE {
+			continue
+		}
+		c.Assert(f.Command, Not(Equals), frame.NACK)
+		commands = append(commands, f.Command)
+		if f.Command == frame.SEND {
+			c.Check(string(f.Body), Equals, "HELLO")
+			c.Check(f.Header.Get(frame.CorrelationId), Equals, "c1")
+		}
+	}
+	c.Check(commands, DeepEquals, []string{frame.SEND, frame.ACK})
+	c.Check(<-served, IsNil)
+}
@@ -15,7 +15,8 @@ var SendOpt struct {
 	// entry is always included, but some message brokers assign special
 	// meaning to STOMP frames that do not contain a content-length
 	// header entry. (In particular ActiveMQ interprets STOMP frames
-	// with no content-length as being a text message)
+	// with no content-length as being a text message). A compressed
+	// body always has a content-length, whatever the order of the options.
 	NoContentLength func(*frame.Frame) error
 
 	// Header provides the opportunity to include custom header entries
@@ -23,6 +24,12 @@ var SendOpt struct {
 	// can be specified multiple times if multiple custom header entries
 	// are required.
 	Header func(key, value string) func(*frame.Frame) error
+
+	// Compress compresses the message body with the named algorithm, such
+	// as EncodingGzip, and sets the content-encoding header entry so that
+	// the receiving client can decompress it. Other algorithms can be made
+	// available with RegisterCompressor.
+	Compress func(encoding string) func(*frame.Frame) error
 }
 
 func init() {
@@ -39,6 +46,9 @@ func init() {
 		if f.Command != frame.SEND {
 			return ErrInvalidCommand
 		}
+		if _, ok := f.Header.Contains(frame.ContentEncoding); ok {
+			return nil
+		}
 		f.Header.Del(frame.ContentLength)
 		return nil
 	}
@@ -52,4 +62,13 @@ func init() {
 			return nil
 		}
 	}
+
+	SendOpt.Compress = func(encoding string) func(*frame.Frame) error {
+		return func(f *frame.Frame) error {
+			if f.Command != frame.SEND {
+				return ErrInvalidCommand
+			}
+			return compressBody(f, encoding)
+		}
+	}
 }
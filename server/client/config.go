@@ -7,9 +7,23 @@ import (
 // Contains information the client package needs from the
 // rest of the STOMP server code.
 type Config interface {
-	// Method to authenticate a login and associated passcode.
-	// Returns true if login/passcode is valid, false otherwise.
-	Authenticate(login, passcode string) bool
+	// Returns the virtual host of a connection, from the host header
+	// of its CONNECT frame, or false if the host is unknown.
+	VirtualHost(host string) (string, bool)
+
+	// Method to authenticate a login and associated passcode for a
+	// virtual host. Returns true if login/passcode is valid, false otherwise.
+	Authenticate(vhost, login, passcode string) bool
+
+	// Reserves a connection to a virtual host. Returns false if the virtual
+	// host has as many connections as it allows. A connection that is
+	// reserved is released by ReleaseConnection when it closes.
+	ReserveConnection(vhost string) bool
+	ReleaseConnection(vhost string)
+
+	// Maximum number of subscriptions of a connection to a
+	// virtual host. If this returns zero, there is no limit.
+	MaxSubscriptions(vhost string) int
 
 	// Default duration for read/write heart-beat values. If this
 	// returns zero, no heart-beat will take place. If this value is
@@ -30,4 +44,8 @@ type Config interface {
 	// up with the server, we do not want the server to backlog
 	// pending frames indefinitely.
 	MaxPendingWrites() int
+
+	// Returns an error if the server cannot send messages to
+	// a destination, or subscribe to it if subscribe is true.
+	CheckDestination(destination string, subscribe bool) error
 }
@@ -5,10 +5,12 @@ import (
 	"io"
 	"net"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-stomp/stomp"
 	"github.com/go-stomp/stomp/frame"
+	"github.com/go-stomp/stomp/server/selector"
 	"github.com/go-stomp/stomp/server/status"
 	"github.com/ventu-io/slf"
 )
@@ -29,6 +31,9 @@ type Conn struct {
 	version               stomp.Version                       // Negotiated STOMP protocol version
 	id                    int64
 	login                 string
+	clientId              string // identifies the client across connections
+	vhost                 string // virtual host, from the host header of CONNECT
+	reserved              bool   // has a connection to the virtual host been reserved
 	peer                  string
 	peer_name             string
 	time                  time.Time
@@ -79,6 +84,18 @@ func (c *Conn) Id() int64 {
 	return c.id
 }
 
+// VirtualHost returns the virtual host that the client connected to,
+// which is empty if the server has no virtual hosts.
+func (c *Conn) VirtualHost() string {
+	return c.vhost
+}
+
+// ClientId returns the value of the client-id header of the CONNECT
+// frame, which identifies the owner of durable subscriptions.
+func (c *Conn) ClientId() string {
+	return c.clientId
+}
+
 //get client connection status
 func (c *Conn) GetStatus() *status.ServerClientStatus {
 	subscriptions := make([]status.ServerClientSubscriptionStatus, 0)
@@ -92,6 +109,8 @@ func (c *Conn) GetStatus() *status.ServerClientStatus {
 		ID:                    c.id,
 		Address:               c.rw.RemoteAddr().String(),
 		Login:                 c.login,
+		ClientId:              c.clientId,
+		VirtualHost:           c.vhost,
 		Peer:                  c.peer,
 		PeerName:              c.peer_name,
 		Time:                  c.time.Format(time.RFC3339),
@@ -399,7 +418,7 @@ func (c *Conn) processLoop() {
 				}
 			} else {
 				// Subscription no longer exists, requeue
-				c.sendProcessorRequest(Request{Op: RequeueOp, Frame: sub.frame})
+				c.sendProcessorRequest(Request{Op: RequeueOp, Frame: sub.frame, Sub: sub})
 			}
 
 		case _ = <-timerChannel:
@@ -445,7 +464,7 @@ func (c *Conn) cleanupConn() {
 	// Every subscription requiring acknowledgement has a frame
 	// that needs to be requeued in the upper layer
 	for sub := c.subList.Get(); sub != nil; sub = c.subList.Get() {
-		c.sendProcessorRequest(Request{Op: RequeueOp, Frame: sub.frame})
+		c.sendProcessorRequest(Request{Op: RequeueOp, Frame: sub.frame, Sub: sub})
 	}
 
 	// empty the subscription and write queue
@@ -455,6 +474,11 @@ func (c *Conn) cleanupConn() {
 	// Tell the upper layer we are now disconnected
 	c.sendProcessorRequest(Request{Op: DisconnectedOp, Conn: c})
 
+	if c.reserved {
+		c.config.ReleaseConnection(c.vhost)
+		c.reserved = false
+	}
+
 	// empty the subscription and write queue one more time
 	c.discardWriteChannelFrames()
 	c.cleanupSubChannel()
@@ -491,7 +515,7 @@ func (c *Conn) cleanupSubChannel() {
 			if !ok {
 				finished = true
 			} else {
-				c.sendProcessorRequest(Request{Op: RequeueOp, Frame: sub.frame})
+				c.sendProcessorRequest(Request{Op: RequeueOp, Frame: sub.frame, Sub: sub})
 			}
 
 		default:
@@ -567,11 +591,18 @@ func (c *Conn) handleConnect(f *frame.Frame) error {
 		return receiptInConnect
 	}
 
+	host, _ := f.Header.Contains(frame.Host)
+	vhost, ok := c.config.VirtualHost(host)
+	if !ok {
+		c.log.Errorf("unknown virtual host %v", f.Dump())
+		return unknownVirtualHost
+	}
+
 	// if either of these fields are absent, pass nil to the
 	// authenticator function.
 	login, _ := f.Header.Contains(frame.Login)
 	passcode, _ := f.Header.Contains(frame.Passcode)
-	if !c.config.Authenticate(login, passcode) {
+	if !c.config.Authenticate(vhost, login, passcode) {
 		// sleep to slow down a rogue client a little bit
 		c.log.Errorf("authentication failed %v", f.Dump())
 		time.Sleep(time.Second)
@@ -582,6 +613,14 @@ func (c *Conn) handleConnect(f *frame.Frame) error {
 			"login": login,
 			"id":    c.id})
 	c.login = login
+	c.clientId, _ = f.Header.Contains(frame.ClientId)
+	if strings.Contains(c.clientId, "/") {
+		// the client-id is part of the name of durable queues, where
+		// a '/' would make "a/b"+"c" and "a"+"b/c" the same queue
+		c.log.Errorf("invalid client-id %v", f.Dump())
+		return invalidClientId
+	}
+	c.vhost = vhost
 	c.peer = ""
 	c.peer_name = ""
 
@@ -626,6 +665,12 @@ func (c *Conn) handleConnect(f *frame.Frame) error {
 	// go-routine
 	c.writeTimeout = time.Duration(cy) * time.Millisecond
 
+	if !c.config.ReserveConnection(vhost) {
+		c.log.Errorf("too many connections to virtual host %q", vhost)
+		return tooManyConnections
+	}
+	c.reserved = true
+
 	response := frame.New(frame.CONNECTED,
 		frame.Version, string(c.version),
 		frame.Server, "stompd/x.y.z", // TODO: get version
@@ -744,18 +789,42 @@ func (c *Conn) handleSubscribe(f *frame.Frame) error {
 	if !ok {
 		return missingHeader(frame.Destination)
 	}
+	if err := c.config.CheckDestination(dest, true); err != nil {
+		return err
+	}
 
 	ack, ok := f.Header.Contains(frame.Ack)
 	if !ok {
 		ack = frame.AckAuto
 	}
 
+	// a durable subscription outlives the connection, and is
+	// identified by the client-id of the CONNECT frame
+	durable, ok := f.Header.Contains(frame.DurableSubscriptionName)
+	if ok && c.clientId == "" {
+		return durableWithoutClientId
+	}
+
+	// the selector is compiled once, and evaluated for every message
+	var sel *selector.Selector
+	if text, ok := f.Header.Contains(frame.Selector); ok {
+		var err error
+		if sel, err = selector.Parse(text); err != nil {
+			return invalidSelector(err)
+		}
+	}
+
 	sub, ok := c.subs[id]
 	if ok {
 		return subscriptionExists
 	}
+	if max := c.config.MaxSubscriptions(c.vhost); max > 0 && len(c.subs) >= max {
+		return tooManySubscriptions
+	}
 
 	sub = newSubscription(c, dest, id, ack)
+	sub.durable = durable
+	sub.selector = sel
 	c.subs[id] = sub
 
 	// send information about new subscription to upper layer
@@ -857,7 +926,7 @@ func (c *Conn) handleNack(f *frame.Frame) error {
 		// handle any subscriptions that are acknowledged by this msg
 		c.subList.Nack(msgId64, func(s *Subscription) {
 			// send frame back to upper layer for requeue
-			c.sendProcessorRequest(Request{Op: RequeueOp, Frame: s.frame})
+			c.sendProcessorRequest(Request{Op: RequeueOp, Frame: s.frame, Sub: s})
 
 			// remove frame from the subscription, it has been requeued
 			s.frame = nil
@@ -880,6 +949,26 @@ func (c *Conn) handleSend(f *frame.Frame) error {
 		return err
 	}
 
+	// the trace context is forwarded with the message, unless it is invalid
+	if traceparent, ok := f.Header.Contains(frame.TraceParent); !ok || !stomp.ValidTraceParent(traceparent) {
+		f.Header.Del(frame.TraceParent)
+		f.Header.Del(frame.TraceState)
+	}
+
+	removeServerHeaders(f)
+
+	now := time.Now()
+	if err := convertTtl(f, now); err != nil {
+		return err
+	}
+	if err := convertDelay(f, now); err != nil {
+		return err
+	}
+
+	if err := c.config.CheckDestination(f.Header.Get(frame.Destination), false); err != nil {
+		return err
+	}
+
 	if tx, ok := f.Header.Contains(frame.Transaction); ok {
 		// the transaction header is removed from the frame
 		err = c.txStore.Add(tx, f)
@@ -890,7 +979,7 @@ func (c *Conn) handleSend(f *frame.Frame) error {
 		// not in a transaction
 		// change from SEND to MESSAGE
 		f.Command = frame.MESSAGE
-		c.sendProcessorRequest(Request{Op: EnqueueOp, Frame: f})
+		c.sendProcessorRequest(Request{Op: EnqueueOp, Frame: f, Conn: c})
 	}
 
 	return nil
@@ -19,6 +19,11 @@ const (
 	invalidOperationForFrame = errorMessage("invalid operation for frame")
 	exceededMaxFrameSize     = errorMessage("exceeded max frame size")
 	invalidHeaderValue       = errorMessage("invalid header value")
+	durableWithoutClientId   = errorMessage("durable subscription requires client-id header in CONNECT frame")
+	invalidClientId          = errorMessage("client-id must not contain '/'")
+	unknownVirtualHost       = errorMessage("unknown virtual host")
+	tooManyConnections       = errorMessage("too many connections to virtual host")
+	tooManySubscriptions     = errorMessage("too many subscriptions")
 )
 
 type errorMessage string
@@ -31,6 +36,10 @@ func missingHeader(name string) errorMessage {
 	return errorMessage("missing header: " + name)
 }
 
+func invalidSelector(err error) errorMessage {
+	return errorMessage("invalid selector: " + err.Error())
+}
+
 func prohibitedHeader(name string) errorMessage {
 	return errorMessage("prohibited header: " + name)
 }
@@ -5,6 +5,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-stomp/stomp"
 	"github.com/go-stomp/stomp/frame"
@@ -122,3 +123,68 @@ func getHeartBeat(f *frame.Frame) (cx, cy int, err error) {
 	//log.Debugf("getHeartBeat: %s %d %d", f.Command, cx, cy)
 	return
 }
+
+// Headers that the server sets on the messages it delivers to count
+// deliveries and explain dead letters. They are removed from SEND frames,
+// so that a client cannot defeat the redelivery limit of a queue.
+var serverHeaders = []string{
+	frame.DeliveryCount,
+	frame.Redelivered,
+	frame.DeadLetterReason,
+}
+
+// Remove the headers set by the server from a SEND frame.
+func removeServerHeaders(f *frame.Frame) {
+	for _, key := range serverHeaders {
+		f.Header.Del(key)
+	}
+}
+
+// Replace the ttl header of a SEND frame, in milliseconds, with an expires
+// header, which is the time the message expires in milliseconds since the
+// Unix epoch. An expires header already in the frame takes precedence.
+// A ttl of zero means the message does not expire.
+func convertTtl(f *frame.Frame, now time.Time) error {
+	value, ok := f.Header.Contains(frame.Ttl)
+	if !ok {
+		return nil
+	}
+	ttl, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ttl < 0 {
+		return invalidHeaderValue
+	}
+	f.Header.Del(frame.Ttl)
+	if _, ok := f.Header.Contains(frame.Expires); ok || ttl == 0 {
+		return nil
+	}
+	expires := now.UnixNano()/int64(time.Millisecond) + ttl
+	f.Header.Set(frame.Expires, strconv.FormatInt(expires, 10))
+	return nil
+}
+
+// Replace the delay header of a SEND frame, in milliseconds, with a
+// deliver-at header, which is the time the message is delivered in
+// milliseconds since the Unix epoch. A deliver-at header already in the
+// frame takes precedence, and must be a valid time.
+func convertDelay(f *frame.Frame, now time.Time) error {
+	if value, ok := f.Header.Contains(frame.DeliverAt); ok {
+		if at, err := strconv.ParseInt(value, 10, 64); err != nil || at < 0 {
+			return invalidHeaderValue
+		}
+	}
+	value, ok := f.Header.Contains(frame.Delay)
+	if !ok {
+		return nil
+	}
+	delay, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || delay < 0 {
+		return invalidHeaderValue
+	}
+	f.Header.Del(frame.Delay)
+	if _, ok := f.Header.Contains(frame.DeliverAt); ok || delay == 0 {
+		return nil
+	}
+	at := now.UnixNano()/int64(time.Millisecond) + delay
+	f.Header.Set(frame.DeliverAt, strconv.FormatInt(at, 10))
+	return nil
+}
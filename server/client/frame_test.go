@@ -1,6 +1,8 @@
 package client
 
 import (
+	"time"
+
 	"github.com/go-stomp/stomp"
 	"github.com/go-stomp/stomp/frame"
 	. "gopkg.in/check.v1"
@@ -80,3 +82,64 @@ func (s *FrameSuite) TestHeartBeat(c *C) {
 	_, _, err = getHeartBeat(f)
 	c.Check(err, Equals, invalidOperationForFrame)
 }
+
+func (s *FrameSuite) TestConvertTtl(c *C) {
+	now := time.Unix(1000, 0)
+
+	f := frame.New(frame.SEND, frame.Ttl, "1500")
+	c.Assert(convertTtl(f, now), IsNil)
+	c.Check(f.Header.Get(frame.Expires), Equals, "1001500")
+	_, ok := f.Header.Contains(frame.Ttl)
+	c.Check(ok, Equals, false)
+
+	// expires takes precedence
+	f = frame.New(frame.SEND, frame.Ttl, "1500", frame.Expires, "5")
+	c.Assert(convertTtl(f, now), IsNil)
+	c.Check(f.Header.Get(frame.Expires), Equals, "5")
+
+	f = frame.New(frame.SEND, frame.Ttl, "0")
+	c.Assert(convertTtl(f, now), IsNil)
+	_, ok = f.Header.Contains(frame.Expires)
+	c.Check(ok, Equals, false)
+
+	f = frame.New(frame.SEND, frame.Ttl, "soon")
+	c.Check(convertTtl(f, now), Equals, invalidHeaderValue)
+}
+
+func (s *FrameSuite) TestConvertDelay(c *C) {
+	now := time.Unix(1000, 0)
+
+	f := frame.New(frame.SEND, frame.Delay, "250")
+	c.Assert(convertDelay(f, now), IsNil)
+	c.Check(f.Header.Get(frame.DeliverAt), Equals, "1000250")
+	_, ok := f.Header.Contains(frame.Delay)
+	c.Check(ok, Equals, false)
+
+	// deliver-at takes precedence
+	f = frame.New(frame.SEND, frame.Delay, "250", frame.DeliverAt, "2000000")
+	c.Assert(convertDelay(f, now), IsNil)
+	c.Check(f.Header.Get(frame.DeliverAt), Equals, "2000000")
+
+	f = frame.New(frame.SEND, frame.Delay, "0")
+	c.Assert(convertDelay(f, now), IsNil)
+	_, ok = f.Header.Contains(frame.DeliverAt)
+	c.Check(ok, Equals, false)
+
+	f = frame.New(frame.SEND, frame.Delay, "later")
+	c.Check(convertDelay(f, now), Equals, invalidHeaderValue)
+
+	f = frame.New(frame.SEND, frame.DeliverAt, "tomorrow")
+	c.Check(convertDelay(f, now), Equals, invalidHeaderValue)
+}
+
+func (s *FrameSuite) TestRemoveServerHeaders(c *C) {
+	f := frame.New(frame.SEND,
+		frame.Destination, "/queue/test",
+		frame.DeliveryCount, "99",
+		frame.Redelivered, "true",
+		frame.DeadLetterReason, "none",
+		frame.DeliveryCount, "98")
+	removeServerHeaders(f)
+	c.Check(f.Header.Len(), Equals, 1)
+	c.Check(f.Header.Get(frame.Destination), Equals, "/queue/test")
+}
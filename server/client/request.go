@@ -26,7 +26,7 @@ const (
 // Client requests received to be processed by main processing loop
 type Request struct {
 	Op    RequestOp     // opcode for request
-	Sub   *Subscription // SubscribeOp, UnsubscribeOp
+	Sub   *Subscription // SubscribeOp, UnsubscribeOp, RequeueOp
 	Frame *frame.Frame  // EnqueueOp, RequeueOp
-	Conn  *Conn         // ConnectedOp, DisconnectedOp
+	Conn  *Conn         // EnqueueOp, ConnectedOp, DisconnectedOp
 }
@@ -2,18 +2,21 @@ package client
 
 import (
 	"github.com/go-stomp/stomp/frame"
+	"github.com/go-stomp/stomp/server/selector"
 	"github.com/ventu-io/slf"
 )
 
 type Subscription struct {
-	conn    *Conn
-	dest    string
-	id      string            // client's subscription id
-	ack     string            // auto, client, client-individual
-	msgId   uint64            // message-id (or ack) for acknowledgement
-	subList *SubscriptionList // am I in a list
-	frame   *frame.Frame      // message allocated to subscription
-	log     slf.StructuredLogger
+	conn     *Conn
+	dest     string
+	id       string             // client's subscription id
+	durable  string             // durable subscription name, if any
+	selector *selector.Selector // selects the messages sent, if any
+	ack      string             // auto, client, client-individual
+	msgId    uint64             // message-id (or ack) for acknowledgement
+	subList  *SubscriptionList  // am I in a list
+	frame    *frame.Frame       // message allocated to subscription
+	log      slf.StructuredLogger
 }
 
 func newSubscription(c *Conn, dest string, id string, ack string) *Subscription {
@@ -30,6 +33,35 @@ func (s *Subscription) Destination() string {
 	return s.dest
 }
 
+// DurableName returns the name of the durable subscription, or an empty
+// string if the subscription ends when the client disconnects.
+func (s *Subscription) DurableName() string {
+	return s.durable
+}
+
+// Selector returns the message selector of the subscription,
+// or nil if it receives every message.
+func (s *Subscription) Selector() *selector.Selector {
+	return s.selector
+}
+
+// Matches reports whether a message frame is selected for
+// the subscription.
+func (s *Subscription) Matches(f *frame.Frame) bool {
+	return s.selector == nil || s.selector.Matches(f)
+}
+
+// VirtualHost returns the virtual host of the connection
+// that owns the subscription.
+func (s *Subscription) VirtualHost() string {
+	return s.conn.VirtualHost()
+}
+
+// ClientId returns the client-id of the connection that owns the subscription.
+func (s *Subscription) ClientId() string {
+	return s.conn.ClientId()
+}
+
 func (s *Subscription) Ack() string {
 	return s.ack
 }
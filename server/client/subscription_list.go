@@ -2,6 +2,8 @@ package client
 
 import (
 	"container/list"
+
+	"github.com/go-stomp/stomp/frame"
 )
 
 // Maintains a list of subscriptions. Not thread-safe.
@@ -45,6 +47,20 @@ func (sl *SubscriptionList) Get() *Subscription {
 	return sub
 }
 
+// Gets the first subscription in the list that selects the frame, or nil
+// if there is none. The subscription is removed from the list.
+func (sl *SubscriptionList) GetMatching(f *frame.Frame) *Subscription {
+	for e := sl.subs.Front(); e != nil; e = e.Next() {
+		sub := e.Value.(*Subscription)
+		if sub.Matches(f) {
+			sl.subs.Remove(e)
+			sub.subList = nil
+			return sub
+		}
+	}
+	return nil
+}
+
 // Removes the subscription from the list.
 func (sl *SubscriptionList) Remove(s *Subscription) {
 	for e := sl.subs.Front(); e != nil; e = e.Next() {
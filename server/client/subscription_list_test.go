@@ -1,6 +1,8 @@
 package client
 
 import (
+	"github.com/go-stomp/stomp/frame"
+	"github.com/go-stomp/stomp/server/selector"
 	. "gopkg.in/check.v1"
 )
 
@@ -30,6 +32,26 @@ func (s *SubscriptionListSuite) TestAddAndGet(c *C) {
 	c.Check(sl.Get(), IsNil)
 }
 
+func (s *SubscriptionListSuite) TestGetMatching(c *C) {
+	sub1 := newSubscription(nil, "/dest", "1", "client")
+	sub1.selector, _ = selector.Parse("region = 'us'")
+	sub2 := newSubscription(nil, "/dest", "2", "client")
+	sub2.selector, _ = selector.Parse("region = 'eu'")
+	sub3 := newSubscription(nil, "/dest", "3", "client")
+
+	sl := NewSubscriptionList()
+	sl.Add(sub1)
+	sl.Add(sub2)
+	sl.Add(sub3)
+
+	eu := frame.New(frame.MESSAGE, "region", "eu")
+	c.Check(sl.GetMatching(eu), Equals, sub2)
+	c.Check(sl.GetMatching(eu), Equals, sub3)
+	c.Check(sl.GetMatching(eu), IsNil)
+	c.Check(sl.Len(), Equals, 1)
+	c.Check(sl.GetMatching(frame.New(frame.MESSAGE, "region", "us")), Equals, sub1)
+}
+
 func (s *SubscriptionListSuite) TestAddAndRemove(c *C) {
 	sub1 := newSubscription(nil, "/dest", "1", "client")
 	sub2 := newSubscription(nil, "/dest", "2", "client")
@@ -0,0 +1,535 @@
+/*
+Package kvstore provides a small embedded key-value store kept in a single
+file, using only the standard library.
+
+Keys are grouped in buckets and kept in byte order within a bucket. The
+whole store is held in memory; the file is a log of puts and deletes that
+is replayed by Open and rewritten when most of it is obsolete.
+
+Since every key and value stays in memory while the store is open, a store
+can hold no more than the memory of the process allows, and Open reads the
+whole file. It suits stores of modest size, such as the messages that are
+waiting in queues, not archives.
+*/
+package kvstore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ventu-io/slf"
+)
+
+var log slf.StructuredLogger
+
+func init() {
+	log = slf.WithContext("kvstore")
+}
+
+var (
+	ErrClosed   = errors.New("kvstore: closed")
+	ErrReadOnly = errors.New("kvstore: read-only")
+	ErrCorrupt  = errors.New("kvstore: invalid file")
+)
+
+// Written at the start of the file.
+var magic = []byte("STOMPKV1")
+
+// Operations recorded in the file.
+const (
+	opPut          byte = 'P'
+	opDelete       byte = 'D'
+	opDeleteBucket byte = 'B'
+)
+
+const recordHeader = 8 // length and CRC-32 of the record, 4 bytes each
+
+// The file is rewritten when it has more than this many obsolete
+// records, and more obsolete records than live ones.
+const compactThreshold = 1024
+
+// Options for opening a store.
+type Options struct {
+	// NoSync skips syncing the file after every write, which is faster
+	// but can lose the latest writes if the system crashes.
+	NoSync bool
+
+	// ReadOnly opens the store without modifying the file, not even to
+	// truncate an incomplete record at its end.
+	ReadOnly bool
+}
+
+// DB is a key-value store. It is safe for concurrent use.
+type DB struct {
+	path     string
+	options  Options
+	mutex    sync.RWMutex
+	file     *os.File
+	size     int64
+	buckets  map[string]*bucket
+	live     int // records needed to rebuild the current contents
+	obsolete int // records that are no longer needed
+}
+
+type bucket struct {
+	keys   []string // sorted
+	values map[string][]byte
+}
+
+// prefix returns the range of indexes of the keys that start with prefix.
+func (b *bucket) prefix(prefix string) (i, j int) {
+	i = sort.SearchStrings(b.keys, prefix)
+	j = i + sort.Search(len(b.keys)-i, func(k int) bool {
+		return !strings.HasPrefix(b.keys[i+k], prefix)
+	})
+	return i, j
+}
+
+// Open opens the store in the file at path, creating it if necessary
+// unless options.ReadOnly is set.
+func Open(path string, options Options) (*DB, error) {
+	flag := os.O_RDWR | os.O_CREATE
+	if options.ReadOnly {
+		flag = os.O_RDONLY
+	}
+	file, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{
+		path:    path,
+		options: options,
+		file:    file,
+		buckets: make(map[string]*bucket),
+	}
+	if err := db.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Close closes the file of the store.
+func (db *DB) Close() error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	if db.file == nil {
+		return ErrClosed
+	}
+	err := db.file.Close()
+	db.file = nil
+	return err
+}
+
+// Get returns the value of a key in a bucket.
+func (db *DB) Get(name string, key []byte) ([]byte, bool) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	b, ok := db.buckets[name]
+	if !ok {
+		return nil, false
+	}
+	value, ok := b.values[string(key)]
+	return value, ok
+}
+
+// Put sets the value of a key in a bucket, creating the bucket if necessary.
+func (db *DB) Put(name string, key, value []byte) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	if err := db.write(opPut, name, key, value); err != nil {
+		return err
+	}
+	db.put(name, string(key), value)
+	db.maybeCompact()
+	return nil
+}
+
+// Delete removes a key from a bucket. The bucket is
+// removed with its last key.
+func (db *DB) Delete(name string, key []byte) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	if _, ok := db.buckets[name]; !ok {
+		return nil
+	}
+	if err := db.write(opDelete, name, key, nil); err != nil {
+		return err
+	}
+	db.delete(name, string(key))
+	db.maybeCompact()
+	return nil
+}
+
+// DeleteBucket removes a bucket and all its keys.
+func (db *DB) DeleteBucket(name string) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	if _, ok := db.buckets[name]; !ok {
+		return nil
+	}
+	if err := db.write(opDeleteBucket, name, nil, nil); err != nil {
+		return err
+	}
+	db.deleteBucket(name)
+	db.maybeCompact()
+	return nil
+}
+
+// Buckets returns the names of the buckets, in order.
+func (db *DB) Buckets() []string {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	names := make([]string, 0, len(db.buckets))
+	for name := range db.buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Len returns the number of keys in a bucket.
+func (db *DB) Len(name string) int {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	if b, ok := db.buckets[name]; ok {
+		return len(b.keys)
+	}
+	return 0
+}
+
+// First returns the first key in a bucket and its value.
+func (db *DB) First(name string) (key, value []byte, ok bool) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	b, ok := db.buckets[name]
+	if !ok {
+		return nil, nil, false
+	}
+	k := b.keys[0]
+	return []byte(k), b.values[k], true
+}
+
+// Last returns the last key in a bucket and its value.
+func (db *DB) Last(name string) (key, value []byte, ok bool) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	b, ok := db.buckets[name]
+	if !ok {
+		return nil, nil, false
+	}
+	k := b.keys[len(b.keys)-1]
+	return []byte(k), b.values[k], true
+}
+
+// Prefix returns the first and last keys in a bucket that start with
+// prefix, and the number of such keys.
+func (db *DB) Prefix(name string, prefix []byte) (first, last []byte, n int) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	b, ok := db.buckets[name]
+	if !ok {
+		return nil, nil, 0
+	}
+	i, j := b.prefix(string(prefix))
+	if i == j {
+		return nil, nil, 0
+	}
+	return []byte(b.keys[i]), []byte(b.keys[j-1]), j - i
+}
+
+// ForEach calls fn for every key in a bucket, in order, until fn returns
+// an error. The store must not be modified by fn.
+func (db *DB) ForEach(name string, fn func(key, value []byte) error) error {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	b, ok := db.buckets[name]
+	if !ok {
+		return nil
+	}
+	for _, k := range b.keys {
+		if err := fn([]byte(k), b.values[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *DB) put(name, key string, value []byte) {
+	b, ok := db.buckets[name]
+	if !ok {
+		b = &bucket{values: make(map[string][]byte)}
+		db.buckets[name] = b
+	}
+	if _, ok := b.values[key]; ok {
+		db.obsolete++
+	} else {
+		// keys are mostly added at either end
+		i := len(b.keys)
+		if i > 0 && key < b.keys[i-1] {
+			i = sort.SearchStrings(b.keys, key)
+		}
+		b.keys = append(b.keys, "")
+		copy(b.keys[i+1:], b.keys[i:])
+		b.keys[i] = key
+		db.live++
+	}
+	b.values[key] = value
+}
+
+func (db *DB) delete(name, key string) {
+	db.obsolete++ // the delete record itself
+	b, ok := db.buckets[name]
+	if !ok {
+		return
+	}
+	if _, ok := b.values[key]; !ok {
+		return
+	}
+	delete(b.values, key)
+	i := sort.SearchStrings(b.keys, key)
+	b.keys = append(b.keys[:i], b.keys[i+1:]...)
+	db.live--
+	db.obsolete++
+	if len(b.keys) == 0 {
+		delete(db.buckets, name)
+	}
+}
+
+func (db *DB) deleteBucket(name string) {
+	db.obsolete++
+	if b, ok := db.buckets[name]; ok {
+		db.live -= len(b.keys)
+		db.obsolete += len(b.keys)
+		delete(db.buckets, name)
+	}
+}
+
+func encodeRecord(op byte, name string, key, value []byte) []byte {
+	var payload bytes.Buffer
+	payload.WriteByte(op)
+	writeBytes(&payload, []byte(name))
+	writeBytes(&payload, key)
+	payload.Write(value)
+
+	record := make([]byte, recordHeader, recordHeader+payload.Len())
+	binary.BigEndian.PutUint32(record[0:4], uint32(payload.Len()))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload.Bytes()))
+	return append(record, payload.Bytes()...)
+}
+
+func (db *DB) write(op byte, name string, key, value []byte) error {
+	if db.file == nil {
+		return ErrClosed
+	}
+	if db.options.ReadOnly {
+		return ErrReadOnly
+	}
+	record := encodeRecord(op, name, key, value)
+	if _, err := db.file.WriteAt(record, db.size); err != nil {
+		// an incomplete record is truncated by the next Open
+		return err
+	}
+	db.size += int64(len(record))
+	if !db.options.NoSync {
+		return db.file.Sync()
+	}
+	return nil
+}
+
+// load replays the file. An incomplete or corrupt record at the end,
+// as left by a crash, is truncated.
+func (db *DB) load() error {
+	info, err := db.file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		if db.options.ReadOnly {
+			return ErrCorrupt
+		}
+		if _, err := db.file.WriteAt(magic, 0); err != nil {
+			return err
+		}
+		db.size = int64(len(magic))
+		return db.file.Sync()
+	}
+
+	r := bufio.NewReader(db.file)
+	header := make([]byte, len(magic))
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.Equal(header, magic) {
+		return ErrCorrupt
+	}
+	db.size = int64(len(magic))
+
+	for {
+		var h [recordHeader]byte
+		if _, err := io.ReadFull(r, h[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return db.truncate(err)
+		}
+		length := binary.BigEndian.Uint32(h[0:4])
+		if db.size+recordHeader+int64(length) > info.Size() {
+			return db.truncate(io.ErrUnexpectedEOF)
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return db.truncate(err)
+		}
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(h[4:8]) {
+			return db.truncate(errors.New("checksum mismatch"))
+		}
+		op, name, key, value, err := parseRecord(payload)
+		if err != nil {
+			return db.truncate(err)
+		}
+		switch op {
+		case opPut:
+			db.put(name, string(key), value)
+		case opDelete:
+			db.delete(name, string(key))
+		case opDeleteBucket:
+			db.deleteBucket(name)
+		}
+		db.size += recordHeader + int64(length)
+	}
+}
+
+func (db *DB) truncate(reason error) error {
+	log.Errorf("%s: invalid record at %d: %s", db.path, db.size, reason.Error())
+	if db.options.ReadOnly {
+		return nil
+	}
+	return db.file.Truncate(db.size)
+}
+
+func parseRecord(payload []byte) (op byte, name string, key, value []byte, err error) {
+	if len(payload) < 1 {
+		return 0, "", nil, nil, ErrCorrupt
+	}
+	op = payload[0]
+	r := bytes.NewReader(payload[1:])
+	n, err := readBytes(r)
+	if err != nil {
+		return 0, "", nil, nil, err
+	}
+	if key, err = readBytes(r); err != nil {
+		return 0, "", nil, nil, err
+	}
+	switch op {
+	case opPut, opDelete, opDeleteBucket:
+	default:
+		return 0, "", nil, nil, ErrCorrupt
+	}
+	value = payload[len(payload)-r.Len():]
+	return op, string(n), key, value, nil
+}
+
+// maybeCompact compacts the file once most of it is obsolete. It is called
+// after a write that has succeeded, so a failure is only logged: the old
+// file is still valid, and the next write tries again.
+func (db *DB) maybeCompact() {
+	if db.obsolete < compactThreshold || db.obsolete < db.live {
+		return
+	}
+	if err := db.compact(); err != nil {
+		log.Errorf("%s: compaction failed: %s", db.path, err.Error())
+	}
+}
+
+// Compact rewrites the file with only the records needed
+// for the current contents of the store.
+func (db *DB) Compact() error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	if db.file == nil {
+		return ErrClosed
+	}
+	if db.options.ReadOnly {
+		return ErrReadOnly
+	}
+	return db.compact()
+}
+
+// compact writes the contents to a new file, which then replaces the old
+// one, so that a crash leaves either the old file or the new one.
+func (db *DB) compact() error {
+	tmp := db.path + ".compact"
+	file, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	size := int64(len(magic))
+	w.Write(magic)
+	for name, b := range db.buckets {
+		for _, k := range b.keys {
+			record := encodeRecord(opPut, name, []byte(k), b.values[k])
+			w.Write(record)
+			size += int64(len(record))
+		}
+	}
+	if err = w.Flush(); err == nil {
+		err = file.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp, db.path)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	db.file.Close()
+	db.file = file
+	db.size = size
+	db.obsolete = 0
+	// the rename is only durable once the directory is synced
+	return syncDir(filepath.Dir(db.path))
+}
+
+// syncDir syncs a directory, so that the files renamed
+// in it keep their new names if the system crashes.
+func syncDir(path string) error {
+	if runtime.GOOS == "windows" {
+		// directories cannot be opened for syncing
+		return nil
+	}
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+func writeBytes(buf *bytes.Buffer, b []byte) {
+	var n [binary.MaxVarintLen64]byte
+	buf.Write(n[:binary.PutUvarint(n[:], uint64(len(b)))])
+	buf.Write(b)
+}
+
+func readBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > uint64(r.Len()) {
+		return nil, ErrCorrupt
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, ErrCorrupt
+	}
+	return b, nil
+}
@@ -0,0 +1,155 @@
+package kvstore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+// Runs all gocheck tests in this package.
+// See other *_test.go files for gocheck tests.
+func TestKVStore(t *testing.T) {
+	TestingT(t)
+}
+
+type KVStoreSuite struct {
+	dir string
+}
+
+var _ = Suite(&KVStoreSuite{})
+
+func (s *KVStoreSuite) SetUpTest(c *C) {
+	dir, err := ioutil.TempDir("", "kvstore")
+	c.Assert(err, IsNil)
+	s.dir = dir
+}
+
+func (s *KVStoreSuite) TearDownTest(c *C) {
+	os.RemoveAll(s.dir)
+}
+
+func (s *KVStoreSuite) TestPutGetDelete(c *C) {
+	db, err := Open(filepath.Join(s.dir, "test.kv"), Options{})
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	c.Assert(db.Put("b1", []byte("k2"), []byte("v2")), IsNil)
+	c.Assert(db.Put("b1", []byte("k1"), []byte("v1")), IsNil)
+	c.Assert(db.Put("b1", []byte("k3"), []byte("v3")), IsNil)
+	c.Assert(db.Put("b2", []byte("k1"), []byte("x")), IsNil)
+
+	value, ok := db.Get("b1", []byte("k2"))
+	c.Assert(ok, Equals, true)
+	c.Assert(string(value), Equals, "v2")
+	c.Assert(db.Buckets(), DeepEquals, []string{"b1", "b2"})
+	c.Assert(db.Len("b1"), Equals, 3)
+
+	key, value, ok := db.First("b1")
+	c.Assert(ok, Equals, true)
+	c.Assert(string(key)+"="+string(value), Equals, "k1=v1")
+	key, value, ok = db.Last("b1")
+	c.Assert(ok, Equals, true)
+	c.Assert(string(key)+"="+string(value), Equals, "k3=v3")
+
+	c.Assert(db.Delete("b1", []byte("k1")), IsNil)
+	c.Assert(db.Len("b1"), Equals, 2)
+	c.Assert(db.DeleteBucket("b2"), IsNil)
+	c.Assert(db.Buckets(), DeepEquals, []string{"b1"})
+
+	var keys []string
+	db.ForEach("b1", func(key, value []byte) error {
+		keys = append(keys, string(key))
+		return nil
+	})
+	c.Assert(keys, DeepEquals, []string{"k2", "k3"})
+}
+
+func (s *KVStoreSuite) TestReopen(c *C) {
+	path := filepath.Join(s.dir, "test.kv")
+	db, err := Open(path, Options{NoSync: true})
+	c.Assert(err, IsNil)
+	c.Assert(db.Put("b1", []byte("k1"), []byte("v1")), IsNil)
+	c.Assert(db.Put("b1", []byte("k2"), []byte("v2")), IsNil)
+	c.Assert(db.Put("b1", []byte("k1"), []byte("v1b")), IsNil)
+	c.Assert(db.Delete("b1", []byte("k2")), IsNil)
+	c.Assert(db.Put("b2", []byte("k1"), []byte("x")), IsNil)
+	c.Assert(db.Close(), IsNil)
+
+	// simulate a crash in the middle of writing the last record
+	info, err := os.Stat(path)
+	c.Assert(err, IsNil)
+	c.Assert(os.Truncate(path, info.Size()-1), IsNil)
+
+	db, err = Open(path, Options{ReadOnly: true})
+	c.Assert(err, IsNil)
+	c.Assert(db.Put("b1", []byte("k3"), nil), Equals, ErrReadOnly)
+	c.Assert(db.Close(), IsNil)
+
+	db, err = Open(path, Options{})
+	c.Assert(err, IsNil)
+	defer db.Close()
+	c.Assert(db.Buckets(), DeepEquals, []string{"b1"})
+	value, ok := db.Get("b1", []byte("k1"))
+	c.Assert(ok, Equals, true)
+	c.Assert(string(value), Equals, "v1b")
+	c.Assert(db.Len("b1"), Equals, 1)
+}
+
+func (s *KVStoreSuite) TestCompact(c *C) {
+	path := filepath.Join(s.dir, "test.kv")
+	db, err := Open(path, Options{NoSync: true})
+	c.Assert(err, IsNil)
+	for i := 0; i < 2*compactThreshold; i++ {
+		key := []byte{byte(i >> 8), byte(i)}
+		c.Assert(db.Put("b1", key, []byte("value")), IsNil)
+		if i > 0 {
+			c.Assert(db.Delete("b1", []byte{byte((i - 1) >> 8), byte(i - 1)}), IsNil)
+		}
+	}
+	c.Assert(db.Len("b1"), Equals, 1)
+	info, err := os.Stat(path)
+	c.Assert(err, IsNil)
+	// without compaction, the file would hold about 70000 bytes
+	c.Assert(info.Size() < 40000, Equals, true)
+
+	c.Assert(db.Compact(), IsNil)
+	info, err = os.Stat(path)
+	c.Assert(err, IsNil)
+	c.Assert(info.Size() < 100, Equals, true)
+	c.Assert(db.Close(), IsNil)
+
+	db, err = Open(path, Options{})
+	c.Assert(err, IsNil)
+	defer db.Close()
+	c.Assert(db.Len("b1"), Equals, 1)
+	c.Assert(db.Put("b1", []byte("x"), []byte("y")), IsNil)
+}
+
+func (s *KVStoreSuite) TestCompactFailure(c *C) {
+	path := filepath.Join(s.dir, "test.kv")
+	db, err := Open(path, Options{NoSync: true})
+	c.Assert(err, IsNil)
+	defer db.Close()
+	// the temporary file of the compaction cannot be created
+	c.Assert(os.Mkdir(path+".compact", 0755), IsNil)
+	for i := 0; i < 2*compactThreshold; i++ {
+		c.Assert(db.Put("b1", []byte("k1"), []byte("value")), IsNil)
+	}
+	c.Assert(db.Delete("b1", []byte("k1")), IsNil)
+	info, err := os.Stat(path)
+	c.Assert(err, IsNil)
+	c.Assert(info.Size() > 30000, Equals, true)
+
+	// writes compact the file once it can be done
+	c.Assert(os.Remove(path+".compact"), IsNil)
+	c.Assert(db.Put("b1", []byte("k2"), []byte("value")), IsNil)
+	info, err = os.Stat(path)
+	c.Assert(err, IsNil)
+	c.Assert(info.Size() < 100, Equals, true)
+	value, ok := db.Get("b1", []byte("k2"))
+	c.Assert(ok, Equals, true)
+	c.Assert(string(value), Equals, "value")
+}
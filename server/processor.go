@@ -5,7 +5,8 @@ import (
 	"fmt"
 	"net"
 	"os"
-	"strings"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/go-stomp/stomp/frame"
@@ -15,6 +16,10 @@ import (
 	"github.com/go-stomp/stomp/server/topic"
 )
 
+// Delay before a scheduled frame that could not be
+// delivered when it was due is tried again.
+const scheduleRetryDelay = time.Second
+
 //var log slf.StructuredLogger
 
 //func init() {
@@ -25,8 +30,13 @@ type requestProcessor struct {
 	server                 *Server
 	config                 *config
 	ch                     chan client.Request
-	tm                     *topic.Manager
-	qm                     *queue.Manager
+	vhosts                 map[string]*vhost // by name, or a single one named "" without virtual hosts
+	router                 *router
+	scheduleTimer          *time.Timer   // fires when the next scheduled frame is due
+	admin                  chan func()   // admin operations, run on the Serve goroutine
+	quit                   chan struct{} // closed to stop serving
+	done                   chan struct{} // closed once serving has stopped
+	shutdown               sync.Once
 	connections            map[int64]*client.Conn
 	stop                   bool // has stop been requested
 	connectCount           int
@@ -43,49 +53,129 @@ type requestProcessor struct {
 	currentSkippedCount    int
 }
 
-func newRequestProcessor(server *Server) *requestProcessor {
-	config := newConfig(server)
+// vhost holds the destinations of a virtual host, which are
+// unknown to the clients of the other virtual hosts.
+type vhost struct {
+	name       string
+	tm         *topic.Manager
+	qm         *queue.Manager
+	durables   *topic.Durables
+	scheduler  *queue.Scheduler
+	tempQueues map[string]map[*client.Subscription]bool // subscriptions to temporary queues
+}
+
+func newVhost(server *Server, qstore QueueStorage, name string) *vhost {
+	vh := &vhost{
+		name:       name,
+		tm:         topic.NewManager(),
+		qm:         queue.NewManager(qstore),
+		scheduler:  queue.NewScheduler(qstore),
+		tempQueues: make(map[string]map[*client.Subscription]bool),
+	}
+
+	vh.qm.SetExpiryDestination(server.Config.ExpiryDestination)
+	vh.qm.SetDefaultPolicy(queue.Policy{MaxDeliveries: server.Config.MaxDeliveries})
+	for _, p := range server.Config.Policies {
+		vh.qm.SetPolicy(p.Destination, queue.Policy{
+			MaxDeliveries:   p.MaxDeliveries,
+			DeadLetterQueue: p.DeadLetterQueue,
+		})
+	}
+	vh.durables = topic.NewDurables(vh.tm, vh.qm, qstore)
+	return vh
+}
+
+// durableStatus returns the status of the durable subscriptions of the
+// virtual host.
+func (vh *vhost) durableStatus() []*status.DurableStatus {
+	durables := vh.durables.GetStatus()
+	for _, ds := range durables {
+		ds.VirtualHost = vh.name
+	}
+	return durables
+}
+
+func newRequestProcessor(server *Server, qstore QueueStorage, router *router, vhosts map[string]*VirtualHost) *requestProcessor {
+	config := newConfig(server, router, vhosts)
 	proc := &requestProcessor{
 		server:      server,
 		config:      config,
 		ch:          make(chan client.Request, config.MaxPendingWrites()*16), //HACK: arbitrary coeff
-		tm:          topic.NewManager(),
+		vhosts:      make(map[string]*vhost),
+		router:      router,
 		connections: make(map[int64]*client.Conn),
+		admin:       make(chan func()),
+		quit:        make(chan struct{}),
+		done:        make(chan struct{}),
 	}
 
-	if server.QueueStorage == nil {
-		proc.qm = queue.NewManager(queue.NewMemoryQueueStorage())
-	} else {
-		proc.qm = queue.NewManager(server.QueueStorage)
+	if len(vhosts) == 0 {
+		proc.vhosts[""] = newVhost(server, qstore, "")
+	}
+	for name := range vhosts {
+		vstore := newVhostStorage(qstore, name, name == server.Config.DefaultVirtualHost)
+		proc.vhosts[name] = newVhost(server, vstore, name)
 	}
 
 	return proc
 }
 
+// load reads the frames that were scheduled, and the durable subscriptions
+// that were made, before the server started.
+func (proc *requestProcessor) load() error {
+	for _, vh := range proc.vhosts {
+		if err := vh.scheduler.Load(); err != nil {
+			return err
+		}
+		if err := vh.durables.Load(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// vhost returns the virtual host of a connection, from its name.
+func (proc *requestProcessor) vhost(name string) *vhost {
+	vh, ok := proc.vhosts[name]
+	if !ok {
+		// should not happen, already checked in lower layer
+		panic("unknown virtual host: " + name)
+	}
+	return vh
+}
+
 func (proc *requestProcessor) createStatus() *status.ServerStatus {
 	//clients
 	totalCurrentSkippedWrites := 0
-	clients := make([]*status.ServerClientStatus, 0)
+	vhosts := make(map[string]*status.VirtualHostStatus)
+	for name, vh := range proc.vhosts {
+		vhosts[name] = &status.VirtualHostStatus{
+			Name:      name,
+			Clients:   make([]*status.ServerClientStatus, 0),
+			Queues:    vh.qm.GetStatus(),
+			Topics:    vh.tm.GetStatus(),
+			Durables:  vh.durableStatus(),
+			Scheduled: vh.scheduler.GetStatus(),
+		}
+	}
 	for _, conn := range proc.connections {
 		connStatus := conn.GetStatus()
 		totalCurrentSkippedWrites += connStatus.CurrentSkippedWrites
-		clients = append(clients, connStatus)
+		vs := vhosts[conn.VirtualHost()]
+		vs.Clients = append(vs.Clients, connStatus)
 	}
 
 	//
 	totalQueueCount := 0
 	totalCurrentCount := 0
-	queues := proc.qm.GetStatus()
-
-	for _, qs := range queues {
-		totalQueueCount += qs.MessageCount
-		totalCurrentCount += qs.CurrentCount
-	}
-
-	//
-	topics := proc.tm.GetStatus()
-	for _, ts := range topics {
-		totalCurrentCount += ts.CurrentCount
+	for _, vs := range vhosts {
+		for _, qs := range vs.Queues {
+			totalQueueCount += qs.MessageCount
+			totalCurrentCount += qs.CurrentCount
+		}
+		for _, ts := range vs.Topics {
+			totalCurrentCount += ts.CurrentCount
+		}
 	}
 
 	hostname, _ := os.Hostname()
@@ -93,9 +183,6 @@ func (proc *requestProcessor) createStatus() *status.ServerStatus {
 	rate := float64(proc.currentEnqueueCount+proc.currentRequeueCount) / float64(proc.server.Config.Status)
 
 	serverStatus := &status.ServerStatus{
-		Clients:                   clients,
-		Queues:                    queues,
-		Topics:                    topics,
 		Time:                      time.Now().Format(time.RFC3339),
 		Type:                      "status",
 		Id:                        proc.server.Id(),
@@ -121,6 +208,18 @@ func (proc *requestProcessor) createStatus() *status.ServerStatus {
 		TotalCurrentSkippedWrites: totalCurrentSkippedWrites,
 		MessageRate:               rate,
 	}
+	if vs, ok := vhosts[""]; ok {
+		serverStatus.Clients = vs.Clients
+		serverStatus.Queues = vs.Queues
+		serverStatus.Topics = vs.Topics
+		serverStatus.Durables = vs.Durables
+		serverStatus.Scheduled = vs.Scheduled
+	} else {
+		for _, vs := range vhosts {
+			serverStatus.VirtualHosts = append(serverStatus.VirtualHosts, vs)
+		}
+		sort.Sort(vhostStatusByName(serverStatus.VirtualHosts))
+	}
 
 	//diffs
 	proc.currentEnqueueCountLog += proc.currentEnqueueCount
@@ -137,9 +236,14 @@ func (proc *requestProcessor) createStatus() *status.ServerStatus {
 	return serverStatus
 }
 
-func (proc *requestProcessor) createStatusFrame() *frame.Frame {
+type vhostStatusByName []*status.VirtualHostStatus
+
+func (a vhostStatusByName) Len() int           { return len(a) }
+func (a vhostStatusByName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a vhostStatusByName) Less(i, j int) bool { return a[i].Name < a[j].Name }
+
+func (proc *requestProcessor) createStatusFrame(status *status.ServerStatus) *frame.Frame {
 	f := frame.New("MESSAGE", frame.ContentType, "application/json")
-	status := proc.createStatus()
 	//bytes, err := json.MarshalIndent(status, "", "  ")
 	bytes, err := json.Marshal(status)
 	//log.Debugf("createStatusFrame %v", string(bytes))
@@ -151,22 +255,53 @@ func (proc *requestProcessor) createStatusFrame() *frame.Frame {
 	return f
 }
 
+// sendStatusFrame sends the status of the server to the status topic of
+// each virtual host, with the status of that virtual host only.
 func (proc *requestProcessor) sendStatusFrame() {
-	topic := proc.tm.Find("/topic/go-stomp.status")
-	f := proc.createStatusFrame()
-	f.Header.Add(frame.Destination, "/topic/go-stomp.status")
-	//log.Debugf("status frame %v", f.Dump())
-	topic.Enqueue(f)
+	serverStatus := proc.createStatus()
+	vhostStatus := make(map[string]*status.VirtualHostStatus)
+	for _, vs := range serverStatus.VirtualHosts {
+		vhostStatus[vs.Name] = vs
+	}
+	for name, vh := range proc.vhosts {
+		s := serverStatus
+		if vs, ok := vhostStatus[name]; ok {
+			own := *serverStatus
+			own.VirtualHosts = []*status.VirtualHostStatus{vs}
+			s = &own
+		}
+		f := proc.createStatusFrame(s)
+		f.Header.Add(frame.Destination, StatusDestination)
+		//log.Debugf("status frame %v", f.Dump())
+		vh.tm.Publish(StatusDestination, f)
+	}
 }
 
 func (proc *requestProcessor) Serve(l net.Listener) error {
 	go proc.Listen(l)
 
 	ticker := time.NewTicker(proc.server.StatusDuration())
+	defer ticker.Stop()
 	infoTicker := time.NewTicker(proc.server.StatusLogDuration())
+	defer infoTicker.Stop()
+
+	// queues that nobody reads from are swept for expired messages
+	var sweepChannel <-chan time.Time
+	sweep := proc.server.ExpirySweepDuration()
+	if sweep > 0 {
+		sweepTicker := time.NewTicker(sweep)
+		defer sweepTicker.Stop()
+		sweepChannel = sweepTicker.C
+	}
+
+	proc.scheduleTimer = time.NewTimer(0)
+	proc.resetScheduleTimer()
+	defer proc.scheduleTimer.Stop()
 
 	for {
 		select {
+		case <-proc.quit:
+			return l.Close()
 		case _ = <-infoTicker.C:
 
 			log.Debugf("status: processed:%d total:%d skipped:%d clients:%d",
@@ -176,25 +311,50 @@ func (proc *requestProcessor) Serve(l net.Listener) error {
 			proc.currentSkippedCount = 0
 		case _ = <-ticker.C:
 			proc.sendStatusFrame()
+		case fn := <-proc.admin:
+			fn()
+		case now := <-sweepChannel:
+			dropped := 0
+			for _, vh := range proc.vhosts {
+				dropped += vh.qm.Sweep(now, sweep)
+			}
+			if dropped > 0 {
+				log.Debugf("sweep: %d expired messages", dropped)
+			}
+		case now := <-proc.scheduleTimer.C:
+			for _, vh := range proc.vhosts {
+				for _, sf := range vh.scheduler.Due(now) {
+					proc.deliverScheduled(vh, sf, now)
+				}
+			}
+			proc.resetScheduleTimer()
 		case r := <-proc.ch:
 			switch r.Op {
 			case client.SubscribeOp:
-				if isQueueDestination(r.Sub.Destination()) {
-					queue := proc.qm.Find(r.Sub.Destination())
+				vh := proc.vhost(r.Sub.VirtualHost())
+				if durable := proc.findDurable(vh, r.Sub); durable != nil {
+					durable.Subscribe(r.Sub)
+				} else if proc.isQueueDestination(r.Sub.Destination()) {
+					proc.subscribeTempQueue(vh, r.Sub)
+					queue := vh.qm.Find(r.Sub.Destination())
 					// todo error handling
 					queue.Subscribe(r.Sub)
 				} else {
-					topic := proc.tm.Find(r.Sub.Destination())
+					topic := vh.tm.Find(r.Sub.Destination())
 					topic.Subscribe(r.Sub)
 				}
 
 			case client.UnsubscribeOp:
-				if isQueueDestination(r.Sub.Destination()) {
-					queue := proc.qm.Find(r.Sub.Destination())
+				vh := proc.vhost(r.Sub.VirtualHost())
+				if durable := proc.lookupDurable(vh, r.Sub); durable != nil {
+					durable.Unsubscribe(r.Sub)
+				} else if proc.isQueueDestination(r.Sub.Destination()) {
+					queue := vh.qm.Find(r.Sub.Destination())
 					// todo error handling
 					queue.Unsubscribe(r.Sub)
+					proc.unsubscribeTempQueue(vh, r.Sub)
 				} else {
-					topic := proc.tm.Find(r.Sub.Destination())
+					topic := vh.tm.Find(r.Sub.Destination())
 					topic.Unsubscribe(r.Sub)
 				}
 
@@ -207,12 +367,12 @@ func (proc *requestProcessor) Serve(l net.Listener) error {
 				proc.enqueueCount++
 				proc.currentEnqueueCount++
 
-				if isQueueDestination(destination) {
-					queue := proc.qm.Find(destination)
-					queue.Enqueue(r.Frame)
-				} else {
-					topic := proc.tm.Find(destination)
-					topic.Enqueue(r.Frame)
+				vh := proc.vhost(r.Conn.VirtualHost())
+				if proc.schedule(vh, r.Frame) {
+					break
+				}
+				if err := proc.enqueue(vh, destination, r.Frame); err != nil {
+					log.Errorf("enqueue %s: %s", destination, err.Error())
 				}
 
 			case client.RequeueOp:
@@ -224,9 +384,17 @@ func (proc *requestProcessor) Serve(l net.Listener) error {
 				proc.requeueCount++
 				proc.currentRequeueCount++
 
-				// only requeue to queues, should never happen for topics
-				if isQueueDestination(destination) {
-					queue := proc.qm.Find(destination)
+				// only requeue to queues and durable subscriptions,
+				// should never happen for other topic subscriptions
+				vh := proc.vhost(r.Sub.VirtualHost())
+				if r.Sub.DurableName() != "" && !proc.isQueueDestination(destination) {
+					if durable := proc.lookupDurable(vh, r.Sub); durable != nil {
+						durable.Requeue(r.Frame)
+					}
+				} else if proc.router.kind(destination) == TempQueueRoute && vh.tempQueues[destination] == nil {
+					// the temporary queue ended with its last subscription
+				} else if proc.isQueueDestination(destination) {
+					queue := vh.qm.Find(destination)
 					queue.Requeue(r.Frame)
 				}
 
@@ -243,12 +411,163 @@ func (proc *requestProcessor) Serve(l net.Listener) error {
 			}
 		}
 	}
-	// this is no longer required for go 1.1
-	panic("not reached")
 }
 
-func isQueueDestination(dest string) bool {
-	return strings.HasPrefix(dest, QueuePrefix)
+// Stop makes Serve stop accepting connections and processing requests.
+func (proc *requestProcessor) Stop() {
+	proc.shutdown.Do(func() {
+		close(proc.quit)
+	})
+}
+
+// enqueue sends a frame to the queue or topic of its destination, or
+// forwards it to the targets of a virtual destination.
+func (proc *requestProcessor) enqueue(vh *vhost, destination string, f *frame.Frame) error {
+	switch proc.router.kind(destination) {
+	case QueueRoute, TempQueueRoute:
+		queue := vh.qm.Find(destination)
+		return queue.Enqueue(f)
+	case TopicRoute:
+		vh.tm.Publish(destination, f)
+	case VirtualRoute:
+		// every target is tried, and the first error returned
+		var err error
+		targets := proc.router.route(destination).Targets
+		for i, target := range targets {
+			g := f
+			if i < len(targets)-1 {
+				g = f.Clone()
+			}
+			g.Header.Set(frame.Destination, target)
+			if terr := proc.enqueue(vh, target, g); terr != nil && err == nil {
+				err = terr
+			}
+		}
+		return err
+	default:
+		// should not happen, already checked in lower layer
+		log.Warnf("no route to destination: %s", destination)
+	}
+	return nil
+}
+
+// deliverScheduled enqueues a frame whose delivery time has come, and only
+// then removes it from the queue storage. A frame that cannot be enqueued
+// stays in the schedule, and is tried again after scheduleRetryDelay; the
+// targets of a virtual destination that took the frame then get it again.
+func (proc *requestProcessor) deliverScheduled(vh *vhost, sf *queue.ScheduledFrame, now time.Time) {
+	// the frame is kept as scheduled in case it is tried again
+	if err := proc.enqueue(vh, sf.Destination, sf.Frame.Clone()); err != nil {
+		log.Errorf("deliver scheduled %s: %s", sf.Destination, err.Error())
+		vh.scheduler.Retry(sf, now.Add(scheduleRetryDelay))
+		return
+	}
+	if err := vh.scheduler.Unschedule(sf); err != nil {
+		log.Errorf("unschedule %s: %s", sf.Destination, err.Error())
+	}
+}
+
+// schedule holds a frame whose delivery time has not come yet, and
+// reports whether it did. A frame that cannot be stored for later is
+// delivered immediately rather than lost.
+func (proc *requestProcessor) schedule(vh *vhost, f *frame.Frame) bool {
+	at, ok := queue.DeliveryTime(f)
+	if !ok || !at.After(time.Now()) {
+		return false
+	}
+	if err := vh.scheduler.Schedule(f); err != nil {
+		log.Errorf("schedule %s: %s", f.Header.Get(frame.Destination), err.Error())
+		return false
+	}
+	proc.resetScheduleTimer()
+	return true
+}
+
+// resetScheduleTimer sets the schedule timer to fire when
+// the next scheduled frame is due.
+func (proc *requestProcessor) resetScheduleTimer() {
+	if !proc.scheduleTimer.Stop() {
+		select {
+		case <-proc.scheduleTimer.C:
+		default:
+		}
+	}
+	var next time.Time
+	for _, vh := range proc.vhosts {
+		if at, ok := vh.scheduler.Next(); ok && (next.IsZero() || at.Before(next)) {
+			next = at
+		}
+	}
+	if !next.IsZero() {
+		proc.scheduleTimer.Reset(next.Sub(time.Now()))
+	}
+}
+
+// isQueueDestination reports whether a destination is routed to a queue.
+func (proc *requestProcessor) isQueueDestination(dest string) bool {
+	switch proc.router.kind(dest) {
+	case QueueRoute, TempQueueRoute:
+		return true
+	}
+	return false
+}
+
+// subscribeTempQueue records a subscription to a temporary queue.
+func (proc *requestProcessor) subscribeTempQueue(vh *vhost, sub *client.Subscription) {
+	dest := sub.Destination()
+	if proc.router.kind(dest) != TempQueueRoute {
+		return
+	}
+	subs, ok := vh.tempQueues[dest]
+	if !ok {
+		subs = make(map[*client.Subscription]bool)
+		vh.tempQueues[dest] = subs
+	}
+	subs[sub] = true
+}
+
+// unsubscribeTempQueue removes a subscription to a temporary queue,
+// and deletes the queue with its messages when none is left.
+func (proc *requestProcessor) unsubscribeTempQueue(vh *vhost, sub *client.Subscription) {
+	dest := sub.Destination()
+	subs, ok := vh.tempQueues[dest]
+	if !ok {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) > 0 {
+		return
+	}
+	delete(vh.tempQueues, dest)
+	if err := vh.qm.Find(dest).Purge(); err != nil {
+		log.Errorf("temporary queue %s: %s", dest, err.Error())
+	}
+	vh.qm.Remove(dest)
+}
+
+// findDurable returns the durable subscription for a client subscription,
+// creating it if necessary, or nil if the subscription is not durable.
+// Subscriptions to queues are never durable, because queues keep their
+// messages anyway.
+func (proc *requestProcessor) findDurable(vh *vhost, sub *client.Subscription) *topic.Durable {
+	if sub.DurableName() == "" || proc.isQueueDestination(sub.Destination()) {
+		return nil
+	}
+	return vh.durables.Find(sub.ClientId(), sub.DurableName(), sub.Destination(), sub.Selector())
+}
+
+// lookupDurable returns the existing durable subscription for a client
+// subscription, or nil if the subscription is not durable or the durable
+// subscription has been deleted.
+func (proc *requestProcessor) lookupDurable(vh *vhost, sub *client.Subscription) *topic.Durable {
+	if sub.DurableName() == "" || proc.isQueueDestination(sub.Destination()) {
+		return nil
+	}
+	durable, ok := vh.durables.Lookup(sub.ClientId(), sub.DurableName())
+	if !ok {
+		return nil
+	}
+	return durable
 }
 
 func (proc *requestProcessor) Listen(l net.Listener) {
@@ -283,16 +602,37 @@ func (proc *requestProcessor) Listen(l net.Listener) {
 		//proc.connections[conn_id] = conn
 		conn_id++
 	}
-	// This is no longer required for go 1.1
-	log.Panic("not reached")
 }
 
 type config struct {
-	server *Server
+	server      *Server
+	router      *router
+	vhosts      map[string]*VirtualHost
+	mutex       sync.Mutex     // protects connections, used by the goroutines of all connections
+	connections map[string]int // reserved connections by virtual host
 }
 
-func newConfig(s *Server) *config {
-	return &config{server: s}
+func newConfig(s *Server, r *router, vhosts map[string]*VirtualHost) *config {
+	return &config{
+		server:      s,
+		router:      r,
+		vhosts:      vhosts,
+		connections: make(map[string]int),
+	}
+}
+
+func (c *config) VirtualHost(host string) (string, bool) {
+	if len(c.vhosts) == 0 {
+		// every client connects to the single namespace of the server
+		return "", true
+	}
+	if _, ok := c.vhosts[host]; ok {
+		return host, true
+	}
+	if c.server.Config.DefaultVirtualHost != "" {
+		return c.server.Config.DefaultVirtualHost, true
+	}
+	return "", false
 }
 
 func (c *config) HeartBeat() time.Duration {
@@ -321,7 +661,11 @@ func (c *config) MaxPendingWrites() int {
 	return c.server.Config.MaxPendingWrites
 }
 
-func (c *config) Authenticate(login, passcode string) bool {
+func (c *config) Authenticate(vhost, login, passcode string) bool {
+	if vh, ok := c.vhosts[vhost]; ok && len(vh.Users) > 0 {
+		expected, ok := vh.Users[login]
+		return ok && expected == passcode
+	}
 	if c.server.Authenticator != nil {
 		return c.server.Authenticator.Authenticate(login, passcode)
 	}
@@ -329,3 +673,32 @@ func (c *config) Authenticate(login, passcode string) bool {
 	// no authentication defined
 	return true
 }
+
+func (c *config) CheckDestination(destination string, subscribe bool) error {
+	return c.router.check(destination, subscribe)
+}
+
+func (c *config) ReserveConnection(vhost string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if vh, ok := c.vhosts[vhost]; ok && vh.MaxConnections > 0 && c.connections[vhost] >= vh.MaxConnections {
+		return false
+	}
+	c.connections[vhost]++
+	return true
+}
+
+func (c *config) ReleaseConnection(vhost string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.connections[vhost]--; c.connections[vhost] <= 0 {
+		delete(c.connections, vhost)
+	}
+}
+
+func (c *config) MaxSubscriptions(vhost string) int {
+	if vh, ok := c.vhosts[vhost]; ok {
+		return vh.MaxSubscriptions
+	}
+	return 0
+}
@@ -0,0 +1,29 @@
+package queue
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/go-stomp/stomp/frame"
+)
+
+// Expiration returns the time at which a frame expires, from its expires
+// header in milliseconds since the Unix epoch. Returns false if the frame
+// does not expire, which is also the case for an expires value of zero.
+func Expiration(f *frame.Frame) (time.Time, bool) {
+	value, ok := f.Header.Contains(frame.Expires)
+	if !ok {
+		return time.Time{}, false
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ms <= 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, ms*int64(time.Millisecond)), true
+}
+
+// Expired reports whether a frame has expired at the given time.
+func Expired(f *frame.Frame, now time.Time) bool {
+	expires, ok := Expiration(f)
+	return ok && !now.Before(expires)
+}
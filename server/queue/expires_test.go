@@ -0,0 +1,117 @@
+package queue
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/go-stomp/stomp/frame"
+	. "gopkg.in/check.v1"
+)
+
+type ExpiresSuite struct{}
+
+var _ = Suite(&ExpiresSuite{})
+
+func expiresAt(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+}
+
+func (s *ExpiresSuite) TestExpired(c *C) {
+	now := time.Now()
+	c.Check(Expired(frame.New(frame.MESSAGE), now), Equals, false)
+	c.Check(Expired(frame.New(frame.MESSAGE, frame.Expires, "0"), now), Equals, false)
+	c.Check(Expired(frame.New(frame.MESSAGE, frame.Expires, "never"), now), Equals, false)
+	c.Check(Expired(frame.New(frame.MESSAGE, frame.Expires, expiresAt(now.Add(time.Minute))), now), Equals, false)
+	c.Check(Expired(frame.New(frame.MESSAGE, frame.Expires, expiresAt(now.Add(-time.Minute))), now), Equals, true)
+}
+
+func (s *ExpiresSuite) TestEnqueueExpired(c *C) {
+	qstore := NewMemoryQueueStorage()
+	mgr := NewManager(qstore)
+	mgr.SetExpiryDestination("/queue/expired")
+
+	q := mgr.Find("/queue/test")
+	c.Assert(q.Enqueue(frame.New(frame.MESSAGE,
+		frame.Destination, "/queue/test",
+		frame.Expires, expiresAt(time.Now().Add(-time.Second)))), IsNil)
+	c.Assert(q.Count(), Equals, 0)
+
+	f, err := qstore.Dequeue("/queue/expired")
+	c.Assert(err, IsNil)
+	c.Assert(f, NotNil)
+	c.Check(f.Header.Get(frame.Destination), Equals, "/queue/expired")
+	c.Check(f.Header.Get(frame.OriginalDestination), Equals, "/queue/test")
+	_, ok := f.Header.Contains(frame.Expires)
+	c.Check(ok, Equals, false)
+
+	status := q.GetStatus()
+	c.Check(status.ExpiredCount, Equals, int64(1))
+	c.Check(status.CurrentExpiredCount, Equals, 1)
+	c.Check(q.GetStatus().CurrentExpiredCount, Equals, 0)
+}
+
+func (s *ExpiresSuite) TestSweep(c *C) {
+	mgr := NewManager(NewMemoryQueueStorage())
+	q := mgr.Find("/queue/test")
+
+	now := time.Now()
+	for i, expires := range []time.Duration{time.Minute, time.Second, time.Hour, time.Second} {
+		f := frame.New(frame.MESSAGE,
+			frame.Destination, "/queue/test",
+			frame.Expires, expiresAt(now.Add(expires)))
+		f.Body = []byte(strconv.Itoa(i))
+		c.Assert(q.Enqueue(f), IsNil)
+	}
+	c.Assert(q.Count(), Equals, 4)
+
+	// not idle for long enough
+	q.lastSubscribe = now
+	c.Assert(mgr.Sweep(now.Add(2*time.Second), time.Minute), Equals, 0)
+
+	c.Assert(mgr.Sweep(now.Add(2*time.Minute), time.Minute), Equals, 3)
+	c.Assert(q.Count(), Equals, 1)
+
+	q.lastSubscribe = time.Time{}
+	c.Assert(mgr.Sweep(now.Add(2*time.Second), time.Minute), Equals, 0)
+	c.Assert(q.GetStatus().ExpiredCount, Equals, int64(3))
+}
+
+func (s *ExpiresSuite) TestSweepPriorities(c *C) {
+	qstore := NewMemoryQueueStorage()
+	mgr := NewManager(qstore)
+	q := mgr.Find("/queue/test")
+
+	now := time.Now()
+	for _, m := range []struct {
+		body, priority string
+		expires        time.Duration
+	}{
+		{"a", "9", time.Hour},
+		{"b", "9", time.Hour},
+		{"c", "0", time.Second},
+		{"d", "0", time.Hour},
+		{"e", "4", time.Second},
+		{"f", "4", time.Hour},
+	} {
+		f := frame.New(frame.MESSAGE,
+			frame.Destination, "/queue/test",
+			frame.Priority, m.priority,
+			frame.Expires, expiresAt(now.Add(m.expires)))
+		f.Body = []byte(m.body)
+		c.Assert(q.Enqueue(f), IsNil)
+	}
+
+	c.Assert(mgr.Sweep(now.Add(2*time.Minute), time.Minute), Equals, 2)
+
+	// the frames left are in order of priority, then of arrival
+	var bodies string
+	for {
+		f, err := qstore.Dequeue("/queue/test")
+		c.Assert(err, IsNil)
+		if f == nil {
+			break
+		}
+		bodies += string(f.Body)
+	}
+	c.Check(bodies, Equals, "abfd")
+}
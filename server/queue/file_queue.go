@@ -0,0 +1,781 @@
+package queue
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-stomp/stomp/frame"
+)
+
+// SyncPolicy determines when FileQueueStorage flushes
+// its log to stable storage.
+type SyncPolicy int
+
+const (
+	SyncInterval SyncPolicy = iota // sync periodically (default)
+	SyncAlways                     // sync after every write
+	SyncNever                      // leave it to the operating system
+)
+
+func (p SyncPolicy) String() string {
+	switch p {
+	case SyncInterval:
+		return "interval"
+	case SyncAlways:
+		return "always"
+	case SyncNever:
+		return "never"
+	}
+	return "SyncPolicy(" + strconv.Itoa(int(p)) + ")"
+}
+
+// ParseSyncPolicy returns the sync policy for its name,
+// "always", "interval" or "never". An empty name is interval.
+func ParseSyncPolicy(name string) (SyncPolicy, error) {
+	switch name {
+	case "", "interval":
+		return SyncInterval, nil
+	case "always":
+		return SyncAlways, nil
+	case "never":
+		return SyncNever, nil
+	}
+	return SyncInterval, fmt.Errorf("invalid sync policy: %q", name)
+}
+
+// Default values for FileQueueOptions.
+const (
+	DefaultSyncInterval = time.Second
+	DefaultSegmentSize  = 64 << 20
+)
+
+// ErrStorageStopped is returned by a queue storage that
+// has not been started, or has been stopped.
+var ErrStorageStopped = errors.New("queue storage is stopped")
+
+// Options for FileQueueStorage.
+type FileQueueOptions struct {
+	Sync         SyncPolicy
+	SyncInterval time.Duration // used with SyncInterval, DefaultSyncInterval if zero
+	SegmentSize  int64         // size at which a new segment is started, DefaultSegmentSize if zero
+}
+
+// Operations recorded in the log.
+const (
+	opEnqueue byte = 'E'
+	opRequeue byte = 'R'
+	opDequeue byte = 'D'
+)
+
+const (
+	segmentExt   = ".log"
+	tmpExt       = ".tmp" // added to a segment while rewrite writes it
+	recordHeader = 8      // length and CRC-32 of the record, 4 bytes each
+)
+
+// FileQueueStorage is a persistent implementation of the Storage interface.
+// Every enqueue, requeue and dequeue is appended to a log in a directory,
+// which is split into segments. Only an index of the stored messages is
+// kept in memory, and it is rebuilt from the log by Start. Segments whose
+// messages have all been dequeued are deleted, oldest first. Once the log
+// holds more dequeued messages than stored ones, the stored messages are
+// copied into a new segment, so that the older segments can be deleted
+// even if a few of their messages are never dequeued.
+type FileQueueStorage struct {
+	dir      string
+	options  FileQueueOptions
+	mutex    sync.Mutex
+	queues   map[string]*priorityList // *fileRecord, head of the queue first
+	records  map[uint64]*list.Element // keyed by sequence number
+	segments []*fileSegment           // oldest first, the last one is written to
+	seq      uint64                   // last sequence number allocated
+	live     int64                    // size of the records of the stored messages
+	dirty    bool                     // written since the last sync
+	err      error                    // set while the log cannot be written
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// A stored message, as found in the log.
+type fileRecord struct {
+	seq      uint64
+	priority int
+	queue    string
+	segment  *fileSegment
+	offset   int64 // of the record in the segment
+	length   int   // of the record, including its header
+}
+
+type fileSegment struct {
+	id   uint64
+	file *os.File
+	size int64
+	live int // records of messages not dequeued yet
+}
+
+// NewFileQueueStorage creates a queue storage that keeps its log in dir,
+// which is created by Start if it does not exist.
+func NewFileQueueStorage(dir string, options FileQueueOptions) Storage {
+	if options.SyncInterval <= 0 {
+		options.SyncInterval = DefaultSyncInterval
+	}
+	if options.SegmentSize <= 0 {
+		options.SegmentSize = DefaultSegmentSize
+	}
+	return &FileQueueStorage{
+		dir:     dir,
+		options: options,
+		err:     ErrStorageStopped,
+	}
+}
+
+// Start reads the log and rebuilds the index of stored messages. Records
+// that are incomplete or corrupt, as left by a crash, are truncated. If the
+// log cannot be read, the error is returned, and by every operation as well.
+func (s *FileQueueStorage) Start() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.queues = make(map[string]*priorityList)
+	s.records = make(map[uint64]*list.Element)
+	s.segments = nil
+	s.seq = 0
+	s.live = 0
+	s.err = s.recover()
+	if s.err != nil {
+		s.closeSegments()
+		return s.err
+	}
+
+	if s.options.Sync == SyncInterval {
+		s.stop = make(chan struct{})
+		s.done = make(chan struct{})
+		go s.syncLoop(s.stop, s.done)
+	}
+	return nil
+}
+
+// Stop syncs the log and closes its files.
+func (s *FileQueueStorage) Stop() error {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+		s.stop = nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var err error
+	if s.err == nil {
+		err = s.sync()
+	}
+	s.closeSegments()
+	s.err = ErrStorageStopped
+	return err
+}
+
+func (s *FileQueueStorage) Enqueue(queue string, f *frame.Frame) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	rec, err := s.append(opEnqueue, 0, Priority(f), queue, encodeFrame(f))
+	if err != nil {
+		return err
+	}
+	s.index(rec, false)
+	return nil
+}
+
+func (s *FileQueueStorage) Requeue(queue string, f *frame.Frame) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	rec, err := s.append(opRequeue, 0, Priority(f), queue, encodeFrame(f))
+	if err != nil {
+		return err
+	}
+	s.index(rec, true)
+	return nil
+}
+
+func (s *FileQueueStorage) Dequeue(queue string) (*frame.Frame, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.err != nil {
+		return nil, s.err
+	}
+	l, ok := s.queues[queue]
+	if !ok || l.Len() == 0 {
+		return nil, nil
+	}
+	e, _ := l.Front()
+	rec := e.Value.(*fileRecord)
+	f, err := s.read(rec)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.drop(rec); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *FileQueueStorage) Each(queue string, fn func(id string, f *frame.Frame) bool) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	l, ok := s.queues[queue]
+	if !ok {
+		return nil
+	}
+	var err error
+	l.Each(func(e *list.Element) bool {
+		rec := e.Value.(*fileRecord)
+		var f *frame.Frame
+		if f, err = s.read(rec); err != nil {
+			return false
+		}
+		return fn(strconv.FormatUint(rec.seq, 10), f)
+	})
+	return err
+}
+
+// Remove records the removal of the message like Dequeue,
+// the id being its sequence number.
+func (s *FileQueueStorage) Remove(queue string, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	seq, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil
+	}
+	e, ok := s.records[seq]
+	if !ok || e.Value.(*fileRecord).queue != queue {
+		return nil
+	}
+	return s.drop(e.Value.(*fileRecord))
+}
+
+func (s *FileQueueStorage) Count(queue string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	l, ok := s.queues[queue]
+	if !ok {
+		return 0
+	}
+	return l.Len()
+}
+
+func (s *FileQueueStorage) CountByPriority(queue string) []int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	l, ok := s.queues[queue]
+	if !ok {
+		return make([]int, MaxPriority+1)
+	}
+	return l.Counts()
+}
+
+// Schedule stores the frame in a queue of its own. Its sequence
+// number is the id, which is kept across restarts.
+func (s *FileQueueStorage) Schedule(f *frame.Frame) (uint64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	rec, err := s.append(opEnqueue, 0, MinPriority, scheduledQueue, encodeFrame(f))
+	if err != nil {
+		return 0, err
+	}
+	s.index(rec, false)
+	return rec.seq, nil
+}
+
+func (s *FileQueueStorage) Unschedule(id uint64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	e, ok := s.records[id]
+	if !ok {
+		return nil
+	}
+	return s.drop(e.Value.(*fileRecord))
+}
+
+func (s *FileQueueStorage) Scheduled() (map[uint64]*frame.Frame, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.err != nil {
+		return nil, s.err
+	}
+	scheduled := make(map[uint64]*frame.Frame)
+	for seq, e := range s.records {
+		rec := e.Value.(*fileRecord)
+		if rec.queue != scheduledQueue {
+			continue
+		}
+		f, err := s.read(rec)
+		if err != nil {
+			return nil, err
+		}
+		scheduled[seq] = f
+	}
+	return scheduled, nil
+}
+
+// index adds a record to the queue, at the head if requeued.
+func (s *FileQueueStorage) index(rec *fileRecord, head bool) {
+	l, ok := s.queues[rec.queue]
+	if !ok {
+		l = &priorityList{}
+		s.queues[rec.queue] = l
+	}
+	if head {
+		s.records[rec.seq] = l.PushFront(rec.priority, rec)
+	} else {
+		s.records[rec.seq] = l.PushBack(rec.priority, rec)
+	}
+	rec.segment.live++
+	s.live += int64(rec.length)
+}
+
+// drop appends a dequeue record for a stored message,
+// and takes the message out of the index.
+func (s *FileQueueStorage) drop(rec *fileRecord) error {
+	if _, err := s.append(opDequeue, rec.seq, rec.priority, rec.queue, nil); err != nil {
+		return err
+	}
+	s.remove(rec)
+	s.compact()
+	return nil
+}
+
+// remove takes a dequeued record out of the index.
+func (s *FileQueueStorage) remove(rec *fileRecord) {
+	e := s.records[rec.seq]
+	delete(s.records, rec.seq)
+	l := s.queues[rec.queue]
+	l.Remove(rec.priority, e)
+	if l.Len() == 0 {
+		delete(s.queues, rec.queue)
+	}
+	rec.segment.live--
+	s.live -= int64(rec.length)
+}
+
+// compact deletes the oldest segments, as long as all their messages have
+// been dequeued. Newer segments are kept even if they are fully consumed,
+// because their dequeue records may refer to messages in older segments.
+// If that leaves more than a segment of records that are no longer needed,
+// and more than there are records of stored messages, the stored messages
+// are copied forward by rewrite.
+func (s *FileQueueStorage) compact() {
+	for len(s.segments) > 1 && s.segments[0].live == 0 {
+		s.deleteSegment(s.segments[0])
+		s.segments = s.segments[1:]
+	}
+
+	var size int64
+	for _, seg := range s.segments {
+		size += seg.size
+	}
+	if dead := size - s.live; len(s.segments) > 1 && dead >= s.options.SegmentSize && dead > s.live {
+		if err := s.rewrite(); err != nil {
+			log.Errorf("file queue storage %s: rewrite: %s", s.dir, err.Error())
+		}
+	}
+}
+
+// rewrite copies the records of the stored messages into a new segment,
+// queue by queue and in queue order, then deletes all the older segments.
+// The copies are enqueue records with the sequence numbers of the messages,
+// which replay moves to the back of their priority. The new segment is only
+// named as a segment once complete, so that replaying the log gives the
+// same queues whether or not the older segments have been deleted.
+func (s *FileQueueStorage) rewrite() error {
+	if err := s.sync(); err != nil {
+		return err
+	}
+	id := s.segments[len(s.segments)-1].id + 1
+	tmp := s.segmentPath(id) + tmpExt
+	file, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	seg := &fileSegment{id: id, file: file}
+
+	offsets := make(map[*fileRecord]int64)
+	for _, l := range s.queues {
+		l.Each(func(e *list.Element) bool {
+			rec := e.Value.(*fileRecord)
+			record := make([]byte, rec.length)
+			if _, err = rec.segment.file.ReadAt(record, rec.offset); err != nil {
+				return false
+			}
+			record[recordHeader] = opEnqueue
+			binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(record[recordHeader:]))
+			if _, err = file.WriteAt(record, seg.size); err != nil {
+				return false
+			}
+			offsets[rec] = seg.size
+			seg.size += int64(len(record))
+			return true
+		})
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp, s.segmentPath(id))
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	// the old segments are only deleted once the rename is durable
+	if err := syncDir(s.dir); err != nil {
+		file.Close()
+		return err
+	}
+
+	for rec, offset := range offsets {
+		rec.segment.live--
+		rec.segment = seg
+		rec.offset = offset
+		seg.live++
+	}
+	old := s.segments
+	s.segments = []*fileSegment{seg}
+	for _, seg := range old {
+		s.deleteSegment(seg)
+	}
+	// the copies are not written to
+	_, err = s.roll()
+	return err
+}
+
+// syncDir syncs a directory, so that the files renamed
+// in it keep their new names if the system crashes.
+func syncDir(path string) error {
+	if runtime.GOOS == "windows" {
+		// directories cannot be opened for syncing
+		return nil
+	}
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+func (s *FileQueueStorage) deleteSegment(seg *fileSegment) {
+	seg.file.Close()
+	// a segment written by rewrite was opened under another name
+	if err := os.Remove(s.segmentPath(seg.id)); err != nil {
+		log.Errorf("file queue storage %s: %s", s.dir, err.Error())
+	}
+}
+
+// append writes a record to the active segment, starting a new segment
+// first if it is full. For dequeue records, seq is the sequence number of
+// the dequeued message; otherwise a new sequence number is allocated.
+func (s *FileQueueStorage) append(op byte, seq uint64, priority int, queue string, data []byte) (*fileRecord, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	seg := s.segments[len(s.segments)-1]
+	if seg.size >= s.options.SegmentSize {
+		var err error
+		if seg, err = s.roll(); err != nil {
+			return nil, err
+		}
+	}
+	if op != opDequeue {
+		s.seq++
+		seq = s.seq
+	}
+
+	var payload bytes.Buffer
+	payload.WriteByte(op)
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], seq)
+	payload.Write(b[:])
+	payload.WriteByte(byte(priority))
+	writeBytes(&payload, []byte(queue))
+	payload.Write(data)
+
+	record := make([]byte, recordHeader, recordHeader+payload.Len())
+	binary.BigEndian.PutUint32(record[0:4], uint32(payload.Len()))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload.Bytes()))
+	record = append(record, payload.Bytes()...)
+
+	if _, err := seg.file.WriteAt(record, seg.size); err != nil {
+		// a partial record is truncated when the log is recovered
+		return nil, err
+	}
+	rec := &fileRecord{
+		seq:      seq,
+		priority: priority,
+		queue:    queue,
+		segment:  seg,
+		offset:   seg.size,
+		length:   len(record),
+	}
+	seg.size += int64(len(record))
+
+	if s.options.Sync == SyncAlways {
+		if err := seg.file.Sync(); err != nil {
+			return nil, err
+		}
+	} else {
+		s.dirty = true
+	}
+	return rec, nil
+}
+
+// read returns the frame of a stored message.
+func (s *FileQueueStorage) read(rec *fileRecord) (*frame.Frame, error) {
+	record := make([]byte, rec.length)
+	if _, err := rec.segment.file.ReadAt(record, rec.offset); err != nil {
+		return nil, err
+	}
+	_, _, _, _, data, err := parseRecord(record[recordHeader:])
+	if err != nil {
+		return nil, err
+	}
+	return decodeFrame(data)
+}
+
+// roll syncs the active segment and starts a new one.
+func (s *FileQueueStorage) roll() (*fileSegment, error) {
+	if err := s.sync(); err != nil {
+		return nil, err
+	}
+	id := uint64(1)
+	if len(s.segments) > 0 {
+		id = s.segments[len(s.segments)-1].id + 1
+	}
+	file, err := os.OpenFile(s.segmentPath(id), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	seg := &fileSegment{id: id, file: file}
+	s.segments = append(s.segments, seg)
+	return seg, nil
+}
+
+func (s *FileQueueStorage) segmentPath(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%016x%s", id, segmentExt))
+}
+
+func (s *FileQueueStorage) sync() error {
+	if !s.dirty || len(s.segments) == 0 {
+		return nil
+	}
+	if err := s.segments[len(s.segments)-1].file.Sync(); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+func (s *FileQueueStorage) syncLoop(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(s.options.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.mutex.Lock()
+			if s.err == nil {
+				if err := s.sync(); err != nil {
+					log.Errorf("file queue storage %s: %s", s.dir, err.Error())
+				}
+			}
+			s.mutex.Unlock()
+		}
+	}
+}
+
+func (s *FileQueueStorage) closeSegments() {
+	for _, seg := range s.segments {
+		seg.file.Close()
+	}
+	s.segments = nil
+}
+
+// recover replays the segments in the directory, oldest first,
+// then starts a new segment for writing.
+func (s *FileQueueStorage) recover() error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	names, err := filepath.Glob(filepath.Join(s.dir, "*"+segmentExt))
+	if err != nil {
+		return err
+	}
+	// left by a rewrite that did not complete
+	tmps, err := filepath.Glob(filepath.Join(s.dir, "*"+segmentExt+tmpExt))
+	if err != nil {
+		return err
+	}
+	for _, name := range tmps {
+		if err := os.Remove(name); err != nil {
+			return err
+		}
+	}
+	var ids []uint64
+	for _, name := range names {
+		id, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), segmentExt), 16, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		file, err := os.OpenFile(s.segmentPath(id), os.O_RDWR, 0644)
+		if err != nil {
+			return err
+		}
+		seg := &fileSegment{id: id, file: file}
+		s.segments = append(s.segments, seg)
+		if err := s.replay(seg); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.roll(); err != nil {
+		return err
+	}
+	s.compact()
+	return nil
+}
+
+// replay applies the records of a segment to the index. The segment is
+// truncated at the first record that is incomplete or corrupt.
+func (s *FileQueueStorage) replay(seg *fileSegment) error {
+	info, err := seg.file.Stat()
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(seg.file)
+	var header [recordHeader]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if err != io.EOF {
+				return s.truncate(seg, err)
+			}
+			return nil
+		}
+		length := binary.BigEndian.Uint32(header[0:4])
+		if seg.size+recordHeader+int64(length) > info.Size() {
+			return s.truncate(seg, io.ErrUnexpectedEOF)
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return s.truncate(seg, err)
+		}
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+			return s.truncate(seg, errors.New("checksum mismatch"))
+		}
+		op, seq, priority, queue, _, err := parseRecord(payload)
+		if err != nil {
+			return s.truncate(seg, err)
+		}
+
+		rec := &fileRecord{
+			seq:      seq,
+			priority: priority,
+			queue:    queue,
+			segment:  seg,
+			offset:   seg.size,
+			length:   recordHeader + len(payload),
+		}
+		seg.size += int64(rec.length)
+		if seq > s.seq {
+			s.seq = seq
+		}
+
+		switch op {
+		case opEnqueue:
+			// copied forward by rewrite, if already indexed
+			if e, ok := s.records[seq]; ok {
+				s.remove(e.Value.(*fileRecord))
+			}
+			s.index(rec, false)
+		case opRequeue:
+			s.index(rec, true)
+		case opDequeue:
+			// the message may be in a segment already deleted
+			if e, ok := s.records[seq]; ok {
+				s.remove(e.Value.(*fileRecord))
+			}
+		}
+	}
+}
+
+func (s *FileQueueStorage) truncate(seg *fileSegment, reason error) error {
+	log.Errorf("file queue storage %s: truncating %s at %d: %s",
+		s.dir, seg.file.Name(), seg.size, reason.Error())
+	return seg.file.Truncate(seg.size)
+}
+
+// parseRecord splits the payload of a record.
+func parseRecord(payload []byte) (op byte, seq uint64, priority int, queue string, data []byte, err error) {
+	if len(payload) < 10 {
+		return 0, 0, 0, "", nil, errInvalidFrameData
+	}
+	op = payload[0]
+	seq = binary.BigEndian.Uint64(payload[1:9])
+	priority = int(payload[9])
+	r := bytes.NewReader(payload[10:])
+	name, err := readBytes(r)
+	if err != nil {
+		return 0, 0, 0, "", nil, err
+	}
+	switch op {
+	case opEnqueue, opRequeue, opDequeue:
+	default:
+		return 0, 0, 0, "", nil, errInvalidFrameData
+	}
+	if priority > MaxPriority {
+		return 0, 0, 0, "", nil, errInvalidFrameData
+	}
+	return op, seq, priority, string(name), payload[len(payload)-r.Len():], nil
+}
@@ -0,0 +1,235 @@
+package queue
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/go-stomp/stomp/frame"
+	. "gopkg.in/check.v1"
+)
+
+type FileQueueSuite struct {
+	dir string
+}
+
+var _ = Suite(&FileQueueSuite{})
+
+func (s *FileQueueSuite) SetUpTest(c *C) {
+	dir, err := ioutil.TempDir("", "file-queue")
+	c.Assert(err, IsNil)
+	s.dir = dir
+}
+
+func (s *FileQueueSuite) TearDownTest(c *C) {
+	os.RemoveAll(s.dir)
+}
+
+func (s *FileQueueSuite) segments(c *C) []string {
+	names, err := filepath.Glob(filepath.Join(s.dir, "*"+segmentExt))
+	c.Assert(err, IsNil)
+	return names
+}
+
+func (s *FileQueueSuite) TestEnqueueRequeueDequeue(c *C) {
+	fq := NewFileQueueStorage(s.dir, FileQueueOptions{Sync: SyncAlways})
+	c.Assert(fq.Start(), IsNil)
+	defer fq.Stop()
+
+	f1 := frame.New(frame.MESSAGE, frame.Destination, "/queue/test")
+	f1.Body = []byte("one\x00with a null byte")
+	f2 := frame.New(frame.MESSAGE, frame.Destination, "/queue/test")
+	f2.Body = []byte("two")
+	f3 := frame.New(frame.MESSAGE, frame.Destination, "/queue/test")
+	f3.Body = []byte("three")
+
+	c.Assert(fq.Enqueue("/queue/test", f1), IsNil)
+	c.Assert(fq.Enqueue("/queue/test", f2), IsNil)
+	c.Assert(fq.Requeue("/queue/test", f3), IsNil)
+	c.Assert(fq.Count("/queue/test"), Equals, 3)
+	c.Assert(fq.Count("/queue/other"), Equals, 0)
+
+	for _, expected := range []*frame.Frame{f3, f1, f2} {
+		f, err := fq.Dequeue("/queue/test")
+		c.Assert(err, IsNil)
+		c.Assert(f, NotNil)
+		c.Check(f.Command, Equals, expected.Command)
+		c.Check(f.Header.Get(frame.Destination), Equals, "/queue/test")
+		c.Check(string(f.Body), Equals, string(expected.Body))
+	}
+
+	f, err := fq.Dequeue("/queue/test")
+	c.Assert(err, IsNil)
+	c.Assert(f, IsNil)
+}
+
+func (s *FileQueueSuite) TestRecovery(c *C) {
+	fq := NewFileQueueStorage(s.dir, FileQueueOptions{Sync: SyncNever})
+	c.Assert(fq.Start(), IsNil)
+	for _, body := range []string{"1", "2", "3"} {
+		f := frame.New(frame.MESSAGE, frame.Destination, "/queue/a")
+		f.Body = []byte(body)
+		c.Assert(fq.Enqueue("/queue/a", f), IsNil)
+	}
+	c.Assert(fq.Enqueue("/queue/b", frame.New(frame.MESSAGE)), IsNil)
+	f, err := fq.Dequeue("/queue/a")
+	c.Assert(err, IsNil)
+	c.Assert(string(f.Body), Equals, "1")
+	c.Assert(fq.Requeue("/queue/a", f), IsNil)
+	f, err = fq.Dequeue("/queue/a")
+	c.Assert(err, IsNil)
+	c.Assert(string(f.Body), Equals, "1")
+	c.Assert(fq.Stop(), IsNil)
+
+	c.Assert(fq.Enqueue("/queue/a", frame.New(frame.MESSAGE)), Equals, ErrStorageStopped)
+
+	fq = NewFileQueueStorage(s.dir, FileQueueOptions{})
+	c.Assert(fq.Start(), IsNil)
+	defer fq.Stop()
+	c.Assert(fq.Count("/queue/a"), Equals, 2)
+	c.Assert(fq.Count("/queue/b"), Equals, 1)
+	f, err = fq.Dequeue("/queue/a")
+	c.Assert(err, IsNil)
+	c.Assert(string(f.Body), Equals, "2")
+}
+
+func (s *FileQueueSuite) TestTruncatedRecord(c *C) {
+	fq := NewFileQueueStorage(s.dir, FileQueueOptions{Sync: SyncAlways})
+	c.Assert(fq.Start(), IsNil)
+	c.Assert(fq.Enqueue("/queue/a", frame.New(frame.MESSAGE)), IsNil)
+	c.Assert(fq.Enqueue("/queue/a", frame.New(frame.MESSAGE)), IsNil)
+	c.Assert(fq.Stop(), IsNil)
+
+	// simulate a crash in the middle of writing the second record
+	names := s.segments(c)
+	name := names[len(names)-1]
+	info, err := os.Stat(name)
+	c.Assert(err, IsNil)
+	c.Assert(os.Truncate(name, info.Size()-3), IsNil)
+
+	c.Assert(fq.Start(), IsNil)
+	c.Assert(fq.Count("/queue/a"), Equals, 1)
+	c.Assert(fq.Enqueue("/queue/a", frame.New(frame.MESSAGE)), IsNil)
+	c.Assert(fq.Stop(), IsNil)
+
+	c.Assert(fq.Start(), IsNil)
+	defer fq.Stop()
+	c.Assert(fq.Count("/queue/a"), Equals, 2)
+}
+
+func (s *FileQueueSuite) TestCompaction(c *C) {
+	fq := NewFileQueueStorage(s.dir, FileQueueOptions{Sync: SyncNever, SegmentSize: 64})
+	c.Assert(fq.Start(), IsNil)
+	defer fq.Stop()
+
+	for i := 0; i < 10; i++ {
+		f := frame.New(frame.MESSAGE, frame.Destination, "/queue/a")
+		f.Body = []byte("a message body that fills a segment")
+		c.Assert(fq.Enqueue("/queue/a", f), IsNil)
+	}
+	c.Assert(len(s.segments(c)) > 5, Equals, true)
+
+	for i := 0; i < 10; i++ {
+		f, err := fq.Dequeue("/queue/a")
+		c.Assert(err, IsNil)
+		c.Assert(f, NotNil)
+	}
+	c.Assert(len(s.segments(c)), Equals, 1)
+	c.Assert(fq.Count("/queue/a"), Equals, 0)
+}
+
+func (s *FileQueueSuite) TestRewrite(c *C) {
+	fq := NewFileQueueStorage(s.dir, FileQueueOptions{Sync: SyncNever, SegmentSize: 256})
+	c.Assert(fq.Start(), IsNil)
+
+	// messages that are never dequeued, in the oldest segment
+	enqueue := func(queue, body string) {
+		f := frame.New(frame.MESSAGE, frame.Destination, queue)
+		f.Body = []byte(body)
+		c.Assert(fq.Enqueue(queue, f), IsNil)
+	}
+	enqueue("/queue/kept", "1")
+	enqueue("/queue/kept", "2")
+	f := frame.New(frame.MESSAGE, frame.Destination, "/queue/kept", frame.Priority, "4")
+	f.Body = []byte("0")
+	c.Assert(fq.Requeue("/queue/kept", f), IsNil)
+	enqueue("/queue/kept", "3")
+
+	// the log does not grow with the messages that come and go
+	for i := 0; i < 200; i++ {
+		enqueue("/queue/busy", "a message body that fills a segment")
+		f, err := fq.Dequeue("/queue/busy")
+		c.Assert(err, IsNil)
+		c.Assert(f, NotNil)
+	}
+	c.Check(len(s.segments(c)) <= 4, Equals, true)
+	c.Check(fq.Count("/queue/kept"), Equals, 4)
+	c.Assert(fq.Stop(), IsNil)
+
+	fq = NewFileQueueStorage(s.dir, FileQueueOptions{})
+	c.Assert(fq.Start(), IsNil)
+	defer fq.Stop()
+	c.Check(fq.Count("/queue/busy"), Equals, 0)
+	for _, body := range []string{"0", "1", "2", "3"} {
+		f, err := fq.Dequeue("/queue/kept")
+		c.Assert(err, IsNil)
+		c.Assert(f, NotNil)
+		c.Check(string(f.Body), Equals, body)
+	}
+}
+
+func (s *FileQueueSuite) TestRewriteInterrupted(c *C) {
+	fq := NewFileQueueStorage(s.dir, FileQueueOptions{Sync: SyncAlways, SegmentSize: 256})
+	c.Assert(fq.Start(), IsNil)
+	for _, body := range []string{"1", "2", "3"} {
+		f := frame.New(frame.MESSAGE, frame.Destination, "/queue/kept")
+		f.Body = []byte(body)
+		c.Assert(fq.Enqueue("/queue/kept", f), IsNil)
+	}
+	f, err := fq.Dequeue("/queue/kept")
+	c.Assert(err, IsNil)
+	c.Assert(fq.Requeue("/queue/kept", f), IsNil)
+	c.Assert(fq.Stop(), IsNil)
+
+	// keep the segments, as if the rewrite had not deleted them
+	old := make(map[string][]byte)
+	for _, name := range s.segments(c) {
+		data, err := ioutil.ReadFile(name)
+		c.Assert(err, IsNil)
+		old[name] = data
+	}
+
+	c.Assert(fq.Start(), IsNil)
+	for i := 0; i < 50; i++ {
+		f := frame.New(frame.MESSAGE, frame.Destination, "/queue/busy")
+		f.Body = []byte("a message body that fills a segment")
+		c.Assert(fq.Enqueue("/queue/busy", f), IsNil)
+		_, err := fq.Dequeue("/queue/busy")
+		c.Assert(err, IsNil)
+	}
+	c.Assert(fq.Stop(), IsNil)
+	for name := range old {
+		_, err := os.Stat(name)
+		c.Assert(os.IsNotExist(err), Equals, true)
+	}
+
+	// a rewrite left incomplete is discarded
+	c.Assert(ioutil.WriteFile(filepath.Join(s.dir, "ffffffffffffffff"+segmentExt+tmpExt), []byte("partial"), 0644), IsNil)
+	for name, data := range old {
+		c.Assert(ioutil.WriteFile(name, data, 0644), IsNil)
+	}
+
+	c.Assert(fq.Start(), IsNil)
+	defer fq.Stop()
+	c.Check(fq.Count("/queue/kept"), Equals, 3)
+	c.Check(fq.Count("/queue/busy"), Equals, 0)
+	for _, body := range []string{"1", "2", "3"} {
+		f, err := fq.Dequeue("/queue/kept")
+		c.Assert(err, IsNil)
+		c.Assert(f, NotNil)
+		c.Check(string(f.Body), Equals, body)
+	}
+	tmps, err := filepath.Glob(filepath.Join(s.dir, "*"+tmpExt))
+	c.Assert(err, IsNil)
+	c.Check(tmps, HasLen, 0)
+}
@@ -0,0 +1,86 @@
+package queue
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/go-stomp/stomp/frame"
+)
+
+var errInvalidFrameData = errors.New("invalid stored frame")
+
+// encodeFrame serializes a frame for persistent queue storage. Unlike the
+// STOMP wire format, the body is length-prefixed, so it can contain NUL
+// bytes whether or not the frame has a content-length header.
+func encodeFrame(f *frame.Frame) []byte {
+	var buf bytes.Buffer
+	writeBytes(&buf, []byte(f.Command))
+	n := 0
+	if f.Header != nil {
+		n = f.Header.Len()
+	}
+	writeUvarint(&buf, uint64(n))
+	for i := 0; i < n; i++ {
+		key, value := f.Header.GetAt(i)
+		writeBytes(&buf, []byte(key))
+		writeBytes(&buf, []byte(value))
+	}
+	writeBytes(&buf, f.Body)
+	return buf.Bytes()
+}
+
+// decodeFrame reverses encodeFrame.
+func decodeFrame(data []byte) (*frame.Frame, error) {
+	r := bytes.NewReader(data)
+	command, err := readBytes(r)
+	if err != nil {
+		return nil, err
+	}
+	f := frame.New(string(command))
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, errInvalidFrameData
+	}
+	for i := uint64(0); i < n; i++ {
+		key, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		value, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		f.Header.Add(string(key), string(value))
+	}
+	if f.Body, err = readBytes(r); err != nil {
+		return nil, err
+	}
+	if len(f.Body) == 0 {
+		f.Body = nil
+	}
+	return f, nil
+}
+
+func writeUvarint(buf *bytes.Buffer, x uint64) {
+	var b [binary.MaxVarintLen64]byte
+	buf.Write(b[:binary.PutUvarint(b[:], x)])
+}
+
+func writeBytes(buf *bytes.Buffer, b []byte) {
+	writeUvarint(buf, uint64(len(b)))
+	buf.Write(b)
+}
+
+func readBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > uint64(r.Len()) {
+		return nil, errInvalidFrameData
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, errInvalidFrameData
+	}
+	return b, nil
+}
@@ -0,0 +1,258 @@
+package queue
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	"github.com/go-stomp/stomp/frame"
+	"github.com/go-stomp/stomp/server/kvstore"
+)
+
+// Keys of enqueued messages count up from this value, and keys of
+// requeued messages count down from it, so that byte order of the
+// keys is the order of the queue. Keys are prefixed by a byte that
+// sorts higher priorities first.
+const kvMiddleKey = uint64(1) << 63
+
+// KVQueueStorage is a persistent implementation of the Storage interface,
+// backed by a kvstore file. Each queue is a bucket, in which the stored
+// messages are keyed by priority and sequence number. Like the kvstore,
+// it holds all the stored messages in memory.
+type KVQueueStorage struct {
+	path    string
+	options kvstore.Options
+	mutex   sync.Mutex
+	db      *kvstore.DB
+}
+
+// NewKVQueueStorage creates a queue storage that keeps its
+// messages in the file at path, which is opened by Start.
+func NewKVQueueStorage(path string, options kvstore.Options) Storage {
+	return &KVQueueStorage{path: path, options: options}
+}
+
+func (s *KVQueueStorage) Start() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	db, err := kvstore.Open(s.path, s.options)
+	if err != nil {
+		return err
+	}
+	s.db = db
+	return nil
+}
+
+func (s *KVQueueStorage) Stop() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.db == nil {
+		return nil
+	}
+	err := s.db.Close()
+	s.db = nil
+	return err
+}
+
+func (s *KVQueueStorage) Enqueue(queue string, f *frame.Frame) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.db == nil {
+		return ErrStorageStopped
+	}
+	p := Priority(f)
+	seq := kvMiddleKey
+	if _, key, n := s.db.Prefix(queue, kvPrefix(p)); n > 0 {
+		seq = binary.BigEndian.Uint64(key[1:]) + 1
+	}
+	return s.db.Put(queue, kvKey(p, seq), encodeFrame(f))
+}
+
+func (s *KVQueueStorage) Requeue(queue string, f *frame.Frame) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.db == nil {
+		return ErrStorageStopped
+	}
+	p := Priority(f)
+	seq := kvMiddleKey - 1
+	if key, _, n := s.db.Prefix(queue, kvPrefix(p)); n > 0 {
+		seq = binary.BigEndian.Uint64(key[1:]) - 1
+	}
+	return s.db.Put(queue, kvKey(p, seq), encodeFrame(f))
+}
+
+func (s *KVQueueStorage) Dequeue(queue string) (*frame.Frame, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.db == nil {
+		return nil, ErrStorageStopped
+	}
+	key, value, ok := s.db.First(queue)
+	if !ok {
+		return nil, nil
+	}
+	f, err := decodeFrame(value)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Delete(queue, key); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// errStopEach stops the iteration of a bucket by Each.
+var errStopEach = errors.New("stop")
+
+func (s *KVQueueStorage) Each(queue string, fn func(id string, f *frame.Frame) bool) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.db == nil {
+		return ErrStorageStopped
+	}
+	err := s.db.ForEach(queue, func(key, value []byte) error {
+		f, err := decodeFrame(value)
+		if err != nil {
+			return err
+		}
+		if !fn(string(key), f) {
+			return errStopEach
+		}
+		return nil
+	})
+	if err == errStopEach {
+		return nil
+	}
+	return err
+}
+
+// Remove deletes the message from the bucket of the queue,
+// the id being its key.
+func (s *KVQueueStorage) Remove(queue string, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.db == nil {
+		return ErrStorageStopped
+	}
+	if _, ok := s.db.Get(queue, []byte(id)); !ok {
+		return nil
+	}
+	return s.db.Delete(queue, []byte(id))
+}
+
+func (s *KVQueueStorage) Count(queue string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.db == nil {
+		return 0
+	}
+	return s.db.Len(queue)
+}
+
+func (s *KVQueueStorage) CountByPriority(queue string) []int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	counts := make([]int, MaxPriority+1)
+	if s.db == nil {
+		return counts
+	}
+	for p := range counts {
+		_, _, counts[p] = s.db.Prefix(queue, kvPrefix(p))
+	}
+	return counts
+}
+
+// Schedule stores the frame in a bucket of its own,
+// keyed by id in the order of scheduling.
+func (s *KVQueueStorage) Schedule(f *frame.Frame) (uint64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.db == nil {
+		return 0, ErrStorageStopped
+	}
+	id := uint64(1)
+	if key, _, ok := s.db.Last(scheduledQueue); ok {
+		id = binary.BigEndian.Uint64(key) + 1
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	if err := s.db.Put(scheduledQueue, key, encodeFrame(f)); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (s *KVQueueStorage) Unschedule(id uint64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.db == nil {
+		return ErrStorageStopped
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return s.db.Delete(scheduledQueue, key)
+}
+
+func (s *KVQueueStorage) Scheduled() (map[uint64]*frame.Frame, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.db == nil {
+		return nil, ErrStorageStopped
+	}
+	scheduled := make(map[uint64]*frame.Frame)
+	err := s.db.ForEach(scheduledQueue, func(key, value []byte) error {
+		f, err := decodeFrame(value)
+		if err != nil {
+			return err
+		}
+		scheduled[binary.BigEndian.Uint64(key)] = f
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return scheduled, nil
+}
+
+func kvPrefix(priority int) []byte {
+	return []byte{byte(MaxPriority - priority)}
+}
+
+func kvKey(priority int, seq uint64) []byte {
+	key := make([]byte, 9)
+	key[0] = byte(MaxPriority - priority)
+	binary.BigEndian.PutUint64(key[1:], seq)
+	return key
+}
+
+// InspectKVQueueStorage reads the file of a KVQueueStorage without
+// modifying it, and calls fn for every stored message, by queue and in
+// queue order, until fn returns an error. The file can be inspected while
+// a server is using it, but messages written meanwhile may be missed.
+// Scheduled messages are reported in a queue named "(scheduled)".
+func InspectKVQueueStorage(path string, fn func(queue string, f *frame.Frame) error) error {
+	db, err := kvstore.Open(path, kvstore.Options{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for _, bucket := range db.Buckets() {
+		queue := bucket
+		if queue == scheduledQueue {
+			queue = "(scheduled)"
+		}
+		err := db.ForEach(bucket, func(key, value []byte) error {
+			f, err := decodeFrame(value)
+			if err != nil {
+				return err
+			}
+			return fn(queue, f)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package queue
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/go-stomp/stomp/frame"
+	"github.com/go-stomp/stomp/server/kvstore"
+	. "gopkg.in/check.v1"
+)
+
+type KVQueueSuite struct {
+	dir string
+}
+
+var _ = Suite(&KVQueueSuite{})
+
+func (s *KVQueueSuite) SetUpTest(c *C) {
+	dir, err := ioutil.TempDir("", "kv-queue")
+	c.Assert(err, IsNil)
+	s.dir = dir
+}
+
+func (s *KVQueueSuite) TearDownTest(c *C) {
+	os.RemoveAll(s.dir)
+}
+
+func (s *KVQueueSuite) TestQueueOrderAndRestart(c *C) {
+	path := filepath.Join(s.dir, "queues.kv")
+	kq := NewKVQueueStorage(path, kvstore.Options{})
+	c.Assert(kq.Enqueue("/queue/a", frame.New(frame.MESSAGE)), Equals, ErrStorageStopped)
+	c.Assert(kq.Start(), IsNil)
+
+	for _, body := range []string{"2", "3"} {
+		f := frame.New(frame.MESSAGE, frame.Destination, "/queue/a")
+		f.Body = []byte(body)
+		c.Assert(kq.Enqueue("/queue/a", f), IsNil)
+	}
+	f := frame.New(frame.MESSAGE, frame.Destination, "/queue/a")
+	f.Body = []byte("1")
+	c.Assert(kq.Requeue("/queue/a", f), IsNil)
+	c.Assert(kq.Enqueue("/queue/b", frame.New(frame.MESSAGE)), IsNil)
+	c.Assert(kq.Count("/queue/a"), Equals, 3)
+	c.Assert(kq.Stop(), IsNil)
+
+	var inspected []string
+	err := InspectKVQueueStorage(path, func(queue string, f *frame.Frame) error {
+		inspected = append(inspected, queue+":"+string(f.Body))
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(inspected, DeepEquals, []string{"/queue/a:1", "/queue/a:2", "/queue/a:3", "/queue/b:"})
+
+	kq = NewKVQueueStorage(path, kvstore.Options{})
+	c.Assert(kq.Start(), IsNil)
+	defer kq.Stop()
+	c.Assert(kq.Count("/queue/a"), Equals, 3)
+	c.Assert(kq.Count("/queue/b"), Equals, 1)
+
+	for _, body := range []string{"1", "2", "3"} {
+		f, err := kq.Dequeue("/queue/a")
+		c.Assert(err, IsNil)
+		c.Assert(f, NotNil)
+		c.Check(f.Header.Get(frame.Destination), Equals, "/queue/a")
+		c.Check(string(f.Body), Equals, body)
+	}
+	f, err = kq.Dequeue("/queue/a")
+	c.Assert(err, IsNil)
+	c.Assert(f, IsNil)
+}
@@ -1,6 +1,10 @@
 package queue
 
 import (
+	"strings"
+	"time"
+
+	"github.com/go-stomp/stomp/frame"
 	"github.com/go-stomp/stomp/server/status"
 	"github.com/ventu-io/slf"
 )
@@ -13,13 +17,20 @@ func init() {
 
 // Queue manager.
 type Manager struct {
-	qstore Storage // handles queue storage
-	queues map[string]*Queue
+	qstore        Storage // handles queue storage
+	queues        map[string]*Queue
+	expiryDest    string            // queue for expired frames, if any
+	defaultPolicy Policy            // for queues without a policy of their own
+	policies      map[string]Policy // keyed by destination or prefix
 }
 
 // Create a queue manager with the specified queue storage mechanism
 func NewManager(qstore Storage) *Manager {
-	qm := &Manager{qstore: qstore, queues: make(map[string]*Queue)}
+	qm := &Manager{
+		qstore:   qstore,
+		queues:   make(map[string]*Queue),
+		policies: make(map[string]Policy),
+	}
 	return qm
 }
 
@@ -28,6 +39,9 @@ func (qm *Manager) Find(destination string) *Queue {
 	q, ok := qm.queues[destination]
 	if !ok {
 		q = newQueue(destination, qm.qstore)
+		q.onExpire = qm.expire
+		q.onDeadLetter = qm.deadLetter
+		q.policy = qm.policy(destination)
 		qm.queues[destination] = q
 	}
 	return q
@@ -41,3 +55,102 @@ func (qm *Manager) GetStatus() []*status.QueueStatus {
 	}
 	return result
 }
+
+// Remove forgets the queue for the given destination. Messages still
+// stored for the destination are kept, unless the queue has been purged.
+func (qm *Manager) Remove(destination string) {
+	delete(qm.queues, destination)
+}
+
+// SetExpiryDestination specifies a queue to which expired frames are
+// sent, without their expires header. Expired frames are dropped if
+// destination is empty, which is the default.
+func (qm *Manager) SetExpiryDestination(destination string) {
+	qm.expiryDest = destination
+}
+
+func (qm *Manager) expire(f *frame.Frame) {
+	if qm.expiryDest == "" {
+		return
+	}
+	destination := f.Header.Get(frame.Destination)
+	if destination == qm.expiryDest {
+		// do not send frames that expire in the expiry queue back to it
+		return
+	}
+	f.Header.Del(frame.Expires)
+	f.Header.Set(frame.OriginalDestination, destination)
+	f.Header.Set(frame.Destination, qm.expiryDest)
+	if err := qm.Find(qm.expiryDest).Enqueue(f); err != nil {
+		log.Errorf("expire %s: %s", destination, err.Error())
+	}
+}
+
+// Sweep drops the expired frames of the queues that have had no
+// subscription ready to receive a frame for the idle duration, as
+// their frames are not checked otherwise. Returns the number of
+// frames dropped.
+func (qm *Manager) Sweep(now time.Time, idle time.Duration) int {
+	dropped := 0
+	for destination, q := range qm.queues {
+		if q.Count() == 0 || now.Sub(q.lastSubscribe) < idle {
+			continue
+		}
+		n, err := q.Sweep(now)
+		if err != nil {
+			log.Errorf("sweep %s: %s", destination, err.Error())
+		}
+		dropped += n
+	}
+	return dropped
+}
+
+// SetDefaultPolicy specifies the policy of the queues
+// that have no policy specified with SetPolicy.
+func (qm *Manager) SetDefaultPolicy(p Policy) {
+	qm.defaultPolicy = p
+	qm.updatePolicies()
+}
+
+// SetPolicy specifies the policy of the queue for a destination,
+// or of all queues whose destination starts with a prefix if
+// pattern ends with "*". The longest matching pattern applies.
+func (qm *Manager) SetPolicy(pattern string, p Policy) {
+	qm.policies[pattern] = p
+	qm.updatePolicies()
+}
+
+func (qm *Manager) updatePolicies() {
+	for destination, q := range qm.queues {
+		q.policy = qm.policy(destination)
+	}
+}
+
+// policy returns the policy for the queue of a destination.
+func (qm *Manager) policy(destination string) Policy {
+	if p, ok := qm.policies[destination]; ok {
+		return p
+	}
+	policy, length := qm.defaultPolicy, -1
+	for pattern, p := range qm.policies {
+		prefix := strings.TrimSuffix(pattern, "*")
+		if prefix != pattern && len(prefix) > length && strings.HasPrefix(destination, prefix) {
+			policy, length = p, len(prefix)
+		}
+	}
+	return policy
+}
+
+// deadLetter moves a frame to a dead-letter queue. The frame keeps its
+// dead-letter-reason header, which prevents it from being moved again.
+func (qm *Manager) deadLetter(f *frame.Frame, destination string) {
+	original := f.Header.Get(frame.Destination)
+	log.Warnf("dead letter %s: %s", original, f.Header.Get(frame.DeadLetterReason))
+	f.Header.Del(frame.DeliveryCount)
+	f.Header.Del(frame.Redelivered)
+	f.Header.Set(frame.OriginalDestination, original)
+	f.Header.Set(frame.Destination, destination)
+	if err := qm.Find(destination).Enqueue(f); err != nil {
+		log.Errorf("dead letter %s: %s", original, err.Error())
+	}
+}
@@ -2,28 +2,39 @@ package queue
 
 import (
 	"container/list"
+	"strconv"
 
 	"github.com/go-stomp/stomp/frame"
 )
 
 // In-memory implementation of the QueueStorage interface.
 type MemoryQueueStorage struct {
-	lists map[string]*list.List
+	lists       map[string]*priorityList // *memoryEntry, head of the queue first
+	entries     map[string]*list.Element // keyed by id
+	lastId      uint64
+	scheduled   map[uint64]*frame.Frame
+	scheduledId uint64
+}
+
+// A stored frame, with the id passed to Each.
+type memoryEntry struct {
+	id       string
+	queue    string
+	priority int
+	frame    *frame.Frame
 }
 
 func NewMemoryQueueStorage() Storage {
-	m := &MemoryQueueStorage{lists: make(map[string]*list.List)}
+	m := &MemoryQueueStorage{
+		lists:     make(map[string]*priorityList),
+		entries:   make(map[string]*list.Element),
+		scheduled: make(map[uint64]*frame.Frame),
+	}
 	return m
 }
 
 func (m *MemoryQueueStorage) Enqueue(queue string, frame *frame.Frame) error {
-	l, ok := m.lists[queue]
-	if !ok {
-		l = list.New()
-		m.lists[queue] = l
-	}
-	l.PushBack(frame)
-
+	m.push(queue, frame, false)
 	return nil
 }
 
@@ -31,14 +42,29 @@ func (m *MemoryQueueStorage) Enqueue(queue string, frame *frame.Frame) error {
 // the "message-id" header of the frame if it is not
 // already set.
 func (m *MemoryQueueStorage) Requeue(queue string, frame *frame.Frame) error {
+	m.push(queue, frame, true)
+	return nil
+}
+
+// push adds a frame to the queue, at the head if requeued.
+func (m *MemoryQueueStorage) push(queue string, f *frame.Frame, head bool) {
 	l, ok := m.lists[queue]
 	if !ok {
-		l = list.New()
+		l = &priorityList{}
 		m.lists[queue] = l
 	}
-	l.PushFront(frame)
-
-	return nil
+	m.lastId++
+	entry := &memoryEntry{
+		id:       strconv.FormatUint(m.lastId, 10),
+		queue:    queue,
+		priority: Priority(f),
+		frame:    f,
+	}
+	if head {
+		m.entries[entry.id] = l.PushFront(entry.priority, entry)
+	} else {
+		m.entries[entry.id] = l.PushBack(entry.priority, entry)
+	}
 }
 
 // Removes a frame from the head of the queue.
@@ -49,24 +75,54 @@ func (m *MemoryQueueStorage) Dequeue(queue string) (*frame.Frame, error) {
 		return nil, nil
 	}
 
-	element := l.Front()
+	element, priority := l.Front()
 	if element == nil {
 		return nil, nil
 	}
 
-	return l.Remove(element).(*frame.Frame), nil
+	entry := l.Remove(priority, element).(*memoryEntry)
+	delete(m.entries, entry.id)
+	return entry.frame, nil
+}
+
+func (m *MemoryQueueStorage) Each(queue string, fn func(id string, f *frame.Frame) bool) error {
+	l, ok := m.lists[queue]
+	if !ok {
+		return nil
+	}
+	l.Each(func(e *list.Element) bool {
+		entry := e.Value.(*memoryEntry)
+		return fn(entry.id, entry.frame)
+	})
+	return nil
+}
+
+func (m *MemoryQueueStorage) Remove(queue string, id string) error {
+	e, ok := m.entries[id]
+	if !ok || e.Value.(*memoryEntry).queue != queue {
+		return nil
+	}
+	m.lists[queue].Remove(e.Value.(*memoryEntry).priority, e)
+	delete(m.entries, id)
+	return nil
 }
 
 // Called at server startup. Allows the queue storage
 // to perform any initialization.
-func (m *MemoryQueueStorage) Start() {
-	m.lists = make(map[string]*list.List)
+func (m *MemoryQueueStorage) Start() error {
+	m.lists = make(map[string]*priorityList)
+	m.entries = make(map[string]*list.Element)
+	m.scheduled = make(map[uint64]*frame.Frame)
+	return nil
 }
 
 // Called prior to server shutdown. Allows the queue storage
 // to perform any cleanup.
-func (m *MemoryQueueStorage) Stop() {
+func (m *MemoryQueueStorage) Stop() error {
 	m.lists = nil
+	m.entries = nil
+	m.scheduled = nil
+	return nil
 }
 
 func (m *MemoryQueueStorage) Count(queue string) int {
@@ -77,3 +133,33 @@ func (m *MemoryQueueStorage) Count(queue string) int {
 
 	return l.Len()
 }
+
+func (m *MemoryQueueStorage) CountByPriority(queue string) []int {
+	l, ok := m.lists[queue]
+	if !ok {
+		return make([]int, MaxPriority+1)
+	}
+
+	return l.Counts()
+}
+
+func (m *MemoryQueueStorage) Schedule(frame *frame.Frame) (uint64, error) {
+	m.scheduledId++
+	m.scheduled[m.scheduledId] = frame
+	return m.scheduledId, nil
+}
+
+func (m *MemoryQueueStorage) Unschedule(id uint64) error {
+	delete(m.scheduled, id)
+	return nil
+}
+
+// Scheduled frames are lost when the server stops, so there
+// are none after Start.
+func (m *MemoryQueueStorage) Scheduled() (map[uint64]*frame.Frame, error) {
+	scheduled := make(map[uint64]*frame.Frame, len(m.scheduled))
+	for id, f := range m.scheduled {
+		scheduled[id] = f
+	}
+	return scheduled, nil
+}
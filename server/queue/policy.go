@@ -0,0 +1,68 @@
+package queue
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/go-stomp/stomp/frame"
+)
+
+// Dead-letter queues are named with this prefix, followed by the
+// name of the original queue without its leading "/queue/".
+const DeadLetterPrefix = "/queue/DLQ."
+
+// Policy specifies how a queue handles messages
+// that clients fail to acknowledge.
+type Policy struct {
+	// MaxDeliveries is the number of times a message is delivered
+	// before it is moved to the dead-letter queue. Unlimited if zero.
+	MaxDeliveries int
+
+	// DeadLetterQueue is the queue to which messages are moved,
+	// DeadLetterPrefix followed by the original queue name if empty.
+	DeadLetterQueue string
+}
+
+// deadLetterQueue returns the dead-letter queue for a destination.
+func (p Policy) deadLetterQueue(destination string) string {
+	if p.DeadLetterQueue != "" {
+		return p.DeadLetterQueue
+	}
+	name := strings.TrimPrefix(destination, "/queue/")
+	return DeadLetterPrefix + strings.TrimPrefix(name, "/")
+}
+
+// exhausted reports whether a frame has been delivered
+// as many times as the policy allows.
+func (p Policy) exhausted(f *frame.Frame) bool {
+	if p.MaxDeliveries <= 0 {
+		return false
+	}
+	if _, ok := f.Header.Contains(frame.DeadLetterReason); ok {
+		// already dead-lettered once, never move it again
+		return false
+	}
+	return deliveryCount(f) >= p.MaxDeliveries
+}
+
+// deliveryCount returns the number of times a frame has been delivered.
+func deliveryCount(f *frame.Frame) int {
+	n, err := strconv.Atoi(f.Header.Get(frame.DeliveryCount))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// markDelivered counts a delivery of a frame in its delivery-count
+// header, and sets its redelivered header if it has been delivered
+// before.
+func markDelivered(f *frame.Frame) {
+	n := deliveryCount(f) + 1
+	f.Header.Set(frame.DeliveryCount, strconv.Itoa(n))
+	if n > 1 {
+		f.Header.Set(frame.Redelivered, "true")
+	} else {
+		f.Header.Del(frame.Redelivered)
+	}
+}
@@ -0,0 +1,71 @@
+package queue
+
+import (
+	"github.com/go-stomp/stomp/frame"
+	. "gopkg.in/check.v1"
+)
+
+type PolicySuite struct{}
+
+var _ = Suite(&PolicySuite{})
+
+func (s *PolicySuite) TestMarkDelivered(c *C) {
+	f := frame.New(frame.MESSAGE)
+	markDelivered(f)
+	c.Check(f.Header.Get(frame.DeliveryCount), Equals, "1")
+	_, ok := f.Header.Contains(frame.Redelivered)
+	c.Check(ok, Equals, false)
+
+	markDelivered(f)
+	c.Check(f.Header.Get(frame.DeliveryCount), Equals, "2")
+	c.Check(f.Header.Get(frame.Redelivered), Equals, "true")
+}
+
+func (s *PolicySuite) TestManagerPolicy(c *C) {
+	mgr := NewManager(NewMemoryQueueStorage())
+	mgr.SetDefaultPolicy(Policy{MaxDeliveries: 5})
+	q := mgr.Find("/queue/orders.new")
+	mgr.SetPolicy("/queue/orders.*", Policy{MaxDeliveries: 3})
+	mgr.SetPolicy("/queue/orders.new", Policy{MaxDeliveries: 2})
+	mgr.SetPolicy("/queue/*", Policy{MaxDeliveries: 0})
+
+	c.Check(q.policy.MaxDeliveries, Equals, 2)
+	c.Check(mgr.Find("/queue/orders.old").policy.MaxDeliveries, Equals, 3)
+	c.Check(mgr.Find("/queue/other").policy.MaxDeliveries, Equals, 0)
+	c.Check(mgr.Find("/topic/other").policy.MaxDeliveries, Equals, 5)
+}
+
+func (s *PolicySuite) TestDeadLetter(c *C) {
+	qstore := NewMemoryQueueStorage()
+	mgr := NewManager(qstore)
+	mgr.SetDefaultPolicy(Policy{MaxDeliveries: 2})
+	q := mgr.Find("/queue/test")
+
+	f := frame.New(frame.MESSAGE, frame.Destination, "/queue/test")
+	markDelivered(f)
+	c.Assert(q.Requeue(f), IsNil)
+	c.Assert(q.Count(), Equals, 1)
+	f, err := qstore.Dequeue("/queue/test")
+	c.Assert(err, IsNil)
+
+	markDelivered(f)
+	c.Assert(q.Requeue(f), IsNil)
+	c.Assert(q.Count(), Equals, 0)
+	c.Assert(q.GetStatus().DeadLetterCount, Equals, int64(1))
+
+	dlq := mgr.Find("/queue/DLQ.test")
+	c.Assert(dlq.Count(), Equals, 1)
+	f, err = qstore.Dequeue("/queue/DLQ.test")
+	c.Assert(err, IsNil)
+	c.Check(f.Header.Get(frame.Destination), Equals, "/queue/DLQ.test")
+	c.Check(f.Header.Get(frame.OriginalDestination), Equals, "/queue/test")
+	c.Check(f.Header.Get(frame.DeadLetterReason), Matches, ".*2 times.*")
+	_, ok := f.Header.Contains(frame.DeliveryCount)
+	c.Check(ok, Equals, false)
+
+	// messages in the dead-letter queue are not moved again
+	markDelivered(f)
+	markDelivered(f)
+	c.Assert(dlq.Requeue(f), IsNil)
+	c.Assert(dlq.Count(), Equals, 1)
+}
@@ -0,0 +1,97 @@
+package queue
+
+import (
+	"container/list"
+	"strconv"
+
+	"github.com/go-stomp/stomp/frame"
+)
+
+// Message priorities, from the priority header of a SEND frame.
+// Frames of a higher priority are dequeued first.
+const (
+	MinPriority     = 0
+	MaxPriority     = 9
+	DefaultPriority = 4
+)
+
+// Priority returns the priority of a frame. Frames without a valid
+// priority header have the default priority, and values out of range
+// are limited to the nearest valid priority.
+func Priority(f *frame.Frame) int {
+	value, ok := f.Header.Contains(frame.Priority)
+	if !ok {
+		return DefaultPriority
+	}
+	p, err := strconv.Atoi(value)
+	switch {
+	case err != nil:
+		return DefaultPriority
+	case p < MinPriority:
+		return MinPriority
+	case p > MaxPriority:
+		return MaxPriority
+	}
+	return p
+}
+
+// priorityList is a queue ordered by priority, and in
+// order of arrival within each priority.
+type priorityList struct {
+	lists [MaxPriority + 1]list.List
+	len   int
+}
+
+// PushBack adds a value at the end of its priority.
+func (pl *priorityList) PushBack(priority int, v interface{}) *list.Element {
+	pl.len++
+	return pl.lists[priority].PushBack(v)
+}
+
+// PushFront adds a value at the head of its priority.
+func (pl *priorityList) PushFront(priority int, v interface{}) *list.Element {
+	pl.len++
+	return pl.lists[priority].PushFront(v)
+}
+
+// Front returns the first element of the highest priority, or nil
+// if the list is empty, together with its priority.
+func (pl *priorityList) Front() (*list.Element, int) {
+	for p := MaxPriority; p >= MinPriority; p-- {
+		if e := pl.lists[p].Front(); e != nil {
+			return e, p
+		}
+	}
+	return nil, 0
+}
+
+// Each calls fn for each element, in order of priority and
+// then of position, until fn returns false.
+func (pl *priorityList) Each(fn func(e *list.Element) bool) {
+	for p := MaxPriority; p >= MinPriority; p-- {
+		for e := pl.lists[p].Front(); e != nil; e = e.Next() {
+			if !fn(e) {
+				return
+			}
+		}
+	}
+}
+
+// Remove removes an element added with the given priority.
+func (pl *priorityList) Remove(priority int, e *list.Element) interface{} {
+	pl.len--
+	return pl.lists[priority].Remove(e)
+}
+
+func (pl *priorityList) Len() int {
+	return pl.len
+}
+
+// Counts returns the number of elements of each priority.
+func (pl *priorityList) Counts() []int {
+	counts := make([]int, MaxPriority+1)
+	for p := range pl.lists {
+		counts[p] = pl.lists[p].Len()
+	}
+	return counts
+}
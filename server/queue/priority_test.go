@@ -0,0 +1,136 @@
+package queue
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/go-stomp/stomp/frame"
+	"github.com/go-stomp/stomp/server/kvstore"
+	. "gopkg.in/check.v1"
+)
+
+type PrioritySuite struct {
+	dir string
+}
+
+var _ = Suite(&PrioritySuite{})
+
+func (s *PrioritySuite) SetUpTest(c *C) {
+	dir, err := ioutil.TempDir("", "priority")
+	c.Assert(err, IsNil)
+	s.dir = dir
+}
+
+func (s *PrioritySuite) TearDownTest(c *C) {
+	os.RemoveAll(s.dir)
+}
+
+func (s *PrioritySuite) TestPriority(c *C) {
+	c.Check(Priority(frame.New(frame.SEND)), Equals, DefaultPriority)
+	c.Check(Priority(frame.New(frame.SEND, frame.Priority, "7")), Equals, 7)
+	c.Check(Priority(frame.New(frame.SEND, frame.Priority, "0")), Equals, 0)
+	c.Check(Priority(frame.New(frame.SEND, frame.Priority, "-3")), Equals, MinPriority)
+	c.Check(Priority(frame.New(frame.SEND, frame.Priority, "42")), Equals, MaxPriority)
+	c.Check(Priority(frame.New(frame.SEND, frame.Priority, "high")), Equals, DefaultPriority)
+}
+
+func (s *PrioritySuite) TestMemoryQueueStorage(c *C) {
+	s.testStorage(c, NewMemoryQueueStorage(), nil)
+}
+
+func (s *PrioritySuite) TestFileQueueStorage(c *C) {
+	s.testStorage(c, NewFileQueueStorage(s.dir, FileQueueOptions{}), func() Storage {
+		return NewFileQueueStorage(s.dir, FileQueueOptions{})
+	})
+}
+
+func (s *PrioritySuite) TestKVQueueStorage(c *C) {
+	path := filepath.Join(s.dir, "queues.kv")
+	s.testStorage(c, NewKVQueueStorage(path, kvstore.Options{}), func() Storage {
+		return NewKVQueueStorage(path, kvstore.Options{})
+	})
+}
+
+// testStorage checks that frames are dequeued by priority, and in
+// order of arrival within a priority. If reopen is not nil, the
+// order is checked again after the storage is restarted.
+func (s *PrioritySuite) testStorage(c *C, qs Storage, reopen func() Storage) {
+	c.Assert(qs.Start(), IsNil)
+
+	enqueue := func(body, priority string) {
+		f := frame.New(frame.MESSAGE, frame.Destination, "/queue/p")
+		if priority != "" {
+			f.Header.Add(frame.Priority, priority)
+		}
+		f.Body = []byte(body)
+		c.Assert(qs.Enqueue("/queue/p", f), IsNil)
+	}
+	enqueue("low", "1")
+	enqueue("normal-1", "")
+	enqueue("high-1", "8")
+	enqueue("normal-2", "4")
+	enqueue("high-2", "8")
+
+	// a requeued frame goes to the head of its priority only
+	f := frame.New(frame.MESSAGE, frame.Destination, "/queue/p", frame.Priority, "4")
+	f.Body = []byte("normal-0")
+	c.Assert(qs.Requeue("/queue/p", f), IsNil)
+
+	counts := qs.CountByPriority("/queue/p")
+	c.Assert(counts, HasLen, MaxPriority+1)
+	c.Check(counts[1], Equals, 1)
+	c.Check(counts[4], Equals, 3)
+	c.Check(counts[8], Equals, 2)
+	c.Check(qs.Count("/queue/p"), Equals, 6)
+	c.Check(qs.CountByPriority("/queue/other"), DeepEquals, make([]int, MaxPriority+1))
+
+	f, err := qs.Dequeue("/queue/p")
+	c.Assert(err, IsNil)
+	c.Assert(string(f.Body), Equals, "high-1")
+
+	// Each visits the frames in the order in which they are
+	// dequeued, and leaves them in the queue
+	var bodies []string
+	ids := make(map[string]string)
+	c.Assert(qs.Each("/queue/p", func(id string, f *frame.Frame) bool {
+		bodies = append(bodies, string(f.Body))
+		ids[string(f.Body)] = id
+		return true
+	}), IsNil)
+	c.Check(bodies, DeepEquals, []string{"high-2", "normal-0", "normal-1", "normal-2", "low"})
+	bodies = nil
+	c.Assert(qs.Each("/queue/p", func(id string, f *frame.Frame) bool {
+		bodies = append(bodies, string(f.Body))
+		return len(bodies) < 2
+	}), IsNil)
+	c.Check(bodies, DeepEquals, []string{"high-2", "normal-0"})
+	c.Assert(qs.Each("/queue/other", func(id string, f *frame.Frame) bool {
+		c.Error("frame in empty queue")
+		return true
+	}), IsNil)
+
+	// Remove takes out a single frame of its own queue
+	c.Assert(qs.Remove("/queue/other", ids["normal-1"]), IsNil)
+	c.Assert(qs.Remove("/queue/p", ids["normal-1"]), IsNil)
+	c.Assert(qs.Remove("/queue/p", ids["normal-1"]), IsNil)
+	c.Assert(qs.Remove("/queue/p", "unknown"), IsNil)
+	c.Check(qs.Count("/queue/p"), Equals, 4)
+
+	if reopen != nil {
+		c.Assert(qs.Stop(), IsNil)
+		qs = reopen()
+		c.Assert(qs.Start(), IsNil)
+	}
+
+	for _, body := range []string{"high-2", "normal-0", "normal-2", "low"} {
+		f, err := qs.Dequeue("/queue/p")
+		c.Assert(err, IsNil)
+		c.Assert(f, NotNil)
+		c.Check(string(f.Body), Equals, body)
+	}
+	f, err = qs.Dequeue("/queue/p")
+	c.Assert(err, IsNil)
+	c.Assert(f, IsNil)
+	c.Assert(qs.Stop(), IsNil)
+}
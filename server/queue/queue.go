@@ -4,6 +4,9 @@ Package queue provides implementations of server-side queues.
 package queue
 
 import (
+	"strconv"
+	"time"
+
 	"github.com/go-stomp/stomp/frame"
 	"github.com/go-stomp/stomp/server/client"
 	"github.com/go-stomp/stomp/server/status"
@@ -11,11 +14,18 @@ import (
 
 // Queue for storing message frames.
 type Queue struct {
-	destination  string
-	qstore       Storage
-	totalCount   int64
-	currentCount int
-	subs         *client.SubscriptionList
+	destination         string
+	qstore              Storage
+	totalCount          int64
+	currentCount        int
+	expiredCount        int64
+	currentExpiredCount int
+	deadLetterCount     int64
+	lastSubscribe       time.Time // when a subscription was last ready for a frame
+	policy              Policy
+	onExpire            func(f *frame.Frame)
+	onDeadLetter        func(f *frame.Frame, destination string)
+	subs                *client.SubscriptionList
 }
 
 // Create a new queue -- called from the queue manager only.
@@ -29,34 +39,97 @@ func newQueue(destination string, qstore Storage) *Queue {
 
 func (q *Queue) GetStatus() *status.QueueStatus {
 	queueStatus := &status.QueueStatus{
-		Dest:              q.destination,
-		MessageCount:      q.qstore.Count(q.destination),
-		TotalCount:        q.totalCount,
-		CurrentCount:      q.currentCount,
-		SubscriptionCount: q.subs.Len(),
+		Dest:                q.destination,
+		MessageCount:        q.qstore.Count(q.destination),
+		TotalCount:          q.totalCount,
+		CurrentCount:        q.currentCount,
+		SubscriptionCount:   q.subs.Len(),
+		ExpiredCount:        q.expiredCount,
+		CurrentExpiredCount: q.currentExpiredCount,
+		DeadLetterCount:     q.deadLetterCount,
+		PriorityCounts:      q.qstore.CountByPriority(q.destination),
 	}
 	q.currentCount = 0
+	q.currentExpiredCount = 0
 	return queueStatus
 }
 
+// Count returns the number of messages stored in the queue.
+func (q *Queue) Count() int {
+	return q.qstore.Count(q.destination)
+}
+
 // Add a subscription to a queue. The subscription is removed
 // whenever a frame is sent to the subscription and needs to
 // be re-added when the subscription decides that the message
-// has been received by the client.
+// has been received by the client. Expired frames are dropped.
 func (q *Queue) Subscribe(sub *client.Subscription) error {
-	// see if there is a frame available for this subscription
-	f, err := q.qstore.Dequeue(sub.Destination())
+	now := time.Now()
+	q.lastSubscribe = now
+	if sub.Selector() != nil {
+		return q.subscribeSelected(sub, now)
+	}
+	for {
+		// see if there is a frame available for this subscription
+		f, err := q.qstore.Dequeue(q.destination)
+		if err != nil {
+			return err
+		}
+		if f == nil {
+			// no frame available, so add to the subscription list
+			q.subs.Add(sub)
+		} else if q.expire(f, now) {
+			continue
+		} else {
+			// a frame is available, so send straight away without
+			// adding the subscription to the list
+			markDelivered(f)
+			sub.SendQueueFrame(f)
+		}
+		return nil
+	}
+}
+
+// subscribeSelected looks through the queue for the first frame selected
+// by the subscription, which is removed from the storage together with
+// the expired frames passed over. The other frames are left in place.
+func (q *Queue) subscribeSelected(sub *client.Subscription, now time.Time) error {
+	var selected *frame.Frame
+	var selectedId string
+	var expiredIds []string
+	var expired []*frame.Frame
+	err := q.qstore.Each(q.destination, func(id string, f *frame.Frame) bool {
+		if Expired(f, now) {
+			expiredIds = append(expiredIds, id)
+			expired = append(expired, f)
+			return true
+		}
+		if sub.Matches(f) {
+			selected, selectedId = f, id
+			return false
+		}
+		return true
+	})
 	if err != nil {
 		return err
 	}
-	if f == nil {
-		// no frame available, so add to the subscription list
+
+	for i, id := range expiredIds {
+		if err := q.qstore.Remove(q.destination, id); err != nil {
+			return err
+		}
+		q.expire(expired[i], now)
+	}
+
+	if selected == nil {
 		q.subs.Add(sub)
-	} else {
-		// a frame is available, so send straight away without
-		// adding the subscription to the list
-		sub.SendQueueFrame(f)
+		return nil
 	}
+	if err := q.qstore.Remove(q.destination, selectedId); err != nil {
+		return err
+	}
+	markDelivered(selected)
+	sub.SendQueueFrame(selected)
 	return nil
 }
 
@@ -65,20 +138,24 @@ func (q *Queue) Unsubscribe(sub *client.Subscription) {
 	q.subs.Remove(sub)
 }
 
-// Send a message to the queue. If a subscription is available
-// to receive the message, it is sent to the subscription without
+// Send a message to the queue. If a subscription that selects the
+// message is available, it is sent to the subscription without
 // making it to the queue. Otherwise, the message is queued until
 // a message is available.
 func (q *Queue) Enqueue(f *frame.Frame) error {
 	// find a subscription ready to receive the frame
 	q.totalCount++
 	q.currentCount++
-	sub := q.subs.Get()
+	if q.expire(f, time.Now()) {
+		return nil
+	}
+	sub := q.subs.GetMatching(f)
 	if sub == nil {
 		// no subscription available, add to the queue
 		return q.qstore.Enqueue(q.destination, f)
 	} else {
 		// subscription is available, send it now without adding to queue
+		markDelivered(f)
 		sub.SendQueueFrame(f)
 	}
 	return nil
@@ -88,16 +165,83 @@ func (q *Queue) Enqueue(f *frame.Frame) error {
 // failed to be sent to a client. If a subscription is available
 // to receive the message, it is sent to the subscription without
 // making it to the queue. Otherwise, the message is queued until
-// a message is available.
+// a message is available. A message that has been delivered as
+// many times as the policy of the queue allows is moved to the
+// dead-letter queue instead.
 func (q *Queue) Requeue(f *frame.Frame) error {
+	if q.expire(f, time.Now()) {
+		return nil
+	}
+	if q.policy.exhausted(f) {
+		q.deadLetterCount++
+		f.Header.Set(frame.DeadLetterReason, "delivered "+
+			strconv.Itoa(deliveryCount(f))+" times without acknowledgement")
+		if q.onDeadLetter != nil {
+			q.onDeadLetter(f, q.policy.deadLetterQueue(q.destination))
+		}
+		return nil
+	}
 	// find a subscription ready to receive the frame
-	sub := q.subs.Get()
+	sub := q.subs.GetMatching(f)
 	if sub == nil {
 		// no subscription available, add to the queue
 		return q.qstore.Requeue(q.destination, f)
 	} else {
 		// subscription is available, send it now without adding to queue
+		markDelivered(f)
 		sub.SendQueueFrame(f)
 	}
 	return nil
 }
+
+// Purge discards every message in the queue.
+func (q *Queue) Purge() error {
+	for {
+		f, err := q.qstore.Dequeue(q.destination)
+		if err != nil {
+			return err
+		}
+		if f == nil {
+			return nil
+		}
+	}
+}
+
+// Sweep drops the expired frames stored in the queue, which
+// are removed from the storage without disturbing the others.
+// Returns the number of frames dropped.
+func (q *Queue) Sweep(now time.Time) (int, error) {
+	var ids []string
+	var expired []*frame.Frame
+	err := q.qstore.Each(q.destination, func(id string, f *frame.Frame) bool {
+		if Expired(f, now) {
+			ids = append(ids, id)
+			expired = append(expired, f)
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	for i, id := range ids {
+		if err := q.qstore.Remove(q.destination, id); err != nil {
+			return i, err
+		}
+		q.expire(expired[i], now)
+	}
+	return len(ids), nil
+}
+
+// expire reports whether a frame has expired, in which
+// case it is counted and passed to onExpire.
+func (q *Queue) expire(f *frame.Frame, now time.Time) bool {
+	if !Expired(f, now) {
+		return false
+	}
+	q.expiredCount++
+	q.currentExpiredCount++
+	if q.onExpire != nil {
+		q.onExpire(f)
+	}
+	return true
+}
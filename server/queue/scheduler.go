@@ -0,0 +1,173 @@
+package queue
+
+import (
+	"container/heap"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-stomp/stomp/frame"
+	"github.com/go-stomp/stomp/server/status"
+)
+
+// DeliveryTime returns the time at which a frame is to be delivered, from
+// its deliver-at header in milliseconds since the Unix epoch. Returns false
+// if the frame is delivered immediately.
+func DeliveryTime(f *frame.Frame) (time.Time, bool) {
+	value, ok := f.Header.Contains(frame.DeliverAt)
+	if !ok {
+		return time.Time{}, false
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ms <= 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, ms*int64(time.Millisecond)), true
+}
+
+// Scheduler holds frames until they are due for delivery. The frames are
+// kept in the queue storage while they are scheduled, and in a heap ordered
+// by delivery time.
+type Scheduler struct {
+	qstore Storage
+	frames scheduleHeap
+	counts map[string]int // scheduled frames by destination
+}
+
+// A ScheduledFrame is a frame in the schedule, with its
+// id in the queue storage.
+type ScheduledFrame struct {
+	Id          uint64
+	Destination string // from the frame when it was scheduled
+	Frame       *frame.Frame
+	at          time.Time
+}
+
+// NewScheduler creates a scheduler that keeps frames in qstore.
+func NewScheduler(qstore Storage) *Scheduler {
+	return &Scheduler{
+		qstore: qstore,
+		counts: make(map[string]int),
+	}
+}
+
+// Load reads the frames that were scheduled before the queue
+// storage was started.
+func (s *Scheduler) Load() error {
+	scheduled, err := s.qstore.Scheduled()
+	if err != nil {
+		return err
+	}
+	for id, f := range scheduled {
+		s.push(id, f)
+	}
+	return nil
+}
+
+// Schedule stores a frame until its delivery time. The frame
+// must have a destination header.
+func (s *Scheduler) Schedule(f *frame.Frame) error {
+	id, err := s.qstore.Schedule(f)
+	if err != nil {
+		return err
+	}
+	s.push(id, f)
+	return nil
+}
+
+func (s *Scheduler) push(id uint64, f *frame.Frame) {
+	at, _ := DeliveryTime(f)
+	dest := f.Header.Get(frame.Destination)
+	heap.Push(&s.frames, &ScheduledFrame{Id: id, Destination: dest, Frame: f, at: at})
+	s.counts[dest]++
+}
+
+// Next returns the delivery time of the next scheduled frame,
+// or false if there is none.
+func (s *Scheduler) Next() (time.Time, bool) {
+	if len(s.frames) == 0 {
+		return time.Time{}, false
+	}
+	return s.frames[0].at, true
+}
+
+// Due takes the frames whose delivery time has come out of the schedule,
+// and returns them in order of delivery time. The frames are kept in the
+// queue storage until they are removed with Unschedule, once delivered,
+// so that they are not lost if they cannot be delivered.
+func (s *Scheduler) Due(now time.Time) []*ScheduledFrame {
+	var due []*ScheduledFrame
+	for len(s.frames) > 0 && !now.Before(s.frames[0].at) {
+		sf := heap.Pop(&s.frames).(*ScheduledFrame)
+		if s.counts[sf.Destination]--; s.counts[sf.Destination] == 0 {
+			delete(s.counts, sf.Destination)
+		}
+		due = append(due, sf)
+	}
+	return due
+}
+
+// Unschedule removes a frame returned by Due from the
+// queue storage, once it has been delivered.
+func (s *Scheduler) Unschedule(sf *ScheduledFrame) error {
+	return s.qstore.Unschedule(sf.Id)
+}
+
+// Retry puts a frame returned by Due back in the schedule,
+// to be delivered at a later time.
+func (s *Scheduler) Retry(sf *ScheduledFrame, at time.Time) {
+	sf.at = at
+	heap.Push(&s.frames, sf)
+	s.counts[sf.Destination]++
+}
+
+// Count returns the number of scheduled frames.
+func (s *Scheduler) Count() int {
+	return len(s.frames)
+}
+
+// GetStatus returns the number of scheduled frames for each destination.
+func (s *Scheduler) GetStatus() []*status.ScheduledStatus {
+	result := make([]*status.ScheduledStatus, 0, len(s.counts))
+	for dest, count := range s.counts {
+		result = append(result, &status.ScheduledStatus{
+			Dest:         dest,
+			MessageCount: count,
+		})
+	}
+	sort.Sort(scheduledStatusByDest(result))
+	return result
+}
+
+type scheduledStatusByDest []*status.ScheduledStatus
+
+func (a scheduledStatusByDest) Len() int           { return len(a) }
+func (a scheduledStatusByDest) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a scheduledStatusByDest) Less(i, j int) bool { return a[i].Dest < a[j].Dest }
+
+// scheduleHeap implements heap.Interface, earliest delivery time first,
+// and in order of scheduling for the same time.
+type scheduleHeap []*ScheduledFrame
+
+func (h scheduleHeap) Len() int      { return len(h) }
+func (h scheduleHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h scheduleHeap) Less(i, j int) bool {
+	if h[i].at.Equal(h[j].at) {
+		return h[i].Id < h[j].Id
+	}
+	return h[i].at.Before(h[j].at)
+}
+
+func (h *scheduleHeap) Push(x interface{}) {
+	*h = append(*h, x.(*ScheduledFrame))
+}
+
+func (h *scheduleHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return x
+}
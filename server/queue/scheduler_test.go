@@ -0,0 +1,183 @@
+package queue
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/go-stomp/stomp/frame"
+	"github.com/go-stomp/stomp/server/kvstore"
+	. "gopkg.in/check.v1"
+)
+
+type SchedulerSuite struct {
+	dir string
+}
+
+var _ = Suite(&SchedulerSuite{})
+
+func (s *SchedulerSuite) SetUpTest(c *C) {
+	dir, err := ioutil.TempDir("", "scheduler")
+	c.Assert(err, IsNil)
+	s.dir = dir
+}
+
+func (s *SchedulerSuite) TearDownTest(c *C) {
+	os.RemoveAll(s.dir)
+}
+
+func scheduledFrameAt(dest, body string, at time.Time) *frame.Frame {
+	ms := at.UnixNano() / int64(time.Millisecond)
+	f := frame.New(frame.MESSAGE,
+		frame.Destination, dest,
+		frame.DeliverAt, strconv.FormatInt(ms, 10))
+	f.Body = []byte(body)
+	return f
+}
+
+func (s *SchedulerSuite) TestDeliveryTime(c *C) {
+	_, ok := DeliveryTime(frame.New(frame.SEND))
+	c.Check(ok, Equals, false)
+	_, ok = DeliveryTime(frame.New(frame.SEND, frame.DeliverAt, "soon"))
+	c.Check(ok, Equals, false)
+	at, ok := DeliveryTime(frame.New(frame.SEND, frame.DeliverAt, "1500"))
+	c.Check(ok, Equals, true)
+	c.Check(at.Equal(time.Unix(1, 500*int64(time.Millisecond))), Equals, true)
+}
+
+func (s *SchedulerSuite) TestDue(c *C) {
+	qs := NewMemoryQueueStorage()
+	c.Assert(qs.Start(), IsNil)
+	sc := NewScheduler(qs)
+
+	now := time.Unix(1000, 0)
+	c.Assert(sc.Schedule(scheduledFrameAt("/queue/a", "3", now.Add(3*time.Second))), IsNil)
+	c.Assert(sc.Schedule(scheduledFrameAt("/queue/a", "1", now.Add(time.Second))), IsNil)
+	c.Assert(sc.Schedule(scheduledFrameAt("/topic/b", "2", now.Add(2*time.Second))), IsNil)
+	c.Assert(sc.Count(), Equals, 3)
+
+	next, ok := sc.Next()
+	c.Assert(ok, Equals, true)
+	c.Check(next.Equal(now.Add(time.Second)), Equals, true)
+
+	st := sc.GetStatus()
+	c.Assert(st, HasLen, 2)
+	c.Check(st[0].Dest, Equals, "/queue/a")
+	c.Check(st[0].MessageCount, Equals, 2)
+	c.Check(st[1].Dest, Equals, "/topic/b")
+	c.Check(st[1].MessageCount, Equals, 1)
+
+	c.Check(sc.Due(now), HasLen, 0)
+	due := sc.Due(now.Add(2 * time.Second))
+	c.Assert(due, HasLen, 2)
+	c.Check(string(due[0].Frame.Body), Equals, "1")
+	c.Check(due[0].Destination, Equals, "/queue/a")
+	c.Check(string(due[1].Frame.Body), Equals, "2")
+	c.Check(due[1].Destination, Equals, "/topic/b")
+	c.Check(sc.GetStatus(), HasLen, 1)
+
+	// due frames are stored until they are unscheduled
+	scheduled, err := qs.Scheduled()
+	c.Assert(err, IsNil)
+	c.Check(scheduled, HasLen, 3)
+	c.Assert(sc.Unschedule(due[0]), IsNil)
+	c.Assert(sc.Unschedule(due[1]), IsNil)
+	scheduled, err = qs.Scheduled()
+	c.Assert(err, IsNil)
+	c.Check(scheduled, HasLen, 1)
+
+	due = sc.Due(now.Add(time.Hour))
+	c.Assert(due, HasLen, 1)
+	c.Check(string(due[0].Frame.Body), Equals, "3")
+	_, ok = sc.Next()
+	c.Check(ok, Equals, false)
+}
+
+func (s *SchedulerSuite) TestRetry(c *C) {
+	qs := NewMemoryQueueStorage()
+	c.Assert(qs.Start(), IsNil)
+	sc := NewScheduler(qs)
+
+	now := time.Unix(1000, 0)
+	c.Assert(sc.Schedule(scheduledFrameAt("/queue/a", "1", now.Add(time.Second))), IsNil)
+	due := sc.Due(now.Add(time.Second))
+	c.Assert(due, HasLen, 1)
+	c.Check(sc.Count(), Equals, 0)
+	c.Check(sc.GetStatus(), HasLen, 0)
+
+	// a frame that cannot be delivered is tried again later
+	sc.Retry(due[0], now.Add(time.Minute))
+	c.Check(sc.Count(), Equals, 1)
+	c.Check(sc.GetStatus(), HasLen, 1)
+	next, ok := sc.Next()
+	c.Assert(ok, Equals, true)
+	c.Check(next.Equal(now.Add(time.Minute)), Equals, true)
+	c.Check(sc.Due(now.Add(time.Second)), HasLen, 0)
+
+	retried := sc.Due(now.Add(time.Minute))
+	c.Assert(retried, HasLen, 1)
+	c.Check(retried[0], Equals, due[0])
+	c.Assert(sc.Unschedule(retried[0]), IsNil)
+	scheduled, err := qs.Scheduled()
+	c.Assert(err, IsNil)
+	c.Check(scheduled, HasLen, 0)
+}
+
+func (s *SchedulerSuite) TestFileQueueStorage(c *C) {
+	s.testRestart(c, func() Storage {
+		return NewFileQueueStorage(s.dir, FileQueueOptions{})
+	})
+}
+
+func (s *SchedulerSuite) TestKVQueueStorage(c *C) {
+	path := filepath.Join(s.dir, "queues.kv")
+	s.testRestart(c, func() Storage {
+		return NewKVQueueStorage(path, kvstore.Options{})
+	})
+}
+
+// testRestart checks that persistent storage keeps the
+// schedule across restarts, apart from delivered frames.
+func (s *SchedulerSuite) testRestart(c *C, open func() Storage) {
+	now := time.Unix(1000, 0)
+
+	qs := open()
+	c.Assert(qs.Start(), IsNil)
+	sc := NewScheduler(qs)
+	c.Assert(sc.Load(), IsNil)
+	c.Assert(sc.Schedule(scheduledFrameAt("/queue/a", "1", now.Add(time.Second))), IsNil)
+	c.Assert(sc.Schedule(scheduledFrameAt("/queue/a", "2", now.Add(2*time.Second))), IsNil)
+	c.Assert(sc.Schedule(scheduledFrameAt("/queue/b", "3", now.Add(3*time.Second))), IsNil)
+	c.Assert(qs.Enqueue("/queue/a", frame.New(frame.MESSAGE)), IsNil)
+	due := sc.Due(now.Add(time.Second))
+	c.Assert(due, HasLen, 1)
+	c.Assert(sc.Unschedule(due[0]), IsNil)
+	c.Assert(qs.Stop(), IsNil)
+
+	qs = open()
+	c.Assert(qs.Start(), IsNil)
+	sc = NewScheduler(qs)
+	c.Assert(sc.Load(), IsNil)
+	c.Check(sc.Count(), Equals, 2)
+	c.Check(qs.Count("/queue/a"), Equals, 1)
+
+	due = sc.Due(now.Add(time.Hour))
+	c.Assert(due, HasLen, 2)
+	c.Check(string(due[0].Frame.Body), Equals, "2")
+	c.Check(due[0].Frame.Header.Get(frame.Destination), Equals, "/queue/a")
+	c.Check(string(due[1].Frame.Body), Equals, "3")
+	c.Assert(sc.Unschedule(due[0]), IsNil)
+	c.Assert(qs.Stop(), IsNil)
+
+	// a due frame that was not delivered is loaded again
+	qs = open()
+	c.Assert(qs.Start(), IsNil)
+	sc = NewScheduler(qs)
+	c.Assert(sc.Load(), IsNil)
+	due = sc.Due(now.Add(time.Hour))
+	c.Assert(due, HasLen, 1)
+	c.Check(string(due[0].Frame.Body), Equals, "3")
+	c.Assert(qs.Stop(), IsNil)
+}
@@ -9,28 +9,62 @@ import (
 // used, depending on preference. Queue storage
 // mechanisms could include in-memory, and various
 // persistent storage mechanisms (eg file system, DB, etc)
+//
+// Frames are kept in order of priority, as returned by the
+// Priority function, and in order of arrival within a priority.
 type Storage interface {
-	// Pushes a MESSAGE frame to the end of the queue. Sets
+	// Pushes a MESSAGE frame to the end of its priority. Sets
 	// the "message-id" header of the frame before adding to
 	// the queue.
 	Enqueue(queue string, frame *frame.Frame) error
 
-	// Pushes a MESSAGE frame to the head of the queue. Sets
+	// Pushes a MESSAGE frame to the head of its priority. Sets
 	// the "message-id" header of the frame if it is not
 	// already set.
 	Requeue(queue string, frame *frame.Frame) error
 
-	// Removes a frame from the head of the queue.
+	// Removes the first frame of the highest priority.
 	// Returns nil if no frame is available.
 	Dequeue(queue string) (*frame.Frame, error)
 
+	// Calls fn for each frame in the queue, in the order in which
+	// the frames are dequeued, until fn returns false. The frames are
+	// left in the queue, and each is passed with an id by which Remove
+	// removes it. The storage must not be used by fn.
+	Each(queue string, fn func(id string, f *frame.Frame) bool) error
+
+	// Removes a frame found by Each. Does nothing if the
+	// frame is no longer in the queue.
+	Remove(queue string, id string) error
+
 	// Called at server startup. Allows the queue storage
-	// to perform any initialization.
-	Start()
+	// to perform any initialization, such as reading stored
+	// messages. The server does not start if an error is returned.
+	Start() error
 
 	// Called prior to server shutdown. Allows the queue storage
 	// to perform any cleanup.
-	Stop()
+	Stop() error
 
 	Count(queue string) int
+
+	// Returns the number of frames in the queue
+	// for each priority, indexed by priority.
+	CountByPriority(queue string) []int
+
+	// Stores a frame that is delivered at a later time.
+	// Returns an id by which the frame is unscheduled.
+	Schedule(frame *frame.Frame) (uint64, error)
+
+	// Removes a frame stored by Schedule, when it is delivered.
+	Unschedule(id uint64) error
+
+	// Returns the frames stored by Schedule, by id. Persistent
+	// storage keeps scheduled frames across restarts.
+	Scheduled() (map[uint64]*frame.Frame, error)
 }
+
+// scheduledQueue is the queue in which persistent storage keeps
+// scheduled frames. It is never a destination, because header
+// values cannot contain NUL.
+const scheduledQueue = "\x00scheduled"
@@ -1,32 +1,109 @@
 package server
 
 import (
+	"errors"
+	"path/filepath"
+	"time"
+
 	"github.com/go-stomp/stomp/frame"
+	"github.com/go-stomp/stomp/server/kvstore"
+	"github.com/go-stomp/stomp/server/queue"
+)
+
+// Values of ServerConfig.QueueStorage.
+const (
+	MemoryQueueStorage = "memory"
+	FileQueueStorage   = "file"
+	KVQueueStorage     = "kv"
 )
 
+// Name of the file of the "kv" queue storage in ServerConfig.QueueDir.
+const KVQueueFile = "queues.kv"
+
 // QueueStorage is an interface that abstracts the queue storage mechanism.
 // The intent is that different queue storage implementations can be
 // used, depending on preference. Queue storage mechanisms could include
 // in-memory, and various persistent storage mechanisms (eg file system, DB, etc).
+// Frames are kept in order of priority, from the priority header, and in
+// order of arrival within a priority.
 type QueueStorage interface {
-	// Enqueue adds a MESSAGE frame to the end of the queue.
+	// Enqueue adds a MESSAGE frame to the end of its priority.
 	Enqueue(queue string, frame *frame.Frame) error
 
-	// Requeue adds a MESSAGE frame to the head of the queue.
+	// Requeue adds a MESSAGE frame to the head of its priority.
 	// This will happen if a client fails to acknowledge receipt.
 	Requeue(queue string, frame *frame.Frame) error
 
-	// Dequeue removes a frame from the head of the queue.
+	// Dequeue removes the first frame of the highest priority.
 	// Returns nil if no frame is available.
 	Dequeue(queue string) (*frame.Frame, error)
 
+	// Each calls fn for each frame in the queue, in the order in which
+	// the frames are dequeued, until fn returns false. The frames are
+	// left in the queue, and each is passed with an id for Remove.
+	// The storage must not be used by fn.
+	Each(queue string, fn func(id string, f *frame.Frame) bool) error
+
+	// Remove removes a frame found by Each, such as an expired frame.
+	// Does nothing if the frame is no longer in the queue.
+	Remove(queue string, id string) error
+
 	// Start is called at server startup. Allows the queue storage
-	// to perform any initialization.
-	Start()
+	// to perform any initialization, such as reading stored messages.
+	// The server does not start if an error is returned.
+	Start() error
 
 	// Stop is called prior to server shutdown. Allows the queue storage
 	// to perform any cleanup, such as flushing to disk.
-	Stop()
+	Stop() error
 
 	Count(queue string) int
+
+	// CountByPriority returns the number of frames in the
+	// queue for each priority, indexed by priority.
+	CountByPriority(queue string) []int
+
+	// Schedule stores a frame that is delivered at a later time, from
+	// its deliver-at header, and returns an id for Unschedule.
+	Schedule(frame *frame.Frame) (uint64, error)
+
+	// Unschedule removes a frame stored by Schedule, when it is delivered.
+	Unschedule(id uint64) error
+
+	// Scheduled returns the frames stored by Schedule, by id. It is called
+	// after Start, so that persistent storage keeps the schedule across
+	// restarts.
+	Scheduled() (map[uint64]*frame.Frame, error)
+}
+
+// queueStorage returns the queue storage of the server, which is
+// Server.QueueStorage if set, or else the one selected by ServerConfig.
+func (s *Server) queueStorage() (QueueStorage, error) {
+	if s.QueueStorage != nil {
+		return s.QueueStorage, nil
+	}
+
+	switch s.Config.QueueStorage {
+	case "", MemoryQueueStorage:
+		return queue.NewMemoryQueueStorage(), nil
+	case FileQueueStorage, KVQueueStorage:
+		if s.Config.QueueDir == "" {
+			return nil, errors.New(s.Config.QueueStorage + " queue storage requires QueueDir")
+		}
+		policy, err := queue.ParseSyncPolicy(s.Config.QueueSync)
+		if err != nil {
+			return nil, err
+		}
+		if s.Config.QueueStorage == KVQueueStorage {
+			// the kv storage syncs every write, unless told never to
+			return queue.NewKVQueueStorage(filepath.Join(s.Config.QueueDir, KVQueueFile),
+				kvstore.Options{NoSync: policy == queue.SyncNever}), nil
+		}
+		return queue.NewFileQueueStorage(s.Config.QueueDir, queue.FileQueueOptions{
+			Sync:         policy,
+			SyncInterval: time.Duration(s.Config.QueueSyncInterval) * time.Millisecond,
+			SegmentSize:  s.Config.QueueSegmentSize,
+		}), nil
+	}
+	return nil, errors.New("unknown queue storage: " + s.Config.QueueStorage)
 }
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/go-stomp/stomp/server/queue"
+	"github.com/go-stomp/stomp/server/topic"
+)
+
+// Kinds of destination, in Route.Kind.
+const (
+	QueueRoute     = "queue"      // delivered to one subscriber, and stored until then
+	TopicRoute     = "topic"      // delivered to every current subscriber
+	TempQueueRoute = "temp-queue" // a queue deleted with its messages when its last subscriber leaves
+	VirtualRoute   = "virtual"    // forwarded to the destinations in Route.Targets
+)
+
+// Destination of the status messages of the server, which
+// is always a topic, whatever the routes of the server.
+const StatusDestination = "/topic/go-stomp.status"
+
+// Route gives the kind of the destinations that match Destination, which
+// is matched exactly, or as a prefix if it ends with "*", in which case the
+// longest matching prefix applies.
+//
+// The queues that the server fills itself, which are ExpiryDestination,
+// the dead-letter queues and the queues of durable subscriptions, are
+// always routed as queues. Routes of another kind for the same Destination
+// are rejected.
+type Route struct {
+	Destination string
+	Kind        string   //QueueRoute, TopicRoute, TempQueueRoute or VirtualRoute
+	Targets     []string //for VirtualRoute, the destinations that receive its messages
+}
+
+// The routes of a server without ServerConfig.Routes: destinations that
+// start with QueuePrefix are queues, and all other destinations are topics.
+var defaultRoutes = []Route{
+	{Destination: QueuePrefix + "*", Kind: QueueRoute},
+	{Destination: "*", Kind: TopicRoute},
+}
+
+// router finds the routes of destinations. It is not modified once
+// created, and can be used by any goroutine.
+type router struct {
+	routes map[string]*Route // by Route.Destination
+}
+
+func newRouter(config *ServerConfig) (*router, error) {
+	routes := config.Routes
+	if len(routes) == 0 {
+		routes = defaultRoutes
+	}
+	r := &router{routes: make(map[string]*Route)}
+	for i := range routes {
+		route := &routes[i]
+		switch route.Kind {
+		case QueueRoute, TopicRoute, TempQueueRoute:
+		case VirtualRoute:
+			if len(route.Targets) == 0 {
+				return nil, errors.New("virtual destination without targets: " + route.Destination)
+			}
+		default:
+			return nil, errors.New("unknown kind of destination: " + route.Kind)
+		}
+		r.routes[route.Destination] = route
+	}
+
+	// the queues filled by the server itself can be read by clients
+	for _, destination := range serverQueues(config) {
+		if route, ok := r.routes[destination]; ok {
+			if route.Kind != QueueRoute {
+				return nil, errors.New("server queue routed as " + route.Kind + ": " + destination)
+			}
+			continue
+		}
+		r.routes[destination] = &Route{Destination: destination, Kind: QueueRoute}
+	}
+
+	// virtual destinations forward to real destinations only,
+	// and not to the topics that wildcards would name
+	for _, route := range r.routes {
+		for _, target := range route.Targets {
+			switch kind := r.kind(target); {
+			case kind == QueueRoute, kind == TempQueueRoute:
+			case kind == TopicRoute && !topic.IsWildcard(target):
+			default:
+				return nil, errors.New("invalid target of virtual destination " +
+					route.Destination + ": " + target)
+			}
+		}
+	}
+	return r, nil
+}
+
+// serverQueues returns the destinations, or prefixes followed by "*", of
+// the queues to which the server moves or keeps messages.
+func serverQueues(config *ServerConfig) []string {
+	destinations := []string{queue.DeadLetterPrefix + "*", topic.DurablePrefix + "*"}
+	if config.ExpiryDestination != "" {
+		destinations = append(destinations, config.ExpiryDestination)
+	}
+	for _, p := range config.Policies {
+		if p.DeadLetterQueue != "" {
+			destinations = append(destinations, p.DeadLetterQueue)
+		}
+	}
+	return destinations
+}
+
+// route returns the route of a destination, or nil if it matches none.
+func (r *router) route(destination string) *Route {
+	if route, ok := r.routes[destination]; ok {
+		return route
+	}
+	var match *Route
+	length := -1
+	for pattern, route := range r.routes {
+		prefix := strings.TrimSuffix(pattern, "*")
+		if prefix != pattern && len(prefix) > length && strings.HasPrefix(destination, prefix) {
+			match, length = route, len(prefix)
+		}
+	}
+	return match
+}
+
+// kind returns the kind of a destination, or an empty
+// string if the destination matches no route.
+func (r *router) kind(destination string) string {
+	if destination == StatusDestination {
+		return TopicRoute
+	}
+	if route := r.route(destination); route != nil {
+		return route.Kind
+	}
+	return ""
+}
+
+// check returns an error if a destination matches no route, is
+// subscribed to but only forwards its messages elsewhere, or is sent
+// to but only names other topics with wildcards.
+func (r *router) check(destination string, subscribe bool) error {
+	if destination == topic.DurableRegistry {
+		return errors.New("reserved destination: " + destination)
+	}
+	switch r.kind(destination) {
+	case "":
+		return errors.New("no route to destination: " + destination)
+	case VirtualRoute:
+		if subscribe {
+			return errors.New("cannot subscribe to virtual destination: " + destination)
+		}
+	case TopicRoute:
+		if !subscribe && topic.IsWildcard(destination) {
+			return errors.New("cannot send to wildcard destination: " + destination)
+		}
+	}
+	return nil
+}
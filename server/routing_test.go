@@ -0,0 +1,98 @@
+package server
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type RoutingSuite struct{}
+
+var _ = Suite(&RoutingSuite{})
+
+func (s *RoutingSuite) TestDefaultRoutes(c *C) {
+	r, err := newRouter(&ServerConfig{})
+	c.Assert(err, IsNil)
+	c.Check(r.kind("/queue/orders"), Equals, QueueRoute)
+	c.Check(r.kind("/topic/orders"), Equals, TopicRoute)
+	c.Check(r.kind("orders"), Equals, TopicRoute)
+	c.Check(r.check("/anything", true), IsNil)
+	c.Check(r.check("/topic/orders.*", true), IsNil)
+	c.Check(r.check("/topic/orders.*", false), ErrorMatches, "cannot send to wildcard destination: /topic/orders.\\*")
+	c.Check(r.check("/queue/orders.*", false), IsNil)
+}
+
+func (s *RoutingSuite) TestRoutes(c *C) {
+	r, err := newRouter(&ServerConfig{Routes: []Route{
+		{Destination: "/amq/queue/*", Kind: QueueRoute},
+		{Destination: "jms.queue.*", Kind: QueueRoute},
+		{Destination: "/exchange/*", Kind: TopicRoute},
+		{Destination: "/exchange/amq.direct/*", Kind: QueueRoute},
+		{Destination: "/temp-queue/*", Kind: TempQueueRoute},
+		{Destination: "/virtual/orders", Kind: VirtualRoute,
+			Targets: []string{"/amq/queue/orders", "/exchange/orders"}},
+	}})
+	c.Assert(err, IsNil)
+
+	c.Check(r.kind("/amq/queue/orders"), Equals, QueueRoute)
+	c.Check(r.kind("jms.queue.orders"), Equals, QueueRoute)
+	c.Check(r.kind("/exchange/orders"), Equals, TopicRoute)
+	c.Check(r.kind("/exchange/amq.direct/orders"), Equals, QueueRoute)
+	c.Check(r.kind("/temp-queue/reply-1"), Equals, TempQueueRoute)
+	c.Check(r.kind("/virtual/orders"), Equals, VirtualRoute)
+	c.Check(r.kind("/queue/orders"), Equals, "")
+	c.Check(r.kind(StatusDestination), Equals, TopicRoute)
+
+	c.Check(r.check("/amq/queue/orders", true), IsNil)
+	c.Check(r.check("/virtual/orders", false), IsNil)
+	c.Check(r.check("/virtual/orders", true), ErrorMatches, "cannot subscribe to virtual destination: /virtual/orders")
+	c.Check(r.check("/queue/orders", false), ErrorMatches, "no route to destination: /queue/orders")
+}
+
+func (s *RoutingSuite) TestInvalidRoutes(c *C) {
+	_, err := newRouter(&ServerConfig{Routes: []Route{{Destination: "*", Kind: "mailbox"}}})
+	c.Check(err, ErrorMatches, "unknown kind of destination: mailbox")
+
+	_, err = newRouter(&ServerConfig{Routes: []Route{{Destination: "/virtual/x", Kind: VirtualRoute}}})
+	c.Check(err, ErrorMatches, "virtual destination without targets: /virtual/x")
+
+	_, err = newRouter(&ServerConfig{Routes: []Route{
+		{Destination: "/queue/*", Kind: QueueRoute},
+		{Destination: "/virtual/x", Kind: VirtualRoute, Targets: []string{"/queue/a", "/topic/b"}},
+	}})
+	c.Check(err, ErrorMatches, "invalid target of virtual destination /virtual/x: /topic/b")
+
+	_, err = newRouter(&ServerConfig{Routes: []Route{
+		{Destination: "/virtual/*", Kind: VirtualRoute, Targets: []string{"/virtual/y"}},
+	}})
+	c.Check(err, ErrorMatches, "invalid target of virtual destination /virtual/\\*: /virtual/y")
+
+	_, err = newRouter(&ServerConfig{Routes: []Route{
+		{Destination: "/topic/*", Kind: TopicRoute},
+		{Destination: "/virtual/x", Kind: VirtualRoute, Targets: []string{"/topic/a.>"}},
+	}})
+	c.Check(err, ErrorMatches, "invalid target of virtual destination /virtual/x: /topic/a.>")
+}
+
+func (s *RoutingSuite) TestServerQueues(c *C) {
+	r, err := newRouter(&ServerConfig{
+		Routes: []Route{
+			{Destination: "jms.queue.*", Kind: QueueRoute},
+			{Destination: "*", Kind: TopicRoute},
+		},
+		ExpiryDestination: "jms.expired",
+		Policies:          []DestinationPolicy{{Destination: "jms.queue.orders", DeadLetterQueue: "dead.orders"}},
+	})
+	c.Assert(err, IsNil)
+	c.Check(r.kind("jms.expired"), Equals, QueueRoute)
+	c.Check(r.kind("dead.orders"), Equals, QueueRoute)
+	c.Check(r.kind("/queue/DLQ.jms.queue.orders"), Equals, QueueRoute)
+	c.Check(r.kind("/durable/client-1/orders"), Equals, QueueRoute)
+	c.Check(r.kind("jms.topic.orders"), Equals, TopicRoute)
+	c.Check(r.check("/durable/client-1/orders", true), IsNil)
+	c.Check(r.check("/durable/", true), ErrorMatches, "reserved destination: /durable/")
+
+	_, err = newRouter(&ServerConfig{
+		Routes:            []Route{{Destination: "*", Kind: TopicRoute}, {Destination: "expired", Kind: TopicRoute}},
+		ExpiryDestination: "expired",
+	})
+	c.Check(err, ErrorMatches, "server queue routed as topic: expired")
+}
@@ -0,0 +1,246 @@
+package selector
+
+import (
+	"regexp"
+	"strconv"
+
+	"github.com/go-stomp/stomp/frame"
+)
+
+// An expr is a node of a compiled selector. Evaluation returns a
+// string, a float64, a bool, or nil if the value is unknown.
+type expr interface {
+	eval(h *frame.Header) interface{}
+}
+
+type literal struct {
+	value interface{}
+}
+
+func (e literal) eval(h *frame.Header) interface{} {
+	return e.value
+}
+
+// header is the value of a header, or unknown if the header is missing.
+type header string
+
+func (e header) eval(h *frame.Header) interface{} {
+	if value, ok := h.Contains(string(e)); ok {
+		return value
+	}
+	return nil
+}
+
+type orExpr struct {
+	left, right expr
+}
+
+func (e *orExpr) eval(h *frame.Header) interface{} {
+	left := logical(e.left.eval(h))
+	if left == true {
+		return true
+	}
+	right := logical(e.right.eval(h))
+	if right == true {
+		return true
+	}
+	if left == nil || right == nil {
+		return nil
+	}
+	return false
+}
+
+type andExpr struct {
+	left, right expr
+}
+
+func (e *andExpr) eval(h *frame.Header) interface{} {
+	left := logical(e.left.eval(h))
+	if left == false {
+		return false
+	}
+	right := logical(e.right.eval(h))
+	if right == false {
+		return false
+	}
+	if left == nil || right == nil {
+		return nil
+	}
+	return true
+}
+
+type notExpr struct {
+	e expr
+}
+
+func (e *notExpr) eval(h *frame.Header) interface{} {
+	switch v := logical(e.e.eval(h)).(type) {
+	case bool:
+		return !v
+	}
+	return nil
+}
+
+type compareExpr struct {
+	op          string
+	left, right expr
+}
+
+func (e *compareExpr) eval(h *frame.Header) interface{} {
+	return compare(e.op, e.left.eval(h), e.right.eval(h))
+}
+
+type arithExpr struct {
+	op          string
+	left, right expr
+}
+
+func (e *arithExpr) eval(h *frame.Header) interface{} {
+	left, ok := number(e.left.eval(h))
+	if !ok {
+		return nil
+	}
+	right, ok := number(e.right.eval(h))
+	if !ok {
+		return nil
+	}
+	switch e.op {
+	case "+":
+		return left + right
+	case "-":
+		return left - right
+	case "*":
+		return left * right
+	case "/":
+		if right == 0 {
+			return nil
+		}
+		return left / right
+	}
+	return nil
+}
+
+type inExpr struct {
+	value expr
+	list  []interface{} // strings and numbers
+}
+
+func (e *inExpr) eval(h *frame.Header) interface{} {
+	value := e.value.eval(h)
+	if value == nil {
+		return nil
+	}
+	for _, item := range e.list {
+		if compare("=", value, item) == true {
+			return true
+		}
+	}
+	return false
+}
+
+type likeExpr struct {
+	value   expr
+	pattern *regexp.Regexp
+}
+
+func (e *likeExpr) eval(h *frame.Header) interface{} {
+	value, ok := e.value.eval(h).(string)
+	if !ok {
+		return nil
+	}
+	return e.pattern.MatchString(value)
+}
+
+type isNullExpr struct {
+	value expr
+	not   bool
+}
+
+func (e *isNullExpr) eval(h *frame.Header) interface{} {
+	return (e.value.eval(h) == nil) != e.not
+}
+
+// compare compares two values. Numbers and booleans are compared with
+// other values converted to the same type, and strings are only compared
+// for equality, unless both can be converted to numbers.
+func compare(op string, left, right interface{}) interface{} {
+	if left == nil || right == nil {
+		return nil
+	}
+
+	_, leftBool := left.(bool)
+	_, rightBool := right.(bool)
+	if leftBool || rightBool {
+		l, r := logical(left), logical(right)
+		if l == nil || r == nil {
+			return nil
+		}
+		switch op {
+		case "=":
+			return l == r
+		case "<>":
+			return l != r
+		}
+		return nil
+	}
+
+	ls, leftString := left.(string)
+	rs, rightString := right.(string)
+	if leftString && rightString {
+		switch op {
+		case "=":
+			return ls == rs
+		case "<>":
+			return ls != rs
+		}
+	}
+
+	l, ok := number(left)
+	if !ok {
+		return nil
+	}
+	r, ok := number(right)
+	if !ok {
+		return nil
+	}
+	switch op {
+	case "=":
+		return l == r
+	case "<>":
+		return l != r
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	case ">=":
+		return l >= r
+	}
+	return nil
+}
+
+// logical converts a value to a bool, or nil if it is not a boolean.
+func logical(v interface{}) interface{} {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return nil
+}
+
+// number converts a value to a float64.
+func number(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		n, err := strconv.ParseFloat(v, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,153 @@
+package selector
+
+import (
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenKeyword
+	tokenString
+	tokenNumber
+	tokenOperator
+)
+
+type token struct {
+	kind   tokenKind
+	text   string  // identifier, keyword in upper case, string, or operator
+	number float64 // value of a number
+	offset int
+}
+
+var keywords = map[string]bool{
+	"AND":     true,
+	"OR":      true,
+	"NOT":     true,
+	"BETWEEN": true,
+	"IN":      true,
+	"LIKE":    true,
+	"ESCAPE":  true,
+	"IS":      true,
+	"NULL":    true,
+	"TRUE":    true,
+	"FALSE":   true,
+}
+
+// lexer splits the text of a selector into tokens.
+type lexer struct {
+	text   string
+	offset int
+}
+
+func (l *lexer) next() (token, error) {
+	for l.offset < len(l.text) && isSpace(l.text[l.offset]) {
+		l.offset++
+	}
+	start := l.offset
+	if start == len(l.text) {
+		return token{kind: tokenEOF, offset: start}, nil
+	}
+
+	c := l.text[start]
+	switch {
+	case isIdentStart(c):
+		for l.offset < len(l.text) && isIdentPart(l.text[l.offset]) {
+			l.offset++
+		}
+		text := l.text[start:l.offset]
+		if upper := strings.ToUpper(text); keywords[upper] {
+			return token{kind: tokenKeyword, text: upper, offset: start}, nil
+		}
+		return token{kind: tokenIdent, text: text, offset: start}, nil
+
+	case c == '"':
+		text, err := l.quoted('"')
+		return token{kind: tokenIdent, text: text, offset: start}, err
+
+	case c == '\'':
+		text, err := l.quoted('\'')
+		return token{kind: tokenString, text: text, offset: start}, err
+
+	case isDigit(c) || c == '.' && start+1 < len(l.text) && isDigit(l.text[start+1]):
+		return l.number()
+	}
+
+	for _, op := range []string{"<>", "<=", ">=", "=", "<", ">", "+", "-", "*", "/", "(", ")", ","} {
+		if strings.HasPrefix(l.text[start:], op) {
+			l.offset += len(op)
+			return token{kind: tokenOperator, text: op, offset: start}, nil
+		}
+	}
+	return token{}, &Error{Offset: start, Msg: "unexpected character " + strconv.QuoteRune(rune(c))}
+}
+
+// quoted reads a string or identifier in quotes, in which
+// the quote character is written twice.
+func (l *lexer) quoted(quote byte) (string, error) {
+	start := l.offset
+	l.offset++
+	var text []byte
+	for l.offset < len(l.text) {
+		c := l.text[l.offset]
+		l.offset++
+		if c != quote {
+			text = append(text, c)
+		} else if l.offset < len(l.text) && l.text[l.offset] == quote {
+			text = append(text, c)
+			l.offset++
+		} else {
+			return string(text), nil
+		}
+	}
+	return "", &Error{Offset: start, Msg: "unterminated quote"}
+}
+
+func (l *lexer) number() (token, error) {
+	start := l.offset
+	for l.offset < len(l.text) && isDigit(l.text[l.offset]) {
+		l.offset++
+	}
+	if l.offset < len(l.text) && l.text[l.offset] == '.' {
+		l.offset++
+		for l.offset < len(l.text) && isDigit(l.text[l.offset]) {
+			l.offset++
+		}
+	}
+	if l.offset < len(l.text) && (l.text[l.offset] == 'e' || l.text[l.offset] == 'E') {
+		l.offset++
+		if l.offset < len(l.text) && (l.text[l.offset] == '+' || l.text[l.offset] == '-') {
+			l.offset++
+		}
+		for l.offset < len(l.text) && isDigit(l.text[l.offset]) {
+			l.offset++
+		}
+	}
+	if l.offset < len(l.text) && isIdentPart(l.text[l.offset]) {
+		return token{}, &Error{Offset: start, Msg: "invalid number"}
+	}
+	n, err := strconv.ParseFloat(l.text[start:l.offset], 64)
+	if err != nil {
+		return token{}, &Error{Offset: start, Msg: "invalid number"}
+	}
+	return token{kind: tokenNumber, text: l.text[start:l.offset], number: n, offset: start}, nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_' || c == '$'
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || isDigit(c) || c == '.'
+}
@@ -0,0 +1,355 @@
+package selector
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// parser is a recursive descent parser of selectors, with one
+// token of lookahead. In order of increasing precedence, the
+// operators are OR, AND, NOT, comparisons and predicates,
+// + and -, * and /, and unary + and -.
+type parser struct {
+	lex lexer
+	tok token
+}
+
+func (p *parser) parse() (expr, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == tokenEOF {
+		return nil, p.errorf("empty selector")
+	}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokenEOF {
+		return nil, p.unexpected()
+	}
+	return e, nil
+}
+
+func (p *parser) advance() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+// is reports whether the current token is the given keyword or operator.
+func (p *parser) is(text string) bool {
+	return (p.tok.kind == tokenKeyword || p.tok.kind == tokenOperator) && p.tok.text == text
+}
+
+// accept advances past the given keyword or operator, and
+// reports whether the current token was that token.
+func (p *parser) accept(text string) (bool, error) {
+	if !p.is(text) {
+		return false, nil
+	}
+	return true, p.advance()
+}
+
+func (p *parser) expect(text string) error {
+	if !p.is(text) {
+		return p.errorf("expected " + text)
+	}
+	return p.advance()
+}
+
+func (p *parser) errorf(msg string) error {
+	return &Error{Offset: p.tok.offset, Msg: msg}
+}
+
+func (p *parser) unexpected() error {
+	if p.tok.kind == tokenEOF {
+		return p.errorf("unexpected end of selector")
+	}
+	return p.errorf("unexpected " + p.lex.text[p.tok.offset:p.lex.offset])
+}
+
+func (p *parser) or() (expr, error) {
+	left, err := p.and()
+	for err == nil && p.is("OR") {
+		var right expr
+		if err = p.advance(); err == nil {
+			if right, err = p.and(); err == nil {
+				left = &orExpr{left, right}
+			}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) and() (expr, error) {
+	left, err := p.not()
+	for err == nil && p.is("AND") {
+		var right expr
+		if err = p.advance(); err == nil {
+			if right, err = p.not(); err == nil {
+				left = &andExpr{left, right}
+			}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) not() (expr, error) {
+	if ok, err := p.accept("NOT"); err != nil {
+		return nil, err
+	} else if ok {
+		e, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{e}, nil
+	}
+	return p.predicate()
+}
+
+// predicate parses a comparison, or a BETWEEN, IN,
+// LIKE or IS NULL predicate, or else an operand.
+func (p *parser) predicate() (expr, error) {
+	left, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, op := range []string{"=", "<>", "<=", ">=", "<", ">"} {
+		if p.is(op) {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			right, err := p.sum()
+			if err != nil {
+				return nil, err
+			}
+			return &compareExpr{op, left, right}, nil
+		}
+	}
+
+	if p.is("IS") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		not, err := p.accept("NOT")
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("NULL"); err != nil {
+			return nil, err
+		}
+		return &isNullExpr{left, not}, nil
+	}
+
+	not, err := p.accept("NOT")
+	if err != nil {
+		return nil, err
+	}
+	var e expr
+	switch {
+	case p.is("BETWEEN"):
+		e, err = p.between(left)
+	case p.is("IN"):
+		e, err = p.in(left)
+	case p.is("LIKE"):
+		e, err = p.like(left)
+	case not:
+		return nil, p.errorf("expected BETWEEN, IN or LIKE")
+	default:
+		return left, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if not {
+		e = &notExpr{e}
+	}
+	return e, nil
+}
+
+func (p *parser) between(value expr) (expr, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	low, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("AND"); err != nil {
+		return nil, err
+	}
+	high, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	return &andExpr{&compareExpr{">=", value, low}, &compareExpr{"<=", value, high}}, nil
+}
+
+func (p *parser) in(value expr) (expr, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	e := &inExpr{value: value}
+	for {
+		switch p.tok.kind {
+		case tokenString:
+			e.list = append(e.list, p.tok.text)
+		case tokenNumber:
+			e.list = append(e.list, p.tok.number)
+		default:
+			return nil, p.errorf("expected literal in IN list")
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if ok, err := p.accept(","); err != nil {
+			return nil, err
+		} else if !ok {
+			break
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (p *parser) like(value expr) (expr, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokenString {
+		return nil, p.errorf("expected pattern string")
+	}
+	pattern, offset := p.tok.text, p.tok.offset
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	escape := ""
+	if p.is("ESCAPE") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokenString || len(p.tok.text) != 1 {
+			return nil, p.errorf("expected escape character")
+		}
+		escape = p.tok.text
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	re, err := likePattern(pattern, escape)
+	if err != nil {
+		return nil, &Error{Offset: offset, Msg: "invalid pattern"}
+	}
+	return &likeExpr{value, re}, nil
+}
+
+// likePattern converts the pattern of a LIKE predicate, in which % matches
+// any sequence of characters and _ matches any character, to a regexp.
+// Fails if the pattern is not valid UTF-8.
+func likePattern(pattern, escape string) (*regexp.Regexp, error) {
+	var re bytes.Buffer
+	re.WriteString("(?s)^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case escape != "" && c == escape[0] && i+1 < len(pattern):
+			i++
+			re.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case c == '%':
+			re.WriteString(".*")
+		case c == '_':
+			re.WriteString(".")
+		default:
+			re.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	re.WriteString("$")
+	return regexp.Compile(re.String())
+}
+
+func (p *parser) sum() (expr, error) {
+	left, err := p.product()
+	for err == nil && (p.is("+") || p.is("-")) {
+		op := p.tok.text
+		var right expr
+		if err = p.advance(); err == nil {
+			if right, err = p.product(); err == nil {
+				left = &arithExpr{op, left, right}
+			}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) product() (expr, error) {
+	left, err := p.unary()
+	for err == nil && (p.is("*") || p.is("/")) {
+		op := p.tok.text
+		var right expr
+		if err = p.advance(); err == nil {
+			if right, err = p.unary(); err == nil {
+				left = &arithExpr{op, left, right}
+			}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) unary() (expr, error) {
+	if p.is("+") || p.is("-") {
+		op := p.tok.text
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		e, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if op == "-" {
+			e = &arithExpr{"-", literal{0.0}, e}
+		}
+		return e, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (expr, error) {
+	var e expr
+	switch {
+	case p.tok.kind == tokenIdent:
+		e = header(p.tok.text)
+	case p.tok.kind == tokenString:
+		e = literal{p.tok.text}
+	case p.tok.kind == tokenNumber:
+		e = literal{p.tok.number}
+	case p.is("TRUE"):
+		e = literal{true}
+	case p.is("FALSE"):
+		e = literal{false}
+	case p.is("NULL"):
+		e = literal{nil}
+	case p.is("("):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(")")
+	default:
+		return nil, p.unexpected()
+	}
+	return e, p.advance()
+}
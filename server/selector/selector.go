@@ -0,0 +1,62 @@
+/*
+Package selector implements message selectors, which are conditions on
+the headers of a message in a subset of the SQL-92 conditional expression
+syntax, as used by JMS:
+
+	region = 'eu' AND priority > 5
+
+Identifiers are header names. Header names that are not valid identifiers,
+such as content-type, can be written in double quotes. Selectors support
+the comparison operators =, <>, <, <=, > and >=, the arithmetic operators
++, -, * and /, AND, OR and NOT, and the BETWEEN, IN, LIKE and IS NULL
+predicates. Keywords are not case sensitive.
+
+Header values are strings, and are converted to numbers or booleans when
+compared with numeric or boolean values. A missing header, or a value that
+cannot be converted, makes a condition unknown, as NULL does in SQL, and a
+message is selected only if the whole selector is true.
+*/
+package selector
+
+import (
+	"fmt"
+
+	"github.com/go-stomp/stomp/frame"
+)
+
+// A Selector is a compiled message selector.
+type Selector struct {
+	text string
+	expr expr
+}
+
+// An Error reports a syntax error in a selector.
+type Error struct {
+	Offset int // of the error in the selector text
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("selector: %s at offset %d", e.Msg, e.Offset)
+}
+
+// Parse compiles a selector. The error, if any, is an *Error.
+func Parse(text string) (*Selector, error) {
+	p := &parser{lex: lexer{text: text}}
+	expr, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	return &Selector{text: text, expr: expr}, nil
+}
+
+// String returns the text of the selector.
+func (s *Selector) String() string {
+	return s.text
+}
+
+// Matches reports whether the selector is true for
+// the headers of a frame.
+func (s *Selector) Matches(f *frame.Frame) bool {
+	return logical(s.expr.eval(f.Header)) == true
+}
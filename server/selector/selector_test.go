@@ -0,0 +1,119 @@
+package selector
+
+import (
+	"testing"
+
+	"github.com/go-stomp/stomp/frame"
+	. "gopkg.in/check.v1"
+)
+
+// Runs all gocheck tests in this package.
+// See other *_test.go files for gocheck tests.
+func TestSelector(t *testing.T) {
+	TestingT(t)
+}
+
+type SelectorSuite struct{}
+
+var _ = Suite(&SelectorSuite{})
+
+func (s *SelectorSuite) TestMatches(c *C) {
+	f := frame.New(frame.MESSAGE,
+		"region", "eu",
+		"priority", "7",
+		"urgent", "true",
+		"content-type", "text/plain",
+		"name", "it's 100%")
+
+	matches := []string{
+		"region = 'eu' AND priority > 5",
+		"region = 'us' OR priority >= 7",
+		"REGION = 'EU' or region = 'eu'",
+		"NOT region = 'us'",
+		"region <> 'us'",
+		"priority BETWEEN 5 AND 9",
+		"priority NOT BETWEEN 8 AND 9",
+		"priority * 2 - 4 = 10",
+		"-priority < 0",
+		"priority / 2 = 3.5",
+		"region IN ('us', 'eu')",
+		"region NOT IN ('us', 'asia')",
+		"priority IN (1, 7)",
+		"region LIKE 'e_'",
+		"name LIKE 'it''s %'",
+		"name LIKE '%!%' ESCAPE '!'",
+		"region NOT LIKE 'u%'",
+		"missing IS NULL",
+		"region IS NOT NULL",
+		"urgent",
+		"urgent = TRUE",
+		"\"content-type\" = 'text/plain'",
+		"(region = 'us' OR region = 'eu') AND (priority < 9)",
+		"missing = 'x' OR region = 'eu'",
+		"NOT (missing = 'x' AND region = 'us')",
+		"1.5e1 = 15",
+	}
+	for _, text := range matches {
+		sel, err := Parse(text)
+		c.Assert(err, IsNil, Commentf("%s", text))
+		c.Check(sel.Matches(f), Equals, true, Commentf("%s", text))
+		c.Check(sel.String(), Equals, text)
+	}
+
+	unmatched := []string{
+		"region = 'us'",
+		"priority > 7",
+		"priority < 'abc'",
+		"region > 'a'",
+		"missing = 'x'",
+		"NOT missing = 'x'",
+		"missing <> 'x'",
+		"missing IN ('x')",
+		"NOT missing IN ('x')",
+		"missing LIKE '%'",
+		"missing IS NOT NULL",
+		"region",
+		"priority / 0 = 1",
+		"region LIKE 'e'",
+		"name LIKE '%!%x' ESCAPE '!'",
+		"urgent = FALSE",
+		"missing = NULL",
+	}
+	for _, text := range unmatched {
+		sel, err := Parse(text)
+		c.Assert(err, IsNil, Commentf("%s", text))
+		c.Check(sel.Matches(f), Equals, false, Commentf("%s", text))
+	}
+}
+
+func (s *SelectorSuite) TestErrors(c *C) {
+	errors := map[string]int{
+		"":                            0,
+		"region = 'eu":                9,
+		"region = ":                   9,
+		"region = 'eu' AND":           17,
+		"region == 'eu'":              8,
+		"region IN 'eu'":              10,
+		"region IN ('eu',)":           16,
+		"region IN (region)":          11,
+		"region LIKE region":          12,
+		"region LIKE 'a' ESCAPE '":    23,
+		"region LIKE 'a' ESCAPE 'ab'": 23,
+		"region LIKE '\xff%'":         12,
+		"region NOT = 'eu'":           11,
+		"priority BETWEEN 1 OR 2":     19,
+		"(region = 'eu'":              14,
+		"region = 'eu')":              13,
+		"region IS 'eu'":              10,
+		"region # 'eu'":               7,
+		"priority > 1x":               11,
+		"\"region = 'eu'":             0,
+	}
+	for text, offset := range errors {
+		_, err := Parse(text)
+		c.Assert(err, NotNil, Commentf("%s", text))
+		e, ok := err.(*Error)
+		c.Assert(ok, Equals, true)
+		c.Check(e.Offset, Equals, offset, Commentf("%s: %v", text, err))
+	}
+}
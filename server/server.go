@@ -4,9 +4,12 @@ Package server contains a simple STOMP server implementation.
 package server
 
 import (
+	"errors"
 	"net"
+	"sync"
 	"time"
 
+	"github.com/go-stomp/stomp/server/status"
 	"github.com/ventu-io/slf"
 )
 
@@ -16,8 +19,9 @@ import (
 // transmitted to all subscribers that are currently subscribed to the
 // topic.
 //
-// Destinations that start with this prefix are considered to be queues.
-// Destinations that do not start with this prefix are considered to be topics.
+// Unless ServerConfig.Routes is set, destinations that start with this
+// prefix are considered to be queues, and destinations that do not start
+// with this prefix are considered to be topics.
 const QueuePrefix = "/queue"
 const pwdCurr string = "github.com/go-stomp/stomp/server"
 
@@ -31,10 +35,20 @@ const (
 	// Default read timeout for heart-beat.
 	// Override by setting Server.HeartBeat.
 	DefaultHeartBeat = time.Minute
+
+	// Default interval for dropping the expired messages of idle queues.
+	// Override by setting ServerConfig.ExpirySweep.
+	DefaultExpirySweep = time.Minute
 )
 
 var Version string
 
+// Errors returned by the admin operations of a Server.
+var (
+	ErrNotServing      = errors.New("server is not serving")
+	ErrDurableNotFound = errors.New("durable subscription not found")
+)
+
 func init() {
 	log = slf.WithContext(pwdCurr)
 }
@@ -57,6 +71,32 @@ type ServerConfig struct {
 	MaxPendingReads  int    //read channel buffer size
 	MaxPendingWrites int    //read channel size
 	IsDebug          bool   //log debug data for connections
+
+	QueueStorage      string //queue storage: "memory" (default), "file" or "kv", which also keeps all queued messages in memory
+	QueueDir          string //directory of the "file" and "kv" queue storage
+	QueueSync         string //when the "file" queue storage syncs: "always", "interval" (default) or "never"
+	QueueSyncInterval int    //sync interval in milliseconds for "interval"
+	QueueSegmentSize  int64  //size in bytes at which the "file" queue storage starts a new segment
+
+	ExpiryDestination string //queue receiving expired messages, which are dropped if empty
+	ExpirySweep       int    //interval in seconds for dropping expired messages of idle queues, 60 if zero, disabled if negative
+
+	MaxDeliveries int                 //deliveries of a message before it is moved to a dead-letter queue, unlimited if zero
+	Policies      []DestinationPolicy //override the defaults for some queues
+
+	Routes []Route //kinds of destinations, which are rejected if they match none; QueuePrefix for queues and topics otherwise if empty
+
+	VirtualHosts       []VirtualHost //namespaces of destinations chosen by the host header of CONNECT; one for all clients if empty
+	DefaultVirtualHost string        //virtual host of clients whose host header names none, which are rejected if empty
+}
+
+// DestinationPolicy overrides the server defaults for the queues of a
+// destination. Destination is matched exactly, or as a prefix if it ends
+// with "*", in which case the longest matching prefix applies.
+type DestinationPolicy struct {
+	Destination     string
+	MaxDeliveries   int    //unlimited if zero
+	DeadLetterQueue string //queue.DeadLetterPrefix followed by the queue name if empty
 }
 
 // A Server defines parameters for running a STOMP server.
@@ -64,6 +104,8 @@ type Server struct {
 	Authenticator Authenticator // Authenticates login/passcodes. If nil no authentication is performed
 	QueueStorage  QueueStorage  // Implementation of queue storage. If nil, in-memory queues are used.
 	Config        *ServerConfig
+	mutex         sync.Mutex
+	proc          *requestProcessor // set while serving, for admin operations
 }
 
 func (s *Server) Id() string {
@@ -86,6 +128,18 @@ func (s *Server) StatusLogDuration() time.Duration {
 	return time.Duration(s.Config.StatusLog) * time.Second
 }
 
+// ExpirySweepDuration returns the interval for dropping the expired messages
+// of idle queues, or zero if they are not dropped until dequeued.
+func (s *Server) ExpirySweepDuration() time.Duration {
+	switch {
+	case s.Config.ExpirySweep < 0:
+		return 0
+	case s.Config.ExpirySweep == 0:
+		return DefaultExpirySweep
+	}
+	return time.Duration(s.Config.ExpirySweep) * time.Second
+}
+
 func (s *Server) HeartBeatDuration() time.Duration {
 	return time.Duration(s.Config.Heartbeat) * time.Second
 }
@@ -137,6 +191,121 @@ func (s *Server) ListenAndServe() error {
 // requests and then process each request.
 
 func (s *Server) serve(l net.Listener) error {
-	proc := newRequestProcessor(s)
-	return proc.Serve(l)
+	router, err := newRouter(s.Config)
+	if err != nil {
+		return err
+	}
+	vhosts, err := virtualHosts(s.Config)
+	if err != nil {
+		return err
+	}
+	qstore, err := s.queueStorage()
+	if err != nil {
+		return err
+	}
+	if err := qstore.Start(); err != nil {
+		return err
+	}
+	proc := newRequestProcessor(s, qstore, router, vhosts)
+	if err := proc.load(); err != nil {
+		qstore.Stop()
+		return err
+	}
+	s.mutex.Lock()
+	s.proc = proc
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		s.proc = nil
+		s.mutex.Unlock()
+		close(proc.done)
+	}()
+	err = proc.Serve(l)
+	if stopErr := qstore.Stop(); err == nil {
+		err = stopErr
+	}
+	return err
+}
+
+// Shutdown stops the server from accepting connections and processing
+// requests, and then stops its queue storage so that the messages it
+// holds are kept. It returns once ListenAndServe is about to return the
+// error of stopping the storage. Connected clients are not notified.
+func (s *Server) Shutdown() error {
+	s.mutex.Lock()
+	proc := s.proc
+	s.mutex.Unlock()
+	if proc == nil {
+		return ErrNotServing
+	}
+	proc.Stop()
+	<-proc.done
+	return nil
+}
+
+// admin runs fn on the goroutine that processes client requests,
+// and waits for it to return. Returns ErrNotServing if the server
+// stops serving before fn runs.
+func (s *Server) admin(fn func(proc *requestProcessor)) error {
+	s.mutex.Lock()
+	proc := s.proc
+	s.mutex.Unlock()
+	if proc == nil {
+		return ErrNotServing
+	}
+	done := make(chan struct{})
+	op := func() {
+		fn(proc)
+		close(done)
+	}
+	select {
+	case proc.admin <- op:
+	case <-proc.done:
+		return ErrNotServing
+	}
+	<-done
+	return nil
+}
+
+// Durables returns the status of the durable topic subscriptions.
+func (s *Server) Durables() ([]*status.DurableStatus, error) {
+	var result []*status.DurableStatus
+	err := s.admin(func(proc *requestProcessor) {
+		for _, vh := range proc.vhosts {
+			result = append(result, vh.durableStatus()...)
+		}
+	})
+	return result, err
+}
+
+// DeleteDurable deletes the durable subscription of a client to a topic,
+// and discards the messages kept for it. On a server with virtual hosts,
+// it is deleted from every virtual host that has it.
+func (s *Server) DeleteDurable(clientId, name string) error {
+	deleted := false
+	err := s.admin(func(proc *requestProcessor) {
+		for _, vh := range proc.vhosts {
+			if vh.durables.Delete(clientId, name) {
+				deleted = true
+			}
+		}
+	})
+	if err == nil && !deleted {
+		err = ErrDurableNotFound
+	}
+	return err
+}
+
+// DeleteInactiveDurables deletes the durable subscriptions that have had no
+// subscriber for at least the given duration, and discards the messages
+// kept for them. Returns the number of durable subscriptions deleted.
+func (s *Server) DeleteInactiveDurables(inactive time.Duration) (int, error) {
+	count := 0
+	err := s.admin(func(proc *requestProcessor) {
+		before := time.Now().Add(-inactive)
+		for _, vh := range proc.vhosts {
+			count += vh.durables.DeleteInactive(before)
+		}
+	})
+	return count, err
 }
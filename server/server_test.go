@@ -5,8 +5,10 @@ import (
 	"net"
 	"runtime"
 	"testing"
+	"time"
 
 	"github.com/go-stomp/stomp"
+	"github.com/go-stomp/stomp/server/queue"
 	. "gopkg.in/check.v1"
 )
 
@@ -26,23 +28,35 @@ func (s *ServerSuite) TearDownSuite(c *C) {
 	runtime.GOMAXPROCS(1)
 }
 
+// serve runs a server with in-memory queues on a listener
+// until the test shuts it down.
+func serve(c *C, l net.Listener) *Server {
+	server := NewServer(&ServerConfig{
+		Status:           30,
+		StatusLog:        300,
+		MaxPendingReads:  300,
+		MaxPendingWrites: 300,
+	}, nil)
+	go server.serve(l)
+	for {
+		if _, err := server.Durables(); err != ErrNotServing {
+			return server
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
 func (s *ServerSuite) TestConnectAndDisconnect(c *C) {
 	addr := ":59091"
 	l, err := net.Listen("tcp", addr)
 	c.Assert(err, IsNil)
-	defer func() { l.Close() }()
-	go Serve(l)
+	defer serve(c, l).Shutdown()
 
-	conn, err := net.Dial("tcp", "127.0.0.1"+addr)
-	c.Assert(err, IsNil)
-
-	client, err := stomp.Connect(conn)
+	client, err := stomp.Dial("tcp", "127.0.0.1"+addr)
 	c.Assert(err, IsNil)
 
 	err = client.Disconnect()
 	c.Assert(err, IsNil)
-
-	conn.Close()
 }
 
 func (s *ServerSuite) TestSendToQueuesAndTopics(c *C) {
@@ -53,8 +67,7 @@ func (s *ServerSuite) TestSendToQueuesAndTopics(c *C) {
 
 	l, err := net.Listen("tcp", addr)
 	c.Assert(err, IsNil)
-	defer func() { l.Close() }()
-	go Serve(l)
+	defer serve(c, l).Shutdown()
 
 	// channel to communicate that the go routine has started
 	started := make(chan bool)
@@ -97,10 +110,7 @@ func (s *ServerSuite) TestSendToQueuesAndTopics(c *C) {
 }
 
 func runSender(c *C, ch chan bool, count int, destination, addr string, started chan bool) {
-	conn, err := net.Dial("tcp", "127.0.0.1"+addr)
-	c.Assert(err, IsNil)
-
-	client, err := stomp.Connect(conn)
+	client, err := stomp.Dial("tcp", "127.0.0.1"+addr)
 	c.Assert(err, IsNil)
 
 	started <- true
@@ -115,10 +125,7 @@ func runSender(c *C, ch chan bool, count int, destination, addr string, started
 }
 
 func runReceiver(c *C, ch chan bool, count int, destination, addr string, started chan bool) {
-	conn, err := net.Dial("tcp", "127.0.0.1"+addr)
-	c.Assert(err, IsNil)
-
-	client, err := stomp.Connect(conn)
+	client, err := stomp.Dial("tcp", "127.0.0.1"+addr)
 	c.Assert(err, IsNil)
 
 	sub, err := client.Subscribe(destination, stomp.AckAuto)
@@ -135,3 +142,58 @@ func runReceiver(c *C, ch chan bool, count int, destination, addr string, starte
 	}
 	ch <- true
 }
+
+// stopCountingStorage counts how often the queue storage is stopped.
+type stopCountingStorage struct {
+	QueueStorage
+	stops int
+}
+
+func (s *stopCountingStorage) Stop() error {
+	s.stops++
+	return s.QueueStorage.Stop()
+}
+
+func (s *ServerSuite) TestConnectInvalidClientId(c *C) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer serve(c, l).Shutdown()
+
+	// would share the durable queues of client "a" with subscription
+	// names starting with "b/"
+	_, err = stomp.Dial("tcp", l.Addr().String(),
+		stomp.ConnOpt.NoReconnect, stomp.ConnOpt.Header("client-id", "a/b"))
+	c.Check(err, ErrorMatches, "client-id must not contain '/'")
+
+	client, err := stomp.Dial("tcp", l.Addr().String(),
+		stomp.ConnOpt.NoReconnect, stomp.ConnOpt.Header("client-id", "a"))
+	c.Assert(err, IsNil)
+	c.Check(client.Disconnect(), IsNil)
+}
+
+func (s *ServerSuite) TestShutdown(c *C) {
+	qstore := &stopCountingStorage{QueueStorage: queue.NewMemoryQueueStorage()}
+	server := NewServer(&ServerConfig{Status: 30, StatusLog: 300}, nil)
+	server.QueueStorage = qstore
+	c.Check(server.Shutdown(), Equals, ErrNotServing)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	served := make(chan error, 1)
+	go func() { served <- server.serve(l) }()
+	for {
+		if _, err := server.Durables(); err != ErrNotServing {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	c.Check(server.Shutdown(), IsNil)
+	c.Check(<-served, IsNil)
+	c.Check(qstore.stops, Equals, 1)
+	_, err = server.Durables()
+	c.Check(err, Equals, ErrNotServing)
+	c.Check(server.Shutdown(), Equals, ErrNotServing)
+	_, err = net.Dial("tcp", l.Addr().String())
+	c.Check(err, NotNil)
+}
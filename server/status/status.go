@@ -9,6 +9,8 @@ type ServerClientStatus struct {
 	ID                    int64
 	Address               string
 	Login                 string
+	ClientId              string
+	VirtualHost           string
 	Peer                  string
 	PeerName              string
 	Time                  string
@@ -22,24 +24,58 @@ type ServerClientStatus struct {
 }
 
 type QueueStatus struct {
+	Dest                string
+	MessageCount        int
+	TotalCount          int64
+	CurrentCount        int
+	SubscriptionCount   int
+	ExpiredCount        int64
+	CurrentExpiredCount int
+	DeadLetterCount     int64
+	PriorityCounts      []int // messages stored for each priority, indexed by priority
+}
+
+type TopicStatus struct {
 	Dest              string
-	MessageCount      int
 	TotalCount        int64
 	CurrentCount      int
 	SubscriptionCount int
 }
 
-type TopicStatus struct {
+type DurableStatus struct {
+	VirtualHost       string
+	ClientId          string
+	Name              string
 	Dest              string
-	TotalCount        int64
-	CurrentCount      int
+	MessageCount      int
 	SubscriptionCount int
+	Inactive          string // when the last subscriber left, empty while subscribed
+}
+
+type ScheduledStatus struct {
+	Dest         string
+	MessageCount int // messages waiting for their delivery time
+}
+
+// VirtualHostStatus is the status of the destinations and clients of
+// a virtual host. A server with virtual hosts reports them in
+// ServerStatus.VirtualHosts, instead of the lists of ServerStatus.
+type VirtualHostStatus struct {
+	Name      string
+	Clients   []*ServerClientStatus
+	Queues    []*QueueStatus
+	Topics    []*TopicStatus
+	Durables  []*DurableStatus
+	Scheduled []*ScheduledStatus
 }
 
 type ServerStatus struct {
 	Clients                   []*ServerClientStatus
 	Queues                    []*QueueStatus
 	Topics                    []*TopicStatus
+	Durables                  []*DurableStatus
+	Scheduled                 []*ScheduledStatus
+	VirtualHosts              []*VirtualHostStatus
 	Time                      string  `json:"utc"`
 	Type                      string  `json:"type"`
 	Id                        string  `json:"id"`
@@ -0,0 +1,255 @@
+package topic
+
+import (
+	"time"
+
+	"github.com/go-stomp/stomp/frame"
+	"github.com/go-stomp/stomp/server/client"
+	"github.com/go-stomp/stomp/server/queue"
+	"github.com/go-stomp/stomp/server/selector"
+	"github.com/go-stomp/stomp/server/status"
+)
+
+// Queues for durable subscriptions are named with this prefix, followed
+// by the client-id, which cannot contain a '/', and the name of the
+// subscription.
+const DurablePrefix = "/durable/"
+
+// Queue of the queue storage in which the durable subscriptions are
+// recorded, one SUBSCRIBE frame each, so that Load restores them when
+// the server restarts. It is not a destination.
+const DurableRegistry = DurablePrefix
+
+// A Durable is a subscription to a topic that outlives the connection of
+// its client. It is identified by the client-id of the client and the name
+// of the subscription. The messages sent to the topic are stored in a queue,
+// so that they are kept while the client is absent, and are delivered with
+// acknowledgement like the messages of a queue.
+type Durable struct {
+	key      string // name of the queue
+	clientId string
+	name     string
+	topic    *Topic
+	selector *selector.Selector // selects the messages stored, if any
+	queue    *queue.Queue
+	subs     map[*client.Subscription]bool // subscriptions attached to the durable
+	inactive time.Time                     // when the last subscription left
+}
+
+// Matches reports whether the durable subscription stores a message frame.
+func (d *Durable) Matches(f *frame.Frame) bool {
+	return d.selector == nil || d.selector.Matches(f)
+}
+
+// SendTopicFrame stores a message sent to the topic in
+// the queue of the durable subscription.
+func (d *Durable) SendTopicFrame(f *frame.Frame) {
+	if err := d.queue.Enqueue(f); err != nil {
+		log.Errorf("durable %s: enqueue: %s", d.key, err.Error())
+	}
+}
+
+// Subscribe attaches a client subscription to the durable subscription. It is
+// called for every message the client subscription is ready to receive, like
+// Queue.Subscribe.
+func (d *Durable) Subscribe(sub *client.Subscription) error {
+	d.subs[sub] = true
+	return d.queue.Subscribe(sub)
+}
+
+// Unsubscribe detaches a client subscription. Messages sent to the topic
+// are kept until a client subscribes again.
+func (d *Durable) Unsubscribe(sub *client.Subscription) {
+	d.queue.Unsubscribe(sub)
+	if d.subs[sub] {
+		delete(d.subs, sub)
+		if len(d.subs) == 0 {
+			d.inactive = time.Now()
+		}
+	}
+}
+
+// Requeue returns a message that was not acknowledged to the
+// head of the queue of the durable subscription.
+func (d *Durable) Requeue(f *frame.Frame) error {
+	return d.queue.Requeue(f)
+}
+
+func (d *Durable) GetStatus() *status.DurableStatus {
+	durableStatus := &status.DurableStatus{
+		ClientId:          d.clientId,
+		Name:              d.name,
+		Dest:              d.topic.destination,
+		MessageCount:      d.queue.Count(),
+		SubscriptionCount: len(d.subs),
+	}
+	if len(d.subs) == 0 {
+		durableStatus.Inactive = d.inactive.Format(time.RFC3339)
+	}
+	return durableStatus
+}
+
+// Durables keeps the durable subscriptions to the topics of a
+// topic manager, storing their messages with a queue manager, and
+// recording the subscriptions in DurableRegistry of the queue storage.
+type Durables struct {
+	tm       *Manager
+	qm       *queue.Manager
+	qstore   queue.Storage
+	durables map[string]*Durable
+}
+
+// NewDurables creates a durable subscription registry.
+func NewDurables(tm *Manager, qm *queue.Manager, qstore queue.Storage) *Durables {
+	return &Durables{
+		tm:       tm,
+		qm:       qm,
+		qstore:   qstore,
+		durables: make(map[string]*Durable),
+	}
+}
+
+// Load restores the durable subscriptions recorded in the queue storage,
+// so that the topics keep messages for them until their clients return.
+func (ds *Durables) Load() error {
+	return ds.qstore.Each(DurableRegistry, func(id string, f *frame.Frame) bool {
+		var sel *selector.Selector
+		if text, ok := f.Header.Contains(frame.Selector); ok {
+			var err error
+			if sel, err = selector.Parse(text); err != nil {
+				log.Errorf("durable registry: %s", err.Error())
+				return true
+			}
+		}
+		ds.add(f.Header.Get(frame.ClientId), f.Header.Get(frame.DurableSubscriptionName),
+			f.Header.Get(frame.Destination), sel)
+		return true
+	})
+}
+
+func durableQueue(clientId, name string) string {
+	return DurablePrefix + clientId + "/" + name
+}
+
+// Find returns the durable subscription of a client to the topic for the
+// given destination and selector, creating it if necessary. A durable
+// subscription that has the same client-id and name but a different
+// destination or selector is deleted first, together with its messages.
+func (ds *Durables) Find(clientId, name, destination string, sel *selector.Selector) *Durable {
+	key := durableQueue(clientId, name)
+	d, ok := ds.durables[key]
+	if ok && d.topic.destination == destination && selectorText(d.selector) == selectorText(sel) {
+		return d
+	}
+	if ok {
+		ds.Delete(clientId, name)
+	}
+
+	f := frame.New(frame.SUBSCRIBE,
+		frame.Destination, destination,
+		frame.ClientId, clientId,
+		frame.DurableSubscriptionName, name)
+	if sel != nil {
+		f.Header.Set(frame.Selector, sel.String())
+	}
+	if err := ds.qstore.Enqueue(DurableRegistry, f); err != nil {
+		log.Errorf("durable %s: record: %s", key, err.Error())
+	}
+	return ds.add(clientId, name, destination, sel)
+}
+
+// add creates a durable subscription and subscribes it to its topic.
+func (ds *Durables) add(clientId, name, destination string, sel *selector.Selector) *Durable {
+	key := durableQueue(clientId, name)
+	d := &Durable{
+		key:      key,
+		clientId: clientId,
+		name:     name,
+		topic:    ds.tm.Find(destination),
+		selector: sel,
+		queue:    ds.qm.Find(key),
+		subs:     make(map[*client.Subscription]bool),
+		inactive: time.Now(),
+	}
+	d.topic.Subscribe(d)
+	ds.durables[key] = d
+	return d
+}
+
+func selectorText(sel *selector.Selector) string {
+	if sel == nil {
+		return ""
+	}
+	return sel.String()
+}
+
+// Lookup returns the durable subscription for the client-id and name, if any.
+func (ds *Durables) Lookup(clientId, name string) (*Durable, bool) {
+	d, ok := ds.durables[durableQueue(clientId, name)]
+	return d, ok
+}
+
+// Delete removes a durable subscription from its topic and discards its
+// messages. A client still subscribed starts a new durable subscription,
+// without the discarded messages, the next time it is ready for a message.
+// Returns false if there is no such durable subscription.
+func (ds *Durables) Delete(clientId, name string) bool {
+	key := durableQueue(clientId, name)
+	d, ok := ds.durables[key]
+	if !ok {
+		return false
+	}
+	delete(ds.durables, key)
+	d.topic.Unsubscribe(d)
+	for sub := range d.subs {
+		d.queue.Unsubscribe(sub)
+	}
+	if err := d.queue.Purge(); err != nil {
+		log.Errorf("durable %s: purge: %s", key, err.Error())
+	}
+	ds.qm.Remove(key)
+	if err := ds.forget(clientId, name); err != nil {
+		log.Errorf("durable %s: forget: %s", key, err.Error())
+	}
+	return true
+}
+
+// forget removes the record of a durable subscription
+// from the queue storage.
+func (ds *Durables) forget(clientId, name string) error {
+	var ids []string
+	err := ds.qstore.Each(DurableRegistry, func(id string, f *frame.Frame) bool {
+		if f.Header.Get(frame.ClientId) == clientId && f.Header.Get(frame.DurableSubscriptionName) == name {
+			ids = append(ids, id)
+		}
+		return true
+	})
+	for _, id := range ids {
+		if err == nil {
+			err = ds.qstore.Remove(DurableRegistry, id)
+		}
+	}
+	return err
+}
+
+// DeleteInactive deletes the durable subscriptions that have had no client
+// subscription attached since before the given time, and returns how many
+// were deleted.
+func (ds *Durables) DeleteInactive(before time.Time) int {
+	count := 0
+	for _, d := range ds.durables {
+		if len(d.subs) == 0 && d.inactive.Before(before) {
+			ds.Delete(d.clientId, d.name)
+			count++
+		}
+	}
+	return count
+}
+
+func (ds *Durables) GetStatus() []*status.DurableStatus {
+	result := make([]*status.DurableStatus, 0)
+	for _, d := range ds.durables {
+		result = append(result, d.GetStatus())
+	}
+	return result
+}
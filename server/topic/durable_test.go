@@ -0,0 +1,144 @@
+package topic
+
+import (
+	"time"
+
+	"github.com/go-stomp/stomp/frame"
+	"github.com/go-stomp/stomp/server/queue"
+	"github.com/go-stomp/stomp/server/selector"
+	. "gopkg.in/check.v1"
+)
+
+type DurableSuite struct{}
+
+var _ = Suite(&DurableSuite{})
+
+func (s *DurableSuite) TestMessagesKeptWhileAbsent(c *C) {
+	qstore := queue.NewMemoryQueueStorage()
+	tm := NewManager()
+	ds := NewDurables(tm, queue.NewManager(qstore), qstore)
+
+	d := ds.Find("client1", "sub1", "/topic/test", nil)
+	c.Assert(ds.Find("client1", "sub1", "/topic/test", nil), Equals, d)
+
+	sub := &fakeSubscription{}
+	tm.Find("/topic/test").Subscribe(sub)
+
+	f := frame.New(frame.MESSAGE, frame.Destination, "/topic/test")
+	tm.Find("/topic/test").Enqueue(f)
+
+	c.Assert(len(sub.Frames), Equals, 1)
+	c.Assert(qstore.Count(DurablePrefix+"client1/sub1"), Equals, 1)
+
+	stored, err := qstore.Dequeue(DurablePrefix + "client1/sub1")
+	c.Assert(err, IsNil)
+	c.Assert(stored.Header.Get(frame.Destination), Equals, "/topic/test")
+
+	durables := ds.GetStatus()
+	c.Assert(len(durables), Equals, 1)
+	c.Check(durables[0].ClientId, Equals, "client1")
+	c.Check(durables[0].Name, Equals, "sub1")
+	c.Check(durables[0].Dest, Equals, "/topic/test")
+	c.Check(durables[0].SubscriptionCount, Equals, 0)
+	c.Check(durables[0].Inactive, Not(Equals), "")
+}
+
+func (s *DurableSuite) TestDelete(c *C) {
+	qstore := queue.NewMemoryQueueStorage()
+	tm := NewManager()
+	ds := NewDurables(tm, queue.NewManager(qstore), qstore)
+
+	ds.Find("client1", "sub1", "/topic/test", nil)
+	tm.Find("/topic/test").Enqueue(frame.New(frame.MESSAGE, frame.Destination, "/topic/test"))
+	c.Assert(qstore.Count(DurablePrefix+"client1/sub1"), Equals, 1)
+
+	c.Assert(ds.Delete("client1", "sub1"), Equals, true)
+	c.Assert(ds.Delete("client1", "sub1"), Equals, false)
+	c.Assert(qstore.Count(DurablePrefix+"client1/sub1"), Equals, 0)
+
+	_, ok := ds.Lookup("client1", "sub1")
+	c.Assert(ok, Equals, false)
+
+	// no longer subscribed to the topic
+	tm.Find("/topic/test").Enqueue(frame.New(frame.MESSAGE, frame.Destination, "/topic/test"))
+	c.Assert(qstore.Count(DurablePrefix+"client1/sub1"), Equals, 0)
+}
+
+func (s *DurableSuite) TestChangeDestination(c *C) {
+	qstore := queue.NewMemoryQueueStorage()
+	tm := NewManager()
+	ds := NewDurables(tm, queue.NewManager(qstore), qstore)
+
+	d1 := ds.Find("client1", "sub1", "/topic/one", nil)
+	tm.Find("/topic/one").Enqueue(frame.New(frame.MESSAGE, frame.Destination, "/topic/one"))
+
+	d2 := ds.Find("client1", "sub1", "/topic/two", nil)
+	c.Assert(d2 == d1, Equals, false)
+	c.Assert(qstore.Count(DurablePrefix+"client1/sub1"), Equals, 0)
+
+	tm.Find("/topic/one").Enqueue(frame.New(frame.MESSAGE, frame.Destination, "/topic/one"))
+	c.Assert(qstore.Count(DurablePrefix+"client1/sub1"), Equals, 0)
+	tm.Find("/topic/two").Enqueue(frame.New(frame.MESSAGE, frame.Destination, "/topic/two"))
+	c.Assert(qstore.Count(DurablePrefix+"client1/sub1"), Equals, 1)
+}
+
+func (s *DurableSuite) TestSelector(c *C) {
+	qstore := queue.NewMemoryQueueStorage()
+	tm := NewManager()
+	ds := NewDurables(tm, queue.NewManager(qstore), qstore)
+
+	eu, err := selector.Parse("region = 'eu'")
+	c.Assert(err, IsNil)
+	d1 := ds.Find("client1", "sub1", "/topic/test", eu)
+	tm.Find("/topic/test").Enqueue(frame.New(frame.MESSAGE, frame.Destination, "/topic/test", "region", "eu"))
+	tm.Find("/topic/test").Enqueue(frame.New(frame.MESSAGE, frame.Destination, "/topic/test", "region", "us"))
+	c.Assert(qstore.Count(DurablePrefix+"client1/sub1"), Equals, 1)
+
+	// the same selector keeps the durable subscription, another one replaces it
+	same, err := selector.Parse("region = 'eu'")
+	c.Assert(err, IsNil)
+	c.Assert(ds.Find("client1", "sub1", "/topic/test", same) == d1, Equals, true)
+	d2 := ds.Find("client1", "sub1", "/topic/test", nil)
+	c.Assert(d2 == d1, Equals, false)
+	c.Assert(qstore.Count(DurablePrefix+"client1/sub1"), Equals, 0)
+}
+
+func (s *DurableSuite) TestDeleteInactive(c *C) {
+	qstore := queue.NewMemoryQueueStorage()
+	ds := NewDurables(NewManager(), queue.NewManager(qstore), qstore)
+
+	ds.Find("client1", "sub1", "/topic/test", nil)
+	c.Assert(ds.DeleteInactive(time.Now().Add(-time.Hour)), Equals, 0)
+	c.Assert(ds.DeleteInactive(time.Now().Add(time.Second)), Equals, 1)
+	c.Assert(len(ds.GetStatus()), Equals, 0)
+}
+
+func (s *DurableSuite) TestLoad(c *C) {
+	qstore := queue.NewMemoryQueueStorage()
+	ds := NewDurables(NewManager(), queue.NewManager(qstore), qstore)
+	sel, err := selector.Parse("type = 'order'")
+	c.Assert(err, IsNil)
+	ds.Find("client1", "sub1", "/topic/test", sel)
+	ds.Find("client1", "sub2", "/topic/test", nil)
+	ds.Find("client2", "sub1", "/topic/other", nil)
+	ds.Find("client2", "sub1", "/topic/test", nil)
+	ds.Delete("client1", "sub2")
+	c.Assert(qstore.Count(DurableRegistry), Equals, 2)
+
+	// a restarted server keeps the messages for the recorded subscriptions
+	tm := NewManager()
+	ds = NewDurables(tm, queue.NewManager(qstore), qstore)
+	c.Assert(ds.Load(), IsNil)
+	c.Assert(len(ds.GetStatus()), Equals, 2)
+	_, ok := ds.Lookup("client1", "sub2")
+	c.Check(ok, Equals, false)
+
+	tm.Publish("/topic/test", frame.New(frame.MESSAGE, frame.Destination, "/topic/test", "type", "order"))
+	tm.Publish("/topic/test", frame.New(frame.MESSAGE, frame.Destination, "/topic/test", "type", "invoice"))
+	c.Check(qstore.Count(DurablePrefix+"client1/sub1"), Equals, 1)
+	c.Check(qstore.Count(DurablePrefix+"client2/sub1"), Equals, 2)
+
+	d, ok := ds.Lookup("client2", "sub1")
+	c.Assert(ok, Equals, true)
+	c.Check(d.GetStatus().Dest, Equals, "/topic/test")
+}
@@ -1,6 +1,10 @@
 package topic
 
 import (
+	"time"
+
+	"github.com/go-stomp/stomp/frame"
+	"github.com/go-stomp/stomp/server/queue"
 	"github.com/go-stomp/stomp/server/status"
 	"github.com/ventu-io/slf"
 )
@@ -15,25 +19,57 @@ func init() {
 // not created by the package user, rather they are created on demand
 // by the topic manager.
 type Manager struct {
-	topics map[string]*Topic
+	topics    map[string]*Topic
+	wildcards *trie // topics with wildcard destinations
 }
 
 // NewManager creates a new topic manager.
 func NewManager() *Manager {
-	tm := &Manager{topics: make(map[string]*Topic)}
+	tm := &Manager{
+		topics:    make(map[string]*Topic),
+		wildcards: newTrie(),
+	}
 	return tm
 }
 
 // Finds the topic for the given destination, and creates it if necessary.
+// The destination of a topic may contain wildcards, in which case its
+// subscriptions receive the messages published to every matching topic.
 func (tm *Manager) Find(destination string) *Topic {
 	t, ok := tm.topics[destination]
 	if !ok {
 		t = newTopic(destination)
 		tm.topics[destination] = t
+		if IsWildcard(destination) {
+			tm.wildcards.add(t)
+		}
 	}
 	return t
 }
 
+// Publish sends a message to the topic for the given destination, and to
+// the topics with wildcard destinations that match it. Every subscription
+// that selects the message receives a copy of it, unless it has expired.
+func (tm *Manager) Publish(destination string, f *frame.Frame) {
+	topics := tm.wildcards.match(levels(destination), []*Topic{tm.Find(destination)})
+	expired := queue.Expired(f, time.Now())
+
+	var subs []Subscription
+	counted := make(map[*Topic]bool, len(topics))
+	for _, t := range topics {
+		if counted[t] {
+			continue
+		}
+		counted[t] = true
+		t.totalCount++
+		t.currentCount++
+		if !expired {
+			subs = t.matching(f, subs)
+		}
+	}
+	send(subs, f)
+}
+
 func (tm *Manager) GetStatus() []*status.TopicStatus {
 	result := make([]*status.TopicStatus, 0)
 	for _, v := range tm.topics {
@@ -1,6 +1,7 @@
 package topic
 
 import (
+	"github.com/go-stomp/stomp/frame"
 	. "gopkg.in/check.v1"
 )
 
@@ -19,3 +20,62 @@ func (s *ManagerSuite) TestManager(c *C) {
 
 	c.Assert(mgr.Find("topic1"), Equals, t1)
 }
+
+func (s *ManagerSuite) TestPublishWildcards(c *C) {
+	mgr := NewManager()
+
+	subs := make(map[string]*fakeSubscription)
+	for _, dest := range []string{
+		"/topic/orders.eu.created",
+		"/topic/orders.*.created",
+		"/topic/orders.*",
+		"/topic/orders.#",
+		"/topic/orders.>",
+		"/topic/#.created",
+		"/topic/#.#",
+		"/topic/*.us.*",
+		"/topic/invoices.#",
+	} {
+		subs[dest] = &fakeSubscription{}
+		mgr.Find(dest).Subscribe(subs[dest])
+	}
+
+	f := frame.New(frame.MESSAGE, frame.Destination, "/topic/orders.eu.created")
+	mgr.Publish("/topic/orders.eu.created", f)
+
+	received := map[string]int{
+		"/topic/orders.eu.created": 1,
+		"/topic/orders.*.created":  1,
+		"/topic/orders.*":          0,
+		"/topic/orders.#":          1,
+		"/topic/orders.>":          1,
+		"/topic/#.created":         1,
+		"/topic/#.#":               1,
+		"/topic/*.us.*":            0,
+		"/topic/invoices.#":        0,
+	}
+	for dest, n := range received {
+		c.Check(len(subs[dest].Frames), Equals, n, Commentf("%s", dest))
+	}
+
+	// a multi-level wildcard also matches no level at all
+	mgr.Publish("/topic/orders", frame.New(frame.MESSAGE, frame.Destination, "/topic/orders"))
+	c.Check(len(subs["/topic/orders.#"].Frames), Equals, 2)
+	c.Check(len(subs["/topic/orders.*"].Frames), Equals, 0)
+	c.Check(len(subs["/topic/#.#"].Frames), Equals, 2)
+
+	// topics count every message published to them once
+	for _, ts := range mgr.GetStatus() {
+		if ts.Dest == "/topic/#.#" {
+			c.Check(ts.TotalCount, Equals, int64(2))
+		}
+	}
+}
+
+func (s *ManagerSuite) TestIsWildcard(c *C) {
+	c.Check(IsWildcard("/topic/orders.*.created"), Equals, true)
+	c.Check(IsWildcard("/topic/orders/#"), Equals, true)
+	c.Check(IsWildcard("/topic/orders.>"), Equals, true)
+	c.Check(IsWildcard("/topic/orders.eu*"), Equals, false)
+	c.Check(IsWildcard("/topic/orders"), Equals, false)
+}
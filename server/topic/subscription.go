@@ -8,4 +8,7 @@ import (
 type Subscription interface {
 	// Send a message frame to the topic subscriber.
 	SendTopicFrame(f *frame.Frame)
+
+	// Matches reports whether the subscriber selects a message frame.
+	Matches(f *frame.Frame) bool
 }
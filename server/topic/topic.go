@@ -5,8 +5,10 @@ package topic
 
 import (
 	"container/list"
+	"time"
 
 	"github.com/go-stomp/stomp/frame"
+	"github.com/go-stomp/stomp/server/queue"
 	"github.com/go-stomp/stomp/server/status"
 )
 
@@ -56,28 +58,48 @@ func (t *Topic) Unsubscribe(sub Subscription) {
 	}
 }
 
-// Enqueue send a message to the topic. All subscriptions receive a copy
-// of the message.
+// Enqueue send a message to the topic. All subscriptions that select
+// the message receive a copy of it, unless it has already expired.
+// Subscriptions to wildcard destinations are reached through
+// Manager.Publish instead.
 func (t *Topic) Enqueue(f *frame.Frame) {
 	t.totalCount++
 	t.currentCount++
-	switch t.subs.Len() {
+	if queue.Expired(f, time.Now()) {
+		return
+	}
+	send(t.matching(f, nil), f)
+}
+
+// matching appends the subscriptions that select a frame. Selectors are
+// evaluated before sending, which sets the subscription header of the frame.
+func (t *Topic) matching(f *frame.Frame, subs []Subscription) []Subscription {
+	for e := t.subs.Front(); e != nil; e = e.Next() {
+		sub := e.Value.(Subscription)
+		if sub.Matches(f) {
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
+// send sends a frame to subscriptions.
+func send(subs []Subscription, f *frame.Frame) {
+	switch len(subs) {
 	case 0:
 	// no subscription, so do nothing
 
 	case 1:
 		// only one subscription, so can send the frame
 		// without copying
-		sub := t.subs.Front().Value.(Subscription)
-		sub.SendTopicFrame(f)
+		subs[0].SendTopicFrame(f)
 
 	default:
 		// more than one subscription, send clone for
 		// all subscriptions except the last, which can
 		// have the frame without copying
-		for e := t.subs.Front(); e != nil; e = e.Next() {
-			sub := e.Value.(Subscription)
-			if e.Next() == nil {
+		for i, sub := range subs {
+			if i == len(subs)-1 {
 				// the last in the list, send the frame
 				// without copying
 				sub.SendTopicFrame(f)
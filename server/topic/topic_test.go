@@ -2,6 +2,7 @@ package topic
 
 import (
 	"github.com/go-stomp/stomp/frame"
+	"github.com/go-stomp/stomp/server/selector"
 	. "gopkg.in/check.v1"
 )
 
@@ -53,11 +54,51 @@ func (s *TopicSuite) TestTopicWithTwoSubscriptions(c *C) {
 	c.Assert(sub2.Frames[0], Equals, f)
 }
 
+func (s *TopicSuite) TestTopicWithSelectors(c *C) {
+	eu, err := selector.Parse("region = 'eu'")
+	c.Assert(err, IsNil)
+	sub1 := &fakeSubscription{Selector: eu}
+	sub2 := &fakeSubscription{}
+	sub3 := &fakeSubscription{Selector: eu}
+
+	topic := newTopic("destination")
+	topic.Subscribe(sub1)
+	topic.Subscribe(sub2)
+	topic.Subscribe(sub3)
+
+	f := frame.New(frame.MESSAGE,
+		frame.Destination, "destination",
+		"region", "us")
+	topic.Enqueue(f)
+
+	c.Assert(len(sub1.Frames), Equals, 0)
+	c.Assert(len(sub2.Frames), Equals, 1)
+	c.Assert(len(sub3.Frames), Equals, 0)
+	c.Assert(sub2.Frames[0], Equals, f)
+
+	f = frame.New(frame.MESSAGE,
+		frame.Destination, "destination",
+		"region", "eu")
+	topic.Enqueue(f)
+
+	c.Assert(len(sub1.Frames), Equals, 1)
+	c.Assert(len(sub2.Frames), Equals, 2)
+	c.Assert(len(sub3.Frames), Equals, 1)
+	c.Assert(sub3.Frames[0], Equals, f)
+}
+
 type fakeSubscription struct {
 	// frames received by the subscription
 	Frames []*frame.Frame
+
+	// selects the frames received, if not nil
+	Selector *selector.Selector
 }
 
 func (s *fakeSubscription) SendTopicFrame(f *frame.Frame) {
 	s.Frames = append(s.Frames, f)
 }
+
+func (s *fakeSubscription) Matches(f *frame.Frame) bool {
+	return s.Selector == nil || s.Selector.Matches(f)
+}
@@ -0,0 +1,96 @@
+package topic
+
+import (
+	"strings"
+)
+
+// Wildcards in topic destinations. Destinations are divided into levels
+// by '/' and '.', and a wildcard stands for a whole level: SingleWildcard
+// matches exactly one level, and MultiWildcard or MultiWildcardAlt match
+// any number of levels, including none.
+const (
+	SingleWildcard   = "*"
+	MultiWildcard    = "#"
+	MultiWildcardAlt = ">"
+)
+
+// levels splits a destination into its levels.
+func levels(destination string) []string {
+	return strings.FieldsFunc(destination, func(r rune) bool {
+		return r == '/' || r == '.'
+	})
+}
+
+// IsWildcard reports whether a topic destination contains wildcards.
+func IsWildcard(destination string) bool {
+	for _, level := range levels(destination) {
+		switch level {
+		case SingleWildcard, MultiWildcard, MultiWildcardAlt:
+			return true
+		}
+	}
+	return false
+}
+
+// trie holds the topics with wildcard destinations, by level, so that the
+// topics matching a destination are found without looking at the others.
+type trie struct {
+	children map[string]*trie
+	single   *trie    // SingleWildcard
+	multi    *trie    // MultiWildcard or MultiWildcardAlt
+	topics   []*Topic // whose destinations end at this node
+}
+
+func newTrie() *trie {
+	return &trie{children: make(map[string]*trie)}
+}
+
+// add adds a topic with a wildcard destination.
+func (t *trie) add(topic *Topic) {
+	node := t
+	for _, level := range levels(topic.destination) {
+		var next *trie
+		switch level {
+		case SingleWildcard:
+			if node.single == nil {
+				node.single = newTrie()
+			}
+			next = node.single
+		case MultiWildcard, MultiWildcardAlt:
+			if node.multi == nil {
+				node.multi = newTrie()
+			}
+			next = node.multi
+		default:
+			next = node.children[level]
+			if next == nil {
+				next = newTrie()
+				node.children[level] = next
+			}
+		}
+		node = next
+	}
+	node.topics = append(node.topics, topic)
+}
+
+// match appends the topics whose wildcard destinations match the levels
+// of a destination. A topic is appended more than once if its destination
+// matches in several ways, which takes more than one multi-level wildcard.
+func (t *trie) match(levels []string, topics []*Topic) []*Topic {
+	if t.multi != nil {
+		// the wildcard takes any number of the remaining levels
+		for i := 0; i <= len(levels); i++ {
+			topics = t.multi.match(levels[i:], topics)
+		}
+	}
+	if len(levels) == 0 {
+		return append(topics, t.topics...)
+	}
+	if child, ok := t.children[levels[0]]; ok {
+		topics = child.match(levels[1:], topics)
+	}
+	if t.single != nil {
+		topics = t.single.match(levels[1:], topics)
+	}
+	return topics
+}
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/go-stomp/stomp/frame"
+)
+
+// VirtualHost is a namespace of destinations, chosen by clients with the
+// host header of their CONNECT frame. Clients of different virtual hosts
+// do not see each other's queues, topics, durable subscriptions or status.
+type VirtualHost struct {
+	Name             string            //host header of the clients, which must not contain "/"
+	Users            map[string]string //passcodes by login; Server.Authenticator authenticates if empty
+	MaxConnections   int               //unlimited if zero
+	MaxSubscriptions int               //of each connection, unlimited if zero
+}
+
+// Prefix of the names under which a virtual host keeps its queues in
+// the queue storage, followed by the name of the virtual host and a "/".
+const VirtualHostQueuePrefix = "/vhost/"
+
+// virtualHosts returns the virtual hosts of a server by name, which
+// is empty if the server has none.
+func virtualHosts(config *ServerConfig) (map[string]*VirtualHost, error) {
+	vhosts := make(map[string]*VirtualHost)
+	for i := range config.VirtualHosts {
+		vh := &config.VirtualHosts[i]
+		if vh.Name == "" {
+			return nil, errors.New("virtual host without name")
+		}
+		if strings.Contains(vh.Name, "/") {
+			return nil, errors.New("invalid virtual host name: " + vh.Name)
+		}
+		if _, ok := vhosts[vh.Name]; ok {
+			return nil, errors.New("duplicate virtual host: " + vh.Name)
+		}
+		vhosts[vh.Name] = vh
+	}
+	if config.DefaultVirtualHost != "" {
+		if _, ok := vhosts[config.DefaultVirtualHost]; !ok {
+			return nil, errors.New("unknown default virtual host: " + config.DefaultVirtualHost)
+		}
+	}
+	return vhosts, nil
+}
+
+// vhostStorage keeps the queues of a virtual host in the queue storage
+// of the server, apart from the queues of the other virtual hosts.
+// Scheduled frames are stored with the name of the virtual host in their
+// host header, so that each virtual host loads its own.
+//
+// The default virtual host also takes the frames stored without virtual
+// host, such as those kept from before virtual hosts were configured:
+// queued frames are moved into its own queues when it first uses them.
+type vhostStorage struct {
+	QueueStorage
+	name      string
+	isDefault bool            // also takes the frames stored without virtual host
+	adopted   map[string]bool // queues whose frames stored without virtual host were moved
+}
+
+func newVhostStorage(qstore QueueStorage, name string, isDefault bool) *vhostStorage {
+	return &vhostStorage{
+		QueueStorage: qstore,
+		name:         name,
+		isDefault:    isDefault,
+		adopted:      make(map[string]bool),
+	}
+}
+
+// queue returns the name of a queue in the queue storage. Virtual host
+// names contain no "/", so the names of different virtual hosts differ.
+func (s *vhostStorage) queue(name string) string {
+	return VirtualHostQueuePrefix + s.name + "/" + name
+}
+
+// use returns the name of a queue in the queue storage, once the default
+// virtual host has adopted the frames of the queue stored without virtual
+// host.
+func (s *vhostStorage) use(name string) (string, error) {
+	if s.isDefault && !s.adopted[name] {
+		if err := s.adopt(name); err != nil {
+			return "", err
+		}
+		s.adopted[name] = true
+	}
+	return s.queue(name), nil
+}
+
+// adopt moves the frames of a queue stored without virtual host to the
+// head of the queue of the virtual host, keeping their order.
+func (s *vhostStorage) adopt(name string) error {
+	var ids []string
+	var frames []*frame.Frame
+	err := s.QueueStorage.Each(name, func(id string, f *frame.Frame) bool {
+		ids = append(ids, id)
+		frames = append(frames, f)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for i := len(frames) - 1; i >= 0; i-- {
+		if err := s.QueueStorage.Requeue(s.queue(name), frames[i]); err != nil {
+			return err
+		}
+		if err := s.QueueStorage.Remove(name, ids[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *vhostStorage) Enqueue(queue string, f *frame.Frame) error {
+	queue, err := s.use(queue)
+	if err != nil {
+		return err
+	}
+	return s.QueueStorage.Enqueue(queue, f)
+}
+
+func (s *vhostStorage) Requeue(queue string, f *frame.Frame) error {
+	queue, err := s.use(queue)
+	if err != nil {
+		return err
+	}
+	return s.QueueStorage.Requeue(queue, f)
+}
+
+func (s *vhostStorage) Dequeue(queue string) (*frame.Frame, error) {
+	queue, err := s.use(queue)
+	if err != nil {
+		return nil, err
+	}
+	return s.QueueStorage.Dequeue(queue)
+}
+
+func (s *vhostStorage) Each(queue string, fn func(id string, f *frame.Frame) bool) error {
+	queue, err := s.use(queue)
+	if err != nil {
+		return err
+	}
+	return s.QueueStorage.Each(queue, fn)
+}
+
+func (s *vhostStorage) Remove(queue string, id string) error {
+	queue, err := s.use(queue)
+	if err != nil {
+		return err
+	}
+	return s.QueueStorage.Remove(queue, id)
+}
+
+// Count and CountByPriority leave out the frames stored without virtual
+// host if they cannot be adopted.
+func (s *vhostStorage) Count(queue string) int {
+	if _, err := s.use(queue); err != nil {
+		log.Errorf("adopt queue %s: %v", queue, err)
+	}
+	return s.QueueStorage.Count(s.queue(queue))
+}
+
+func (s *vhostStorage) CountByPriority(queue string) []int {
+	if _, err := s.use(queue); err != nil {
+		log.Errorf("adopt queue %s: %v", queue, err)
+	}
+	return s.QueueStorage.CountByPriority(s.queue(queue))
+}
+
+// Start and Stop are called for the storage of the server only.
+func (s *vhostStorage) Start() error {
+	return nil
+}
+
+func (s *vhostStorage) Stop() error {
+	return nil
+}
+
+func (s *vhostStorage) Schedule(f *frame.Frame) (uint64, error) {
+	f = f.Clone()
+	f.Header.Set(frame.Host, s.name)
+	return s.QueueStorage.Schedule(f)
+}
+
+func (s *vhostStorage) Scheduled() (map[uint64]*frame.Frame, error) {
+	scheduled, err := s.QueueStorage.Scheduled()
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[uint64]*frame.Frame)
+	for id, f := range scheduled {
+		host, ok := f.Header.Contains(frame.Host)
+		if host == s.name || !ok && s.isDefault {
+			f.Header.Del(frame.Host)
+			result[id] = f
+		}
+	}
+	return result, nil
+}
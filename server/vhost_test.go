@@ -0,0 +1,146 @@
+package server
+
+import (
+	"github.com/go-stomp/stomp/frame"
+	"github.com/go-stomp/stomp/server/queue"
+	. "gopkg.in/check.v1"
+)
+
+type VirtualHostSuite struct{}
+
+var _ = Suite(&VirtualHostSuite{})
+
+func (s *VirtualHostSuite) TestInvalidVirtualHosts(c *C) {
+	_, err := virtualHosts(&ServerConfig{VirtualHosts: []VirtualHost{{Name: ""}}})
+	c.Check(err, ErrorMatches, "virtual host without name")
+
+	_, err = virtualHosts(&ServerConfig{VirtualHosts: []VirtualHost{{Name: "a"}, {Name: "a"}}})
+	c.Check(err, ErrorMatches, "duplicate virtual host: a")
+
+	_, err = virtualHosts(&ServerConfig{VirtualHosts: []VirtualHost{{Name: "a/b"}}})
+	c.Check(err, ErrorMatches, "invalid virtual host name: a/b")
+
+	_, err = virtualHosts(&ServerConfig{VirtualHosts: []VirtualHost{{Name: "a"}}, DefaultVirtualHost: "b"})
+	c.Check(err, ErrorMatches, "unknown default virtual host: b")
+}
+
+func (s *VirtualHostSuite) TestConfig(c *C) {
+	server := NewServer(&ServerConfig{
+		VirtualHosts: []VirtualHost{
+			{Name: "tenant-a", Users: map[string]string{"alice": "secret"}, MaxConnections: 1, MaxSubscriptions: 2},
+			{Name: "tenant-b"},
+		},
+	}, nil)
+	vhosts, err := virtualHosts(server.Config)
+	c.Assert(err, IsNil)
+	config := newConfig(server, nil, vhosts)
+
+	vhost, ok := config.VirtualHost("tenant-a")
+	c.Check(vhost, Equals, "tenant-a")
+	c.Check(ok, Equals, true)
+	_, ok = config.VirtualHost("localhost")
+	c.Check(ok, Equals, false)
+
+	server.Config.DefaultVirtualHost = "tenant-b"
+	vhost, ok = config.VirtualHost("localhost")
+	c.Check(vhost, Equals, "tenant-b")
+	c.Check(ok, Equals, true)
+
+	c.Check(config.Authenticate("tenant-a", "alice", "secret"), Equals, true)
+	c.Check(config.Authenticate("tenant-a", "alice", "wrong"), Equals, false)
+	c.Check(config.Authenticate("tenant-a", "bob", ""), Equals, false)
+	c.Check(config.Authenticate("tenant-b", "bob", ""), Equals, true)
+
+	c.Check(config.ReserveConnection("tenant-a"), Equals, true)
+	c.Check(config.ReserveConnection("tenant-a"), Equals, false)
+	c.Check(config.ReserveConnection("tenant-b"), Equals, true)
+	config.ReleaseConnection("tenant-a")
+	c.Check(config.ReserveConnection("tenant-a"), Equals, true)
+
+	c.Check(config.MaxSubscriptions("tenant-a"), Equals, 2)
+	c.Check(config.MaxSubscriptions("tenant-b"), Equals, 0)
+}
+
+func (s *VirtualHostSuite) TestConfigWithoutVirtualHosts(c *C) {
+	config := newConfig(NewServer(&ServerConfig{}, nil), nil, nil)
+	vhost, ok := config.VirtualHost("localhost")
+	c.Check(vhost, Equals, "")
+	c.Check(ok, Equals, true)
+	c.Check(config.Authenticate("", "alice", ""), Equals, true)
+	c.Check(config.ReserveConnection(""), Equals, true)
+	c.Check(config.MaxSubscriptions(""), Equals, 0)
+}
+
+func (s *VirtualHostSuite) TestStorage(c *C) {
+	qstore := queue.NewMemoryQueueStorage()
+	a := newVhostStorage(qstore, "a", true)
+	b := newVhostStorage(qstore, "b", false)
+
+	c.Assert(a.Enqueue("/queue/orders", frame.New(frame.MESSAGE, frame.Destination, "/queue/orders")), IsNil)
+	c.Check(a.Count("/queue/orders"), Equals, 1)
+	c.Check(b.Count("/queue/orders"), Equals, 0)
+	c.Check(qstore.Count("/vhost/a//queue/orders"), Equals, 1)
+
+	f, err := b.Dequeue("/queue/orders")
+	c.Assert(err, IsNil)
+	c.Check(f, IsNil)
+	f, err = a.Dequeue("/queue/orders")
+	c.Assert(err, IsNil)
+	c.Check(f.Header.Get(frame.Destination), Equals, "/queue/orders")
+
+	// scheduled frames are loaded by their own virtual host, and those
+	// stored without virtual host by the default virtual host
+	_, err = a.Schedule(frame.New(frame.MESSAGE, frame.Destination, "/queue/a"))
+	c.Assert(err, IsNil)
+	_, err = b.Schedule(frame.New(frame.MESSAGE, frame.Destination, "/queue/b"))
+	c.Assert(err, IsNil)
+	_, err = qstore.Schedule(frame.New(frame.MESSAGE, frame.Destination, "/queue/none"))
+	c.Assert(err, IsNil)
+
+	scheduled, err := a.Scheduled()
+	c.Assert(err, IsNil)
+	dests := make(map[string]bool)
+	for _, f := range scheduled {
+		dests[f.Header.Get(frame.Destination)] = true
+		_, ok := f.Header.Contains(frame.Host)
+		c.Check(ok, Equals, false)
+	}
+	c.Check(dests, DeepEquals, map[string]bool{"/queue/a": true, "/queue/none": true})
+
+	scheduled, err = b.Scheduled()
+	c.Assert(err, IsNil)
+	c.Assert(len(scheduled), Equals, 1)
+	for _, f := range scheduled {
+		c.Check(f.Header.Get(frame.Destination), Equals, "/queue/b")
+	}
+}
+
+func (s *VirtualHostSuite) TestStorageNames(c *C) {
+	qstore := queue.NewMemoryQueueStorage()
+	a := newVhostStorage(qstore, "a", false)
+	ab := newVhostStorage(qstore, "ab", false)
+
+	c.Assert(a.Enqueue("b.orders", frame.New(frame.MESSAGE)), IsNil)
+	c.Check(a.Count("b.orders"), Equals, 1)
+	c.Check(ab.Count(".orders"), Equals, 0)
+}
+
+func (s *VirtualHostSuite) TestStorageAdoptsQueues(c *C) {
+	qstore := queue.NewMemoryQueueStorage()
+	c.Assert(qstore.Enqueue("/queue/orders", frame.New(frame.MESSAGE, "n", "1")), IsNil)
+	c.Assert(qstore.Enqueue("/queue/orders", frame.New(frame.MESSAGE, "n", "2")), IsNil)
+	a := newVhostStorage(qstore, "a", true)
+	b := newVhostStorage(qstore, "b", false)
+
+	// queued frames stored without virtual host go to the default
+	// virtual host, ahead of those queued since
+	c.Check(b.Count("/queue/orders"), Equals, 0)
+	c.Assert(a.Enqueue("/queue/orders", frame.New(frame.MESSAGE, "n", "3")), IsNil)
+	c.Check(a.Count("/queue/orders"), Equals, 3)
+	c.Check(qstore.Count("/queue/orders"), Equals, 0)
+	for _, n := range []string{"1", "2", "3"} {
+		f, err := a.Dequeue("/queue/orders")
+		c.Assert(err, IsNil)
+		c.Check(f.Header.Get("n"), Equals, n)
+	}
+}
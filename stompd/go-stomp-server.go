@@ -1,13 +1,19 @@
 /*
 A simple, stand-alone STOMP server.
 
-TODO: graceful shutdown
+The server stops on an interrupt, or on SIGTERM or SIGHUP on UNIX,
+after writing the messages held by its queue storage.
 
 TODO: UNIX daemon functionality
 
 TODO: Windows service functionality (if possible?)
 
 TODO: Logging options (syslog, windows event log)
+
+The "inspect" subcommand lists the messages kept by the "kv" queue
+storage, without starting the server:
+
+	stompd inspect [-messages] [-queue name] path
 */
 package main
 
@@ -56,6 +62,9 @@ var globalOpt = ConfFile{
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "inspect" {
+		os.Exit(inspect(os.Args[2:], os.Stdout))
+	}
 
 	log.Infof("BuildDate=%s\n", BuildDate)
 	log.Infof("GitCommit=%s\n", GitCommit)
@@ -70,6 +79,15 @@ func main() {
 	a := auth.NewAuth()
 	s := server.NewServer(&globalOpt.Global, a)
 
+	go func() {
+		sig := <-newStopChannel()
+		log.Infof("stopping on signal %v", sig)
+		if err := s.Shutdown(); err != nil {
+			log.Errorf("error Shutdown %v", err)
+			os.Exit(1)
+		}
+	}()
+
 	log.Error("-----------------------------------------------")
 	err := s.ListenAndServe()
 	if err != nil {
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/go-stomp/stomp/frame"
+	"github.com/go-stomp/stomp/server"
+	"github.com/go-stomp/stomp/server/queue"
+)
+
+// inspect implements the "inspect" subcommand, which lists the queues
+// kept by the "kv" queue storage, without a running server:
+//
+//	stompd inspect [-messages] [-queue name] path
+//
+// The path is either the storage file, or the QueueDir containing it.
+func inspect(args []string, out io.Writer) int {
+	flags := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	messages := flags.Bool("messages", false, "print the stored messages")
+	only := flags.String("queue", "", "inspect only this queue")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: stompd inspect [-messages] [-queue name] path")
+		return 2
+	}
+
+	path := flags.Arg(0)
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, server.KVQueueFile)
+	}
+
+	counts := make(map[string]int)
+	err := queue.InspectKVQueueStorage(path, func(name string, f *frame.Frame) error {
+		if *only != "" && name != *only {
+			return nil
+		}
+		counts[name]++
+		if *messages {
+			fmt.Fprintf(out, "%s #%d\n%s\n", name, counts[name], f.Dump())
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "stompd inspect: %s\n", err.Error())
+		return 1
+	}
+
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "%s\t%d\n", name, counts[name])
+	}
+	return 0
+}
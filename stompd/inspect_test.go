@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-stomp/stomp/frame"
+	"github.com/go-stomp/stomp/server"
+	"github.com/go-stomp/stomp/server/kvstore"
+	"github.com/go-stomp/stomp/server/queue"
+	. "gopkg.in/check.v1"
+)
+
+// Runs all gocheck tests in this package.
+// See other *_test.go files for gocheck tests.
+func TestStompd(t *testing.T) {
+	TestingT(t)
+}
+
+type InspectSuite struct {
+	dir string
+}
+
+var _ = Suite(&InspectSuite{})
+
+func (s *InspectSuite) SetUpTest(c *C) {
+	dir, err := ioutil.TempDir("", "stompd-inspect")
+	c.Assert(err, IsNil)
+	s.dir = dir
+
+	qstore := queue.NewKVQueueStorage(filepath.Join(dir, server.KVQueueFile), kvstore.Options{})
+	c.Assert(qstore.Start(), IsNil)
+	c.Assert(qstore.Enqueue("/queue/a", frame.New(frame.MESSAGE, frame.Destination, "/queue/a")), IsNil)
+	c.Assert(qstore.Enqueue("/queue/a", frame.New(frame.MESSAGE, frame.Destination, "/queue/a")), IsNil)
+	c.Assert(qstore.Enqueue("/queue/b", frame.New(frame.MESSAGE, frame.Destination, "/queue/b")), IsNil)
+	c.Assert(qstore.Stop(), IsNil)
+}
+
+func (s *InspectSuite) TearDownTest(c *C) {
+	os.RemoveAll(s.dir)
+}
+
+func (s *InspectSuite) TestCounts(c *C) {
+	var out bytes.Buffer
+	c.Check(inspect([]string{s.dir}, &out), Equals, 0)
+	c.Check(out.String(), Equals, "/queue/a\t2\n/queue/b\t1\n")
+
+	// the storage file can be named instead of its directory
+	out.Reset()
+	c.Check(inspect([]string{filepath.Join(s.dir, server.KVQueueFile)}, &out), Equals, 0)
+	c.Check(out.String(), Equals, "/queue/a\t2\n/queue/b\t1\n")
+}
+
+func (s *InspectSuite) TestMessages(c *C) {
+	var out bytes.Buffer
+	c.Check(inspect([]string{"-messages", "-queue", "/queue/b", s.dir}, &out), Equals, 0)
+	c.Check(out.String(), Equals, "/queue/b #1\nMESSAGE  \"destination\": \"/queue/b\"\n/queue/b\t1\n")
+}
+
+func (s *InspectSuite) TestErrors(c *C) {
+	var out bytes.Buffer
+	c.Check(inspect(nil, &out), Equals, 2)
+	c.Check(inspect([]string{"-unknown", s.dir}, &out), Equals, 2)
+	c.Check(inspect([]string{filepath.Join(s.dir, "missing")}, &out), Equals, 1)
+	c.Check(out.Len(), Equals, 0)
+}
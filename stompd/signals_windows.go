@@ -4,7 +4,7 @@ import (
 	"os"
 )
 
-func signals(signalChannel chan os.Signal) {
+func setupStopSignals(signalChannel chan os.Signal) {
 	// Windows has no other signals other than os.Interrupt
 
 	// TODO: What might be good here is to simulate a signal
@@ -1,6 +1,8 @@
 package stomp
 
 import (
+	"strconv"
+
 	"github.com/go-stomp/stomp/frame"
 )
 
@@ -16,6 +18,17 @@ var SubscribeOpt struct {
 	// Header provides the opportunity to include custom header entries
 	// in the SUBSCRIBE frame that the client sends to the server.
 	Header func(key, value string) func(*frame.Frame) error
+
+	// Prefetch asks the STOMP server to send at most n messages that
+	// have not been acknowledged, using the header entries recognised by
+	// ActiveMQ and RabbitMQ, and makes the subscription buffer up to n
+	// messages that have not been read from the C channel yet, so that
+	// a slow reader does not hold up the rest of the connection.
+	Prefetch func(n int) func(*frame.Frame) error
+
+	// Overflow specifies what the subscription does with a message that
+	// arrives when its buffer is full. The default is OverflowBlock.
+	Overflow func(policy OverflowPolicy) func(*frame.Frame) error
 }
 
 func init() {
@@ -38,4 +51,31 @@ func init() {
 			return nil
 		}
 	}
+
+	SubscribeOpt.Prefetch = func(n int) func(*frame.Frame) error {
+		return func(f *frame.Frame) error {
+			if f.Command != frame.SUBSCRIBE {
+				return ErrInvalidCommand
+			}
+			if n <= 0 {
+				return ErrInvalidPrefetch
+			}
+			f.Header.Set(prefetchSizeHeader, strconv.Itoa(n))
+			f.Header.Set(prefetchCountHeader, strconv.Itoa(n))
+			return nil
+		}
+	}
+
+	SubscribeOpt.Overflow = func(policy OverflowPolicy) func(*frame.Frame) error {
+		return func(f *frame.Frame) error {
+			if f.Command != frame.SUBSCRIBE {
+				return ErrInvalidCommand
+			}
+			if policy < OverflowBlock || policy > OverflowError {
+				return ErrInvalidOverflowPolicy
+			}
+			f.Header.Set(overflowHeader, policy.String())
+			return nil
+		}
+	}
 }
@@ -1,6 +1,7 @@
 package stomp
 
 import (
+	"context"
 	"fmt"
 	//"log"
 
@@ -19,13 +20,18 @@ type Subscription struct {
 	ackMode        AckMode
 	completed      bool
 	opts           []func(*frame.Frame) error
+	header         *frame.Header // of the SUBSCRIBE frame, sent again on reconnect
+	prefetch       int
+	overflow       OverflowPolicy
 	controlChannel chan func()
 	frameCh        chan *frame.Frame
 }
 
 // BUG(jpj): If the client does not read messages from the Subscription.C
-// channel quickly enough, the client will stop reading messages from the
-// server.
+// channel quickly enough, and the subscription's buffer is full, the client
+// will stop reading messages from the server, unless the subscription was
+// created with an overflow policy other than OverflowBlock. The buffer holds
+// the number of messages specified with SubscribeOpt.Prefetch.
 
 // Identification for this subscription. Unique among
 // all subscriptions for the same Client.
@@ -45,20 +51,53 @@ func (s *Subscription) AckMode() AckMode {
 }
 
 // Active returns whether the subscription is still active.
-// Returns false if the subscription has been unsubscribed.
+// Returns false if the subscription has been unsubscribed,
+// or its connection has been closed for good.
 func (s *Subscription) Active() bool {
-	return !s.completed
+	active := make(chan bool, 1)
+	s.controlChannel <- func() {
+		active <- !s.completed
+	}
+	return <-active
 }
 
-// Unsubscribes and closes the channel C.
+// Unsubscribes and closes the channel C. Does nothing if C has
+// already been closed.
 func (s *Subscription) Unsubscribe() {
-
+	done := make(chan struct{})
 	s.controlChannel <- func() {
+		defer close(done)
+		if s.completed {
+			// already unsubscribed, or the connection is closed
+			return
+		}
 		f := frame.New(frame.UNSUBSCRIBE, frame.Id, s.id)
 		s.conn.sendFrame(f)
 		s.completed = true
 		close(s.C)
 	}
+	<-done
+}
+
+// resubscribe sends the SUBSCRIBE frame again once the connection has
+// been re-established. Returns false, and does nothing, if the subscription
+// has been unsubscribed or closed.
+func (s *Subscription) resubscribe() bool {
+	active := make(chan bool, 1)
+	s.controlChannel <- func() {
+		if s.completed {
+			active <- false
+			return
+		}
+		// same header as the original SUBSCRIBE frame, including
+		// any custom header entries and the prefetch count
+		request := writeRequest{
+			Frame: &frame.Frame{Command: frame.SUBSCRIBE, Header: s.header.Clone()},
+			C:     s.frameCh,
+		}
+		active <- s.conn.writeContext(context.Background(), request) == nil
+	}
+	return <-active
 }
 
 // Read a message from the subscription. This is a convenience
@@ -79,31 +118,92 @@ func (s *Subscription) Read() (*Message, error) {
 }
 
 func (s *Subscription) readLoop(ch chan *frame.Frame) {
+	limit := s.prefetch
+	if limit == 0 {
+		limit = 1
+	}
+
+	// messages received from the server but not yet delivered on C
+	var pending []*Message
+	var overflowMsg *Message
+
 	for {
+		if ch == nil && len(pending) == 0 && !s.completed {
+			// the connection has been closed for good
+			s.completed = true
+			close(s.C)
+		}
+
+		in := ch
+		if s.overflow == OverflowBlock && len(pending) >= limit {
+			in = nil
+		}
+		var out chan *Message
+		var next *Message
+		if len(pending) > 0 && !s.completed {
+			out, next = s.C, pending[0]
+		}
 
 		select {
 		case f := <-s.controlChannel:
 			f()
+			if s.completed {
+				pending, overflowMsg = nil, nil
+			}
 			continue
 
-		case f, ok := <-ch:
+		case out <- next:
+			pending[0] = nil
+			pending = pending[1:]
+			if next == overflowMsg {
+				overflowMsg = nil
+			}
+
+		case f, ok := <-in:
 			if !ok {
+				// no more frames for this subscription: C is
+				// closed once the pending messages are delivered
+				ch = nil
+				continue
+			}
+			if s.completed {
 				continue
 			}
 
 			if f.Command == frame.MESSAGE {
 				destination := f.Header.Get(frame.Destination)
 				contentType := f.Header.Get(frame.ContentType)
+				err := decompressBody(f, s.conn.maxDecompressedSize())
 				msg := &Message{
+					Err:          err,
 					Destination:  destination,
 					ContentType:  contentType,
 					Conn:         s.conn,
 					Subscription: s,
 					Header:       f.Header,
 					Body:         f.Body,
+					ctx:          s.conn.extractTrace(context.Background(), f.Header),
+				}
+				if len(pending) < limit {
+					pending = append(pending, msg)
+					continue
 				}
-				if !s.completed {
-					s.C <- msg
+				switch s.overflow {
+				case OverflowDropOldest:
+					log.Errorf("subscription %s: buffer full, dropping oldest message", s.id)
+					pending[0] = nil
+					pending = append(pending[1:], msg)
+				case OverflowError:
+					log.Errorf("subscription %s: buffer full, dropping message", s.id)
+					if overflowMsg == nil {
+						overflowMsg = &Message{
+							Err:          ErrSubscriptionOverflow,
+							Destination:  s.destination,
+							Conn:         s.conn,
+							Subscription: s,
+						}
+						pending = append(pending, overflowMsg)
+					}
 				}
 			} else if f.Command == frame.ERROR {
 				//log.Warn("subs: f.Command == frame.ERROR")
@@ -125,9 +225,8 @@ func (s *Subscription) readLoop(ch chan *frame.Frame) {
 					Header:       f.Header,
 					Body:         f.Body,
 				}
-				if !s.completed {
-					s.C <- msg
-				}
+				// errors are always delivered, even when the buffer is full
+				pending = append(pending, msg)
 				//s.completed = true
 				continue
 			}
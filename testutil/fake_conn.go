@@ -5,6 +5,7 @@ import (
 	. "gopkg.in/check.v1"
 	"io"
 	"net"
+	"sync"
 	"time"
 )
 
@@ -29,6 +30,8 @@ type FakeConn struct {
 	reader     io.ReadCloser
 	localAddr  net.Addr
 	remoteAddr net.Addr
+	mutex      sync.Mutex
+	deadline   *time.Timer
 }
 
 var (
@@ -100,8 +103,23 @@ func (fc *FakeConn) SetRemoteAddr(addr net.Addr) {
 	fc.remoteAddr = addr
 }
 
+// SetDeadline closes the connection once t has passed, which
+// unblocks any pending Read or Write. Unlike a net.Conn, the connection
+// cannot be used after the deadline has expired. A zero value for t
+// cancels the deadline.
 func (fc *FakeConn) SetDeadline(t time.Time) error {
-	panic("not implemented")
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	if fc.deadline != nil {
+		fc.deadline.Stop()
+		fc.deadline = nil
+	}
+	if !t.IsZero() {
+		fc.deadline = time.AfterFunc(t.Sub(time.Now()), func() {
+			fc.Close()
+		})
+	}
+	return nil
 }
 
 func (fc *FakeConn) SetReadDeadline(t time.Time) error {
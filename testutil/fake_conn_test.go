@@ -3,6 +3,7 @@ package testutil
 import (
 	. "gopkg.in/check.v1"
 	"testing"
+	"time"
 )
 
 func TestTestUtil(t *testing.T) {
@@ -59,3 +60,18 @@ func (s *FakeConnSuite) TestFakeConn(c *C) {
 
 	<-stop
 }
+
+func (s *FakeConnSuite) TestFakeConnDeadline(c *C) {
+	fc1, fc2 := NewFakeConn(c)
+
+	c.Assert(fc1.SetDeadline(time.Now().Add(time.Hour)), IsNil)
+	c.Assert(fc1.SetDeadline(time.Time{}), IsNil)
+	go fc2.Write([]byte{1})
+	n, err := fc1.Read(make([]byte, 1))
+	c.Assert(n, Equals, 1)
+	c.Assert(err, IsNil)
+
+	c.Assert(fc1.SetDeadline(time.Unix(1, 0)), IsNil)
+	_, err = fc1.Read(make([]byte, 1))
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,105 @@
+package stomp
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/go-stomp/stomp/frame"
+)
+
+// A Propagator carries trace context between a context.Context and the
+// header of a STOMP frame, so that a span started by the program that sends
+// a message continues in the program that receives it. Specify a propagator
+// with ConnOpt.Propagator to bridge to a tracing SDK; by default TraceContext
+// is used, which needs no SDK.
+type Propagator interface {
+	// Inject adds the trace context in ctx, if any, to the header
+	// of a SEND frame.
+	Inject(ctx context.Context, h *frame.Header)
+
+	// Extract returns a copy of ctx that carries the trace
+	// context in the header of a MESSAGE frame, if any.
+	Extract(ctx context.Context, h *frame.Header) context.Context
+}
+
+// traceparentRegexp matches a W3C traceparent value: version, trace-id,
+// parent-id and trace-flags. Version ff and all-zero ids are invalid.
+var traceparentRegexp = regexp.MustCompile("^[0-9a-f]{2}-[0-9a-f]{32}-[0-9a-f]{16}-[0-9a-f]{2}(-.*)?$")
+
+// ValidTraceParent reports whether value is a valid W3C traceparent.
+func ValidTraceParent(value string) bool {
+	if !traceparentRegexp.MatchString(value) {
+		return false
+	}
+	if value[:2] == "ff" || (value[:2] == "00" && len(value) != 55) {
+		return false
+	}
+	return value[3:35] != "00000000000000000000000000000000" &&
+		value[36:52] != "0000000000000000"
+}
+
+type traceKey struct{}
+
+// traceHeaders is the trace context stored in a context.Context by TraceContext.
+type traceHeaders struct {
+	parent string
+	state  string
+}
+
+// ContextWithTrace returns a copy of ctx carrying a W3C trace context,
+// which the TraceContext propagator adds to messages sent with ctx.
+// Returns ctx unchanged if traceparent is not valid.
+func ContextWithTrace(ctx context.Context, traceparent, tracestate string) context.Context {
+	if !ValidTraceParent(traceparent) {
+		return ctx
+	}
+	return context.WithValue(ctx, traceKey{}, traceHeaders{parent: traceparent, state: tracestate})
+}
+
+// TraceFromContext returns the W3C trace context stored in ctx
+// by ContextWithTrace or the TraceContext propagator.
+func TraceFromContext(ctx context.Context) (traceparent, tracestate string, ok bool) {
+	t, ok := ctx.Value(traceKey{}).(traceHeaders)
+	return t.parent, t.state, ok
+}
+
+// TraceContext is a Propagator for the W3C traceparent and tracestate
+// header entries, which stores them in a context.Context as they are.
+type TraceContext struct{}
+
+func (TraceContext) Inject(ctx context.Context, h *frame.Header) {
+	if parent, state, ok := TraceFromContext(ctx); ok {
+		h.Set(frame.TraceParent, parent)
+		if state != "" {
+			h.Set(frame.TraceState, state)
+		}
+	}
+}
+
+func (TraceContext) Extract(ctx context.Context, h *frame.Header) context.Context {
+	if parent, ok := h.Contains(frame.TraceParent); ok {
+		return ContextWithTrace(ctx, parent, h.Get(frame.TraceState))
+	}
+	return ctx
+}
+
+// injectTrace adds the trace context in ctx to a SEND frame,
+// unless the program has already set the traceparent header.
+func (c *Conn) injectTrace(ctx context.Context, f *frame.Frame) {
+	if c.options == nil || c.options.Propagator == nil {
+		return
+	}
+	if _, ok := f.Header.Contains(frame.TraceParent); ok {
+		return
+	}
+	c.options.Propagator.Inject(ctx, f.Header)
+}
+
+// extractTrace returns a copy of ctx carrying the trace
+// context of a message received from the server.
+func (c *Conn) extractTrace(ctx context.Context, h *frame.Header) context.Context {
+	if c == nil || c.options == nil || c.options.Propagator == nil || h == nil {
+		return ctx
+	}
+	return c.options.Propagator.Extract(ctx, h)
+}
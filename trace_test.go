@@ -0,0 +1,67 @@
+package stomp
+
+import (
+	"context"
+
+	"github.com/go-stomp/stomp/frame"
+	. "gopkg.in/check.v1"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func (s *StompSuite) TestValidTraceParent(c *C) {
+	c.Check(ValidTraceParent(testTraceParent), Equals, true)
+	c.Check(ValidTraceParent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"), Equals, true)
+
+	for _, value := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+	} {
+		c.Check(ValidTraceParent(value), Equals, false, Commentf("%s", value))
+	}
+}
+
+func (s *StompSuite) TestTracePropagation(c *C) {
+	conn, rw := connectHelper(c, V12)
+	defer rw.Close()
+
+	go func() {
+		for {
+			f, err := rw.Read()
+			if err != nil {
+				return
+			}
+			if f.Command == frame.SEND {
+				// deliver the message back to the subscription "1"
+				msg := &frame.Frame{Command: frame.MESSAGE, Header: f.Header.Clone(), Body: f.Body}
+				msg.Header.Set(frame.Subscription, "1")
+				msg.Header.Set(frame.MessageId, "1")
+				rw.Write(msg)
+			}
+		}
+	}()
+	sub, err := conn.Subscribe("/queue/test", AckAuto, SubscribeOpt.Id("1"))
+	c.Assert(err, IsNil)
+
+	ctx := ContextWithTrace(context.Background(), testTraceParent, "vendor=value")
+	c.Assert(conn.SendContext(ctx, "/queue/test", "text/plain", nil), IsNil)
+
+	msg := <-sub.C
+	c.Check(msg.Header.Get(frame.TraceParent), Equals, testTraceParent)
+	parent, state, ok := TraceFromContext(msg.Context())
+	c.Check(ok, Equals, true)
+	c.Check(parent, Equals, testTraceParent)
+	c.Check(state, Equals, "vendor=value")
+
+	// no trace context without one in the sending context
+	c.Assert(conn.Send("/queue/test", "text/plain", nil), IsNil)
+	msg = <-sub.C
+	_, ok = msg.Header.Contains(frame.TraceParent)
+	c.Check(ok, Equals, false)
+	_, _, ok = TraceFromContext(msg.Context())
+	c.Check(ok, Equals, false)
+}
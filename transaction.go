@@ -1,6 +1,8 @@
 package stomp
 
 import (
+	"context"
+
 	"github.com/go-stomp/stomp/frame"
 )
 
@@ -33,12 +35,21 @@ func (tx *Transaction) Conn() *Conn {
 // Abort will abort the transaction. Any calls to Send, SendWithReceipt,
 // Ack and Nack on this transaction will be discarded.
 func (tx *Transaction) Abort() error {
+	return tx.AbortContext(context.Background())
+}
+
+// AbortContext is like Abort, but returns ctx.Err() if ctx is done
+// before the ABORT frame has been handed to the connection. In that
+// case the transaction is not marked as completed.
+func (tx *Transaction) AbortContext(ctx context.Context) error {
 	if tx.completed {
 		return ErrCompletedTransaction
 	}
 
 	f := frame.New(frame.ABORT, frame.Transaction, tx.id)
-	tx.conn.sendFrame(f)
+	if err := tx.conn.sendFrameContext(ctx, f); err != nil {
+		return err
+	}
 	tx.completed = true
 
 	return nil
@@ -47,12 +58,21 @@ func (tx *Transaction) Abort() error {
 // Commit will commit the transaction. All messages and acknowledgements
 // sent to the STOMP server on this transaction will be processed atomically.
 func (tx *Transaction) Commit() error {
+	return tx.CommitContext(context.Background())
+}
+
+// CommitContext is like Commit, but returns ctx.Err() if ctx is done
+// before the COMMIT frame has been handed to the connection. In that
+// case the transaction is not marked as completed.
+func (tx *Transaction) CommitContext(ctx context.Context) error {
 	if tx.completed {
 		return ErrCompletedTransaction
 	}
 
 	f := frame.New(frame.COMMIT, frame.Transaction, tx.id)
-	tx.conn.sendFrame(f)
+	if err := tx.conn.sendFrameContext(ctx, f); err != nil {
+		return err
+	}
 	tx.completed = true
 
 	return nil
@@ -69,18 +89,24 @@ func (tx *Transaction) Commit() error {
 //
 // TODO: document opts
 func (tx *Transaction) Send(destination, contentType string, body []byte, opts ...func(*frame.Frame) error) error {
+	return tx.SendContext(context.Background(), destination, contentType, body, opts...)
+}
+
+// SendContext is like Send, but the trace context in ctx is added to
+// the message, and ctx.Err() is returned if ctx is done before the
+// frame has been handed to the connection.
+func (tx *Transaction) SendContext(ctx context.Context, destination, contentType string, body []byte, opts ...func(*frame.Frame) error) error {
 	if tx.completed {
 		return ErrCompletedTransaction
 	}
 
-	f, err := createSendFrame(destination, contentType, body, opts)
+	f, err := tx.conn.createSendFrame(ctx, destination, contentType, body, opts)
 	if err != nil {
 		return err
 	}
 
 	f.Header.Set(frame.Transaction, tx.id)
-	tx.conn.sendFrame(f)
-	return nil
+	return tx.conn.sendFrameContext(ctx, f)
 }
 
 // Ack sends an acknowledgement for the message to the server. The STOMP